@@ -33,6 +33,8 @@ var (
 	RequestRTimeout = time.Duration(2000 * time.Millisecond)
 	//ResponseWTimeout of the api response write timeout in milliseconds
 	ResponseWTimeout = time.Duration(10000 * time.Millisecond)
+	//StreamTimeout is the time for which the routes streaming their response can run in seconds. Eg:- exports
+	StreamTimeout = time.Duration(10 * time.Minute)
 	//MaxRequests is the maximum no. of requests catered at a given point of time
 	MaxRequests = 1000
 	//RequestCleanUpCheck is the time after which request cleanup check has to happen
@@ -43,6 +45,27 @@ var (
 	DiscoveryToken = ""
 	//ServiceDomain is the url on which the service will be available across the platform
 	ServiceDomain = "127.0.0.1"
+	//MaxWidgetWorkers is the maximum no. of widget queries of a dashboard executed concurrently
+	MaxWidgetWorkers = 5
+	//MaxFederatedRows is the maximum no. of rows fetched from a datastore or joined in memory while executing a query spanning multiple datastores
+	MaxFederatedRows = 100000
+	//MaxSearchRows is the maximum no. of result rows returned by a search in a page
+	MaxSearchRows = 1000
+	//TrashRetention is the time for which the deleted dashboards are kept in the trash before purging them in hours
+	TrashRetention = time.Duration(30 * 24 * time.Hour)
+	//TrashPurgeCheck is the time after which the trash purge check has to happen in minutes
+	TrashPurgeCheck = time.Duration(60 * time.Minute)
+	//CacheTTL is the time for which the query results are cached in seconds. 0 disables the cache
+	CacheTTL = time.Duration(5 * time.Minute)
+	//CacheDatastoreTTL has the time for which the query results of a datastore are cached in seconds with the datastore id as the key.
+	//It overrides the CacheTTL for the datastore. 0 disables the cache for the datastore
+	CacheDatastoreTTL = map[uint]time.Duration{}
+	//CacheMaxRows is the maximum no. of result rows held in the query result cache
+	CacheMaxRows = 100000
+	//AdminUsers has the ids of the users administering the service. Admins can manage the table relationships of any datastore
+	AdminUsers = map[uint]bool{}
+	//DatastoreDialects has the sql dialect of the datastores with the datastore id as the key. Datastores not in it are postgres
+	DatastoreDialects = map[uint]string{}
 )
 
 //SkipVault will skip the vault initialization if set true
@@ -51,11 +74,15 @@ var SkipVault bool
 //IsTest indicates that the current runtime is for test
 var IsTest bool
 
+//AutoMigrate will apply the pending database migrations at the startup if set true
+var AutoMigrate bool
+
 func init() {
 	/*
 	 * Based on the env variables will set the
 	 *	* SkipVault
 	 *  * IsTest
+	 *  * AutoMigrate
 	 */
 	sk := os.Getenv("SKIP_VAULT")
 	if sk == "true" {
@@ -65,6 +92,10 @@ func init() {
 	if iT == "true" {
 		IsTest = true
 	}
+	aM := os.Getenv("AUTO_MIGRATE")
+	if aM == "true" {
+		AutoMigrate = true
+	}
 }
 
 func init() {
@@ -110,8 +141,19 @@ func init() {
 	 * We will init the request timeout
 	 * We will init the request body read timeout
 	 * We will init the request body write timeout
+	 * We will init the stream timeout
 	 * We will init the max no. of requests
+	 * We will init the max no. of widget workers
+	 * We will init the max no. of federated rows
+	 * We will init the max no. of search rows
 	 * We will init the request cleanup check
+	 * We will init the trash retention
+	 * We will init the trash purge check
+	 * We will init the cache ttl
+	 * We will init the cache ttl of the datastores
+	 * We will init the max no. of cache rows
+	 * We will init the admin users
+	 * We will init the sql dialects of the datastores
 	 */
 	//port
 	if len(os.Getenv("PORT")) != 0 {
@@ -161,6 +203,14 @@ func init() {
 		}
 	}
 
+	//stream timeout
+	if len(os.Getenv("STREAM_TIMEOUT")) != 0 {
+		//if successful convert timeout
+		if t, err := strconv.ParseInt(os.Getenv("STREAM_TIMEOUT"), 10, 64); err == nil && t > 0 {
+			StreamTimeout = time.Duration(t * int64(time.Second))
+		}
+	}
+
 	//max no. of requests
 	if len(os.Getenv("MAX_REQUESTS")) != 0 {
 		//if successful convert timeout
@@ -169,6 +219,30 @@ func init() {
 		}
 	}
 
+	//max no. of widget workers
+	if len(os.Getenv("MAX_WIDGET_WORKERS")) != 0 {
+		//if successful convert the no. of workers
+		if r, err := strconv.Atoi(os.Getenv("MAX_WIDGET_WORKERS")); err == nil && r > 0 {
+			MaxWidgetWorkers = r
+		}
+	}
+
+	//max no. of federated rows
+	if len(os.Getenv("MAX_FEDERATED_ROWS")) != 0 {
+		//if successful convert the no. of rows
+		if r, err := strconv.Atoi(os.Getenv("MAX_FEDERATED_ROWS")); err == nil && r > 0 {
+			MaxFederatedRows = r
+		}
+	}
+
+	//max no. of search rows
+	if len(os.Getenv("MAX_SEARCH_ROWS")) != 0 {
+		//if successful convert the no. of rows
+		if r, err := strconv.Atoi(os.Getenv("MAX_SEARCH_ROWS")); err == nil && r > 0 {
+			MaxSearchRows = r
+		}
+	}
+
 	//request cleanup check
 	if len(os.Getenv("REQUEST_CLEAN_UP_CHECK")) != 0 {
 		//if successful convert timeout
@@ -177,6 +251,78 @@ func init() {
 		}
 	}
 
+	//trash retention
+	if len(os.Getenv("TRASH_RETENTION")) != 0 {
+		//if successful convert retention
+		if t, err := strconv.ParseInt(os.Getenv("TRASH_RETENTION"), 10, 64); err == nil && t > 0 {
+			TrashRetention = time.Duration(t * int64(time.Hour))
+		}
+	}
+
+	//trash purge check
+	if len(os.Getenv("TRASH_PURGE_CHECK")) != 0 {
+		//if successful convert timeout
+		if t, err := strconv.ParseInt(os.Getenv("TRASH_PURGE_CHECK"), 10, 64); err == nil && t > 0 {
+			TrashPurgeCheck = time.Duration(t * int64(time.Minute))
+		}
+	}
+
+	//cache ttl
+	if len(os.Getenv("CACHE_TTL")) != 0 {
+		//if successful convert ttl
+		if t, err := strconv.ParseInt(os.Getenv("CACHE_TTL"), 10, 64); err == nil && t >= 0 {
+			CacheTTL = time.Duration(t * int64(time.Second))
+		}
+	}
+
+	//cache ttl of the datastores given as <datastore id>:<ttl>,<datastore id>:<ttl>
+	if len(os.Getenv("CACHE_DATASTORE_TTL")) != 0 {
+		for _, d := range strings.Split(os.Getenv("CACHE_DATASTORE_TTL"), ",") {
+			kv := strings.Split(strings.TrimSpace(d), ":")
+			if len(kv) != 2 {
+				continue
+			}
+			//if successful convert the datastore id and ttl
+			id, iErr := strconv.ParseUint(kv[0], 10, 64)
+			t, tErr := strconv.ParseInt(kv[1], 10, 64)
+			if iErr == nil && tErr == nil && t >= 0 {
+				CacheDatastoreTTL[uint(id)] = time.Duration(t * int64(time.Second))
+			}
+		}
+	}
+
+	//max no. of cache rows
+	if len(os.Getenv("CACHE_MAX_ROWS")) != 0 {
+		//if successful convert the no. of rows
+		if r, err := strconv.Atoi(os.Getenv("CACHE_MAX_ROWS")); err == nil && r >= 0 {
+			CacheMaxRows = r
+		}
+	}
+
+	//admin users given as <user id>,<user id>
+	if len(os.Getenv("ADMIN_USERS")) != 0 {
+		for _, u := range strings.Split(os.Getenv("ADMIN_USERS"), ",") {
+			//if successful convert the user id
+			if id, err := strconv.ParseUint(strings.TrimSpace(u), 10, 64); err == nil && id > 0 {
+				AdminUsers[uint(id)] = true
+			}
+		}
+	}
+
+	//sql dialects of the datastores given as <datastore id>:<dialect>,<datastore id>:<dialect>
+	if len(os.Getenv("DATASTORE_DIALECTS")) != 0 {
+		for _, d := range strings.Split(os.Getenv("DATASTORE_DIALECTS"), ",") {
+			kv := strings.Split(strings.TrimSpace(d), ":")
+			if len(kv) != 2 {
+				continue
+			}
+			//if successful convert the datastore id
+			if id, err := strconv.ParseUint(kv[0], 10, 64); err == nil {
+				DatastoreDialects[uint(id)] = strings.ToLower(strings.TrimSpace(kv[1]))
+			}
+		}
+	}
+
 	//discovery service url
 	if len(os.Getenv("DISCOVERY_URL")) != 0 {
 		DiscoveryURL = os.Getenv("DISCOVERY_URL")
@@ -127,6 +127,13 @@ func (a *AppContext) ConnectToDB() error {
 	return err
 }
 
+//AsUser returns a copy of the app context acting on behalf of the user with the given id.
+//It is used when the resources have to be accessed with their owner's access. Eg:- public dashboards
+func (a AppContext) AsUser(userID uint) *AppContext {
+	a.Session = authConfig.Session{ID: a.Session.ID, Authenticated: a.Session.Authenticated, User: &authConfig.User{ID: userID}}
+	return &a
+}
+
 //Logger returns the logger of the app context
 func (a AppContext) Logger() bLog.Log {
 	return a.Log
@@ -0,0 +1,241 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	toolkit "github.com/cuttle-ai/db-toolkit"
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus-service/datastores"
+)
+
+/*
+ * This file contains the cache of the query results from the datastores
+ */
+
+//CacheStatus has the details of the cache usage while executing a query
+type CacheStatus struct {
+	//Hit is true if the whole result was served from the cache
+	Hit bool
+	//CachedAt is the time at which the oldest result served from the cache was cached
+	CachedAt *time.Time `json:",omitempty"`
+	//ExpiresAt is the time at which the earliest expiring result served from the cache expires
+	ExpiresAt *time.Time `json:",omitempty"`
+}
+
+//ExecCache is the use of the result cache while executing a query
+type ExecCache struct {
+	//NoCache will execute the query in the datastores without looking up the cache. The fresh result is still cached
+	NoCache bool
+	//Status is the cache usage of the execution. It is filled during the execution
+	Status CacheStatus
+	//queries is the no. of datastore queries executed or served from the cache
+	queries int
+	//bypass will neither look up nor fill the cache. It is used for the results which are too large to be cached
+	bypass bool
+}
+
+//record records the usage of the cache by a datastore query
+func (e *ExecCache) record(hit bool, en *cacheEntry) {
+	e.queries++
+	if !hit {
+		e.Status = CacheStatus{}
+		return
+	}
+	if e.queries > 1 && !e.Status.Hit {
+		return
+	}
+	e.Status.Hit = true
+	if e.Status.CachedAt == nil || en.cachedAt.Before(*e.Status.CachedAt) {
+		c := en.cachedAt
+		e.Status.CachedAt = &c
+	}
+	if e.Status.ExpiresAt == nil || en.expiresAt.Before(*e.Status.ExpiresAt) {
+		x := en.expiresAt
+		e.Status.ExpiresAt = &x
+	}
+}
+
+//cacheEntry is a result cached in the result cache
+type cacheEntry struct {
+	key       string
+	rows      []map[string]interface{}
+	cachedAt  time.Time
+	expiresAt time.Time
+}
+
+//resultCache is the lru cache of the query results bounded by the total no. of rows cached
+type resultCache struct {
+	m       sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	rows    int
+}
+
+//cache is the result cache of the service
+var cache = &resultCache{entries: map[string]*list.Element{}, lru: list.New()}
+
+//get returns the unexpired entry with the given key and marks it as the recently used one
+func (r *resultCache) get(key string, now time.Time) (*cacheEntry, bool) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	el, ok := r.entries[key]
+	if !ok {
+		return nil, false
+	}
+	en := el.Value.(*cacheEntry)
+	if !now.Before(en.expiresAt) {
+		r.remove(el)
+		return nil, false
+	}
+	r.lru.MoveToFront(el)
+	return en, true
+}
+
+//put caches the entry evicting the least recently used entries till the rows fit in the cache.
+//Entries with more rows than the cache can hold are not cached
+func (r *resultCache) put(en *cacheEntry, maxRows int) {
+	r.m.Lock()
+	defer r.m.Unlock()
+	if el, ok := r.entries[en.key]; ok {
+		r.remove(el)
+	}
+	if len(en.rows) > maxRows {
+		return
+	}
+	for r.rows+len(en.rows) > maxRows {
+		r.remove(r.lru.Back())
+	}
+	r.entries[en.key] = r.lru.PushFront(en)
+	r.rows += len(en.rows)
+}
+
+//remove removes the element from the cache. The lock is expected to be held by the caller
+func (r *resultCache) remove(el *list.Element) {
+	en := el.Value.(*cacheEntry)
+	r.lru.Remove(el)
+	delete(r.entries, en.key)
+	r.rows -= len(en.rows)
+}
+
+//cacheTTL returns the time for which the results of the given datastore are cached
+func cacheTTL(datastoreID uint) time.Duration {
+	if t, ok := config.CacheDatastoreTTL[datastoreID]; ok {
+		return t
+	}
+	return config.CacheTTL
+}
+
+//cacheKey returns the key of the result of the sql query with the given arguments in the given datastore
+func cacheKey(datastoreID uint, query string, args []interface{}) string {
+	a, err := json.Marshal(args)
+	if err != nil {
+		a = []byte(fmt.Sprintf("%#v", args))
+	}
+	return strconv.FormatUint(uint64(datastoreID), 10) + "\n" + query + "\n" + string(a)
+}
+
+//contextExecer is implemented by the datastores which can cancel a running query when its context is done
+type contextExecer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error)
+}
+
+//execContext executes the sql query in the datastore till the context is done. If the datastore can't cancel the query
+//with the context, the query is left to complete in the background and the error of the context is returned
+func execContext(ctx context.Context, ser toolkit.Datastore, query string, args []interface{}) ([]map[string]interface{}, error) {
+	if ce, ok := ser.(contextExecer); ok {
+		return ce.ExecContext(ctx, query, args...)
+	}
+	type result struct {
+		rows []map[string]interface{}
+		err  error
+	}
+	res := make(chan result, 1)
+	go func() {
+		rows, err := ser.Exec(query, args...)
+		res <- result{rows, err}
+	}()
+	select {
+	case r := <-res:
+		return r.rows, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+//copyRows returns a copy of the rows so that the rows in the cache are not modified by the callers and vice versa.
+//Values of the rows are not copied as they are not modified in place
+func copyRows(rows []map[string]interface{}) []map[string]interface{} {
+	res := make([]map[string]interface{}, len(rows))
+	for i, r := range rows {
+		m := make(map[string]interface{}, len(r))
+		for k, v := range r {
+			m[k] = v
+		}
+		res[i] = m
+	}
+	return res
+}
+
+//execDatastore executes the sql query in the given datastore. Results are served from the cache if available unless
+//the cache is disabled for the datastore or the execution asks for a fresh result. The rows are copied to and from
+//the cache, so the rows returned can be modified
+func execDatastore(a config.AppContext, datastoreID uint, query string, args []interface{}, c *ExecCache) ([]map[string]interface{}, error) {
+	return execDatastoreContext(context.Background(), a, datastoreID, query, args, c)
+}
+
+//execDatastoreContext executes the sql query in the given datastore like execDatastore till the context is done
+func execDatastoreContext(ctx context.Context, a config.AppContext, datastoreID uint, query string, args []interface{}, c *ExecCache) ([]map[string]interface{}, error) {
+	/*
+	 * We will look up the cache
+	 * We will get the datastore service
+	 * We will execute the query in the datastore
+	 * Then we will cache the result
+	 */
+	//looking up the cache
+	if c == nil {
+		c = &ExecCache{}
+	}
+	ttl := cacheTTL(datastoreID)
+	useCache := !c.bypass && ttl > 0 && config.CacheMaxRows > 0
+	key := ""
+	if useCache {
+		key = cacheKey(datastoreID, query, args)
+	}
+	if useCache && !c.NoCache {
+		if en, ok := cache.get(key, time.Now()); ok {
+			c.record(true, en)
+			return copyRows(en.rows), nil
+		}
+	}
+
+	//getting the datastore service
+	ser, err := datastores.GetService(a, datastoreID)
+	if err != nil {
+		a.Log.Error("error while getting the datastore service", datastoreID)
+		return nil, err
+	}
+
+	//executing the query
+	rows, err := execContext(ctx, ser, query, args)
+	if err != nil {
+		return nil, err
+	}
+	c.record(false, nil)
+
+	//caching the result
+	if useCache {
+		n := time.Now()
+		cache.put(&cacheEntry{key: key, rows: copyRows(rows), cachedAt: n, expiresAt: n.Add(ttl)}, config.CacheMaxRows)
+	}
+	return rows, nil
+}
@@ -0,0 +1,198 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"container/list"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/cuttle-ai/octopus-service/config"
+)
+
+/*
+ * This file contains the tests of the query result cache
+ */
+
+//testRows returns the given no. of rows
+func testRows(n int) []map[string]interface{} {
+	rows := []map[string]interface{}{}
+	for i := 0; i < n; i++ {
+		rows = append(rows, map[string]interface{}{"n": i})
+	}
+	return rows
+}
+
+func TestResultCache(t *testing.T) {
+	now := time.Now()
+	entry := func(key string, rows int) *cacheEntry {
+		return &cacheEntry{key: key, rows: testRows(rows), cachedAt: now, expiresAt: now.Add(time.Minute)}
+	}
+	cases := []struct {
+		name string
+		//puts are the entries cached in the order
+		puts []*cacheEntry
+		//gets are the keys looked up after caching the entries except the last one
+		gets []string
+		//cached are the keys expected in the cache
+		cached []string
+		//rows is the no. of rows expected in the cache
+		rows int
+	}{
+		{
+			name:   "caches the entries fitting in the cache",
+			puts:   []*cacheEntry{entry("a", 2), entry("b", 3)},
+			cached: []string{"a", "b"},
+			rows:   5,
+		},
+		{
+			name:   "evicts the least recently cached entries",
+			puts:   []*cacheEntry{entry("a", 4), entry("b", 4), entry("c", 4)},
+			cached: []string{"b", "c"},
+			rows:   8,
+		},
+		{
+			name:   "evicts the least recently used entries",
+			puts:   []*cacheEntry{entry("a", 4), entry("b", 4), entry("c", 4)},
+			gets:   []string{"a"},
+			cached: []string{"a", "c"},
+			rows:   8,
+		},
+		{
+			name:   "doesn't cache the entries larger than the cache",
+			puts:   []*cacheEntry{entry("a", 2), entry("b", 11)},
+			cached: []string{"a"},
+			rows:   2,
+		},
+		{
+			name:   "replaces the entry with the same key",
+			puts:   []*cacheEntry{entry("a", 2), entry("a", 5)},
+			cached: []string{"a"},
+			rows:   5,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			r := &resultCache{entries: map[string]*list.Element{}, lru: list.New()}
+			for i, en := range c.puts {
+				if i == len(c.puts)-1 {
+					for _, k := range c.gets {
+						r.get(k, now)
+					}
+				}
+				r.put(en, 10)
+			}
+			for _, k := range c.cached {
+				if _, ok := r.get(k, now); !ok {
+					t.Errorf("expected %s to be cached", k)
+				}
+			}
+			if len(r.entries) != len(c.cached) || r.lru.Len() != len(c.cached) {
+				t.Errorf("expected %d entries in the cache, got %d", len(c.cached), len(r.entries))
+			}
+			if r.rows != c.rows {
+				t.Errorf("expected %d rows in the cache, got %d", c.rows, r.rows)
+			}
+		})
+	}
+}
+
+func TestResultCacheExpiry(t *testing.T) {
+	now := time.Now()
+	r := &resultCache{entries: map[string]*list.Element{}, lru: list.New()}
+	r.put(&cacheEntry{key: "a", rows: testRows(2), cachedAt: now, expiresAt: now.Add(time.Minute)}, 10)
+	if _, ok := r.get("a", now.Add(time.Second)); !ok {
+		t.Fatal("expected the entry to be cached before its expiry")
+	}
+	if _, ok := r.get("a", now.Add(time.Minute)); ok {
+		t.Fatal("expected the entry to expire")
+	}
+	if len(r.entries) != 0 || r.rows != 0 {
+		t.Errorf("expected the expired entry to be removed, got %d entries with %d rows", len(r.entries), r.rows)
+	}
+}
+
+func TestCacheKey(t *testing.T) {
+	key := cacheKey(1, "SELECT * FROM t WHERE a = $1", []interface{}{"x"})
+	cases := []struct {
+		name string
+		key  string
+		same bool
+	}{
+		{"same query", cacheKey(1, "SELECT * FROM t WHERE a = $1", []interface{}{"x"}), true},
+		{"another datastore", cacheKey(2, "SELECT * FROM t WHERE a = $1", []interface{}{"x"}), false},
+		{"another query", cacheKey(1, "SELECT * FROM u WHERE a = $1", []interface{}{"x"}), false},
+		{"another argument", cacheKey(1, "SELECT * FROM t WHERE a = $1", []interface{}{"y"}), false},
+		{"another type of argument", cacheKey(1, "SELECT * FROM t WHERE a = $1", []interface{}{1}), false},
+	}
+	for _, c := range cases {
+		if (c.key == key) != c.same {
+			t.Errorf("%s: expected the keys to be the same %v, got %q and %q", c.name, c.same, key, c.key)
+		}
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	defer func(ttl time.Duration, ttls map[uint]time.Duration) {
+		config.CacheTTL, config.CacheDatastoreTTL = ttl, ttls
+	}(config.CacheTTL, config.CacheDatastoreTTL)
+	config.CacheTTL = time.Minute
+	config.CacheDatastoreTTL = map[uint]time.Duration{2: 0, 3: time.Second}
+	for id, ttl := range map[uint]time.Duration{1: time.Minute, 2: 0, 3: time.Second} {
+		if got := cacheTTL(id); got != ttl {
+			t.Errorf("expected the ttl of the datastore %d to be %v, got %v", id, ttl, got)
+		}
+	}
+}
+
+func TestExecCacheRecord(t *testing.T) {
+	now := time.Now()
+	older := &cacheEntry{cachedAt: now.Add(-time.Minute), expiresAt: now.Add(time.Minute)}
+	newer := &cacheEntry{cachedAt: now, expiresAt: now.Add(2 * time.Minute)}
+	cases := []struct {
+		name string
+		hits []*cacheEntry
+		//hit is true if the whole result is expected to be served from the cache
+		hit bool
+	}{
+		{"all hits", []*cacheEntry{newer, older}, true},
+		{"miss after a hit", []*cacheEntry{older, nil}, false},
+		{"hit after a miss", []*cacheEntry{nil, older}, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			ec := &ExecCache{}
+			for _, en := range c.hits {
+				ec.record(en != nil, en)
+			}
+			if ec.Status.Hit != c.hit {
+				t.Fatalf("expected the hit to be %v, got %v", c.hit, ec.Status.Hit)
+			}
+			if !c.hit {
+				if ec.Status.CachedAt != nil || ec.Status.ExpiresAt != nil {
+					t.Errorf("expected no cache times for a miss, got %v", ec.Status)
+				}
+				return
+			}
+			if !ec.Status.CachedAt.Equal(older.cachedAt) || !ec.Status.ExpiresAt.Equal(older.expiresAt) {
+				t.Errorf("expected the oldest cached time and the earliest expiry, got %v and %v", ec.Status.CachedAt, ec.Status.ExpiresAt)
+			}
+		})
+	}
+}
+
+func TestCopyRows(t *testing.T) {
+	rows := testRows(2)
+	res := copyRows(rows)
+	if !reflect.DeepEqual(res, rows) {
+		t.Fatalf("expected the copy %v, got %v", rows, res)
+	}
+	res[0]["n"] = 10
+	res[1]["m"] = 1
+	if !reflect.DeepEqual(rows, testRows(2)) {
+		t.Errorf("expected the rows not to be modified through the copy, got %v", rows)
+	}
+}
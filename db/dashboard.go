@@ -30,10 +30,27 @@ type Dashboard struct {
 	HasPublicWidgets bool
 	//ShowNavigation indicates whether the navigation for the dashboard has to be made visible
 	ShowNavigation bool
+	//IsTemplate indicates that the tables in the widget queries of the dashboard are parameterized.
+	//Template dashboards are instantiated by duplicating them with the bindings for the parameters
+	IsTemplate bool
+	//Placement is the mode used for placing the new widgets in the dashboard pages
+	Placement PlacementMode
 	//DashboardPages has the list of pages in the dashboard
 	DashboardPages []DashboardPage
+	//Filters has the dashboard level filters applied to all the widgets
+	Filters []DashboardFilter
 }
 
+//PlacementMode is the strategy used for finding the free space for a widget in a dashboard page
+type PlacementMode uint
+
+const (
+	//PlacementFirstFit places the widget at the first free space found scanning from the top left of the page
+	PlacementFirstFit PlacementMode = 0
+	//PlacementBestFit places the widget at the free space where it fits the tightest with the existing items
+	PlacementBestFit PlacementMode = 1
+)
+
 //DashboardUserMappings has the mappings for the users and the permissions they have with the dashboard
 type DashboardUserMappings struct {
 	gorm.Model
@@ -77,6 +94,10 @@ const (
 	PageDefaultHeight = uint(100)
 	//PageDefaultGridSize is the default page grid size
 	PageDefaultGridSize = uint(10)
+	//PageMaxWidth is the maximum width of the page
+	PageMaxWidth = uint(1000)
+	//PageMaxHeight is the maximum height of the page
+	PageMaxHeight = uint(1000)
 )
 
 //PageGridItem is a grid item in the page layout. It will be linked to the underlying widget.
@@ -97,98 +118,517 @@ type PageGridItem struct {
 	Height uint
 }
 
-//AddWidget will add a widget to the dashboard
-func (d *Dashboard) AddWidget(ctx *config.AppContext, w Widget, width, height uint) error {
+//Create creates the dashboard along with its first page and records its first version
+func (d *Dashboard) Create(ctx *config.AppContext) error {
+	/*
+	 * We will start a transaction
+	 * We will create the dashboard
+	 * Then we will create the first page of the dashboard
+	 * Then we will record the first version of the dashboard
+	 */
+	//starting the transaction
+	tx := ctx.Db.Begin()
+
+	//creating the dashboard
+	d.ID = 0
+	d.DashboardPages = nil
+	d.Filters = nil
+	err := tx.Create(d).Error
+	if err != nil {
+		//error while creating the dashboard
+		tx.Rollback()
+		ctx.Log.Error("error while creating the dashboard", err)
+		return err
+	}
+
+	//creating the first page
+	page := &DashboardPage{
+		DashboardID: d.ID,
+		Name:        fmt.Sprintf("%s - %d", d.Name, 1),
+		Number:      1,
+		GridSize:    PageDefaultGridSize,
+		Width:       PageDefaultWidth,
+		Height:      PageDefaultHeight,
+	}
+	err = tx.Create(page).Error
+	if err != nil {
+		//error while creating the first page of the dashboard
+		tx.Rollback()
+		ctx.Log.Error("error while creating the first page of the dashboard", d.ID, err)
+		return err
+	}
+	d.DashboardPages = []DashboardPage{*page}
+	err = tx.Commit().Error
+	if err != nil {
+		return err
+	}
+
+	//recording the first version
+	recordChange(ctx, d.ID, d.UserID)
+	return nil
+}
+
+//GetDashboards returns the list of dashboards created by or shared with the given user. Pages of the dashboards won't be loaded
+func GetDashboards(ctx *config.AppContext, userID uint) ([]Dashboard, error) {
+	ds := []Dashboard{}
+	err := ctx.Db.Where("user_id = ? OR id IN ?", userID,
+		ctx.Db.Model(&DashboardUserMappings{}).Select("dashboard_id").Where("user_id = ?", userID).SubQuery()).
+		Order("updated_at DESC").Find(&ds).Error
+	return ds, err
+}
+
+//preloadLayout preloads the pages of the dashboard in order along with their page grid items and the filters of the dashboard
+func preloadLayout(db *gorm.DB) *gorm.DB {
+	return db.Preload("DashboardPages", func(db *gorm.DB) *gorm.DB {
+		return db.Order("number ASC")
+	}).
+		Preload("DashboardPages.PageGridItems").
+		Preload("Filters")
+}
+
+//Get fetches the dashboard with the given id along with its pages and page grid items if the given user can view it.
+//If the dashboard doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func (d *Dashboard) Get(ctx *config.AppContext, userID uint) error {
+	err := preloadLayout(ctx.Db).Where("id = ?", d.ID).First(d).Error
+	if err != nil {
+		return err
+	}
+	return d.CheckPermission(ctx, userID, PermissionView)
+}
+
+//Update updates the editable fields of the dashboard if the given user can edit it.
+//Making the dashboard public or private requires the manage permission.
+//If the dashboard doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func (d *Dashboard) Update(ctx *config.AppContext, userID uint) error {
 	/*
-	 * We will get the last page in the dashboard
+	 * We will check the permissions of the user
+	 * We will update the dashboard
+	 * Then we will record the change as a new version
+	 */
+	//checking the permissions
+	existing, err := CheckDashboardPermission(ctx, d.ID, userID, PermissionEdit)
+	if err != nil {
+		return err
+	}
+	if existing.IsPublic != d.IsPublic {
+		err = existing.CheckPermission(ctx, userID, PermissionManage)
+		if err != nil {
+			return err
+		}
+	}
+
+	//updating the dashboard
+	err = ctx.Db.Model(&Dashboard{}).Where("id = ?", d.ID).Updates(map[string]interface{}{
+		"name":            d.Name,
+		"description":     d.Description,
+		"is_public":       d.IsPublic,
+		"show_navigation": d.ShowNavigation,
+		"placement":       d.Placement,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	//recording the change
+	recordChange(ctx, d.ID, userID)
+	return nil
+}
+
+//Delete deletes the dashboard along with its pages, page grid items and filters. Only the owner can delete the dashboard.
+//Deleted dashboards stay in the trash till they are purged after the retention period.
+//If the dashboard doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func (d *Dashboard) Delete(ctx *config.AppContext, userID uint) error {
+	/*
+	 * We will check the permissions of the user
+	 * We will start a transaction
+	 * We will delete the dashboard
+	 * Then we will delete the page grid items of the dashboard pages
+	 * Then we will delete the pages
+	 * Then we will delete the filters
+	 */
+	//checking the permissions
+	_, err := CheckDashboardPermission(ctx, d.ID, userID, PermissionOwner)
+	if err != nil {
+		return err
+	}
+
+	//starting the transaction
+	tx := ctx.Db.Begin()
+
+	//deleting the dashboard
+	err = tx.Where("id = ?", d.ID).Delete(&Dashboard{}).Error
+	if err != nil {
+		//error while deleting the dashboard
+		tx.Rollback()
+		ctx.Log.Error("error while deleting the dashboard", d.ID, err)
+		return err
+	}
+
+	//deleting the page grid items
+	err = tx.Where("dashboard_page_id IN ?", tx.Model(&DashboardPage{}).Select("id").Where("dashboard_id = ?", d.ID).SubQuery()).
+		Delete(&PageGridItem{}).Error
+	if err != nil {
+		//error while deleting the page grid items
+		tx.Rollback()
+		ctx.Log.Error("error while deleting the page grid items of the dashboard", d.ID, err)
+		return err
+	}
+
+	//deleting the pages
+	err = tx.Where("dashboard_id = ?", d.ID).Delete(&DashboardPage{}).Error
+	if err != nil {
+		//error while deleting the pages
+		tx.Rollback()
+		ctx.Log.Error("error while deleting the pages of the dashboard", d.ID, err)
+		return err
+	}
+
+	//deleting the filters
+	err = tx.Where("dashboard_id = ?", d.ID).Delete(&DashboardFilter{}).Error
+	if err != nil {
+		//error while deleting the filters
+		tx.Rollback()
+		ctx.Log.Error("error while deleting the filters of the dashboard", d.ID, err)
+		return err
+	}
+
+	return tx.Commit().Error
+}
+
+//AddWidget will add a widget to the dashboard and record the change as a new version authored by the given user.
+//The pages of the dashboard are locked while the widget is placed so that concurrent additions can't overlap.
+//Permissions of the user have to be checked by the caller
+func (d *Dashboard) AddWidget(ctx *config.AppContext, userID uint, w Widget, width, height uint) (*PageGridItem, error) {
+	/*
+	 * We will start a transaction which is rolled back unless committed
+	 * We will lock the dashboard so that the pages can't be created or filled concurrently
+	 * We will get the last page in the dashboard along with its grid items with a lock
+	 * We will validate the size of the widget against the size of the page
 	 * We will try to add the widget inside the page grid
-	 * If not possible we will create a new page and add the widget to that
+	 * If not possible we will create a new page of the same size and add the widget to that
+	 * Then we will commit the transaction and record the change
 	 */
+	//starting the transaction
+	tx := ctx.Db.Begin()
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+
+	//locking the dashboard
+	err := tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", d.ID).First(&Dashboard{}).Error
+	if err != nil {
+		//error while locking the dashboard
+		ctx.Log.Error("error while locking the dashboard", d.ID, err)
+		return nil, err
+	}
+
 	//getting the last page in the dashboard
-	page, err := d.GetLastPage(ctx)
+	page, err := d.lockLastPage(tx)
+	if gorm.IsRecordNotFoundError(err) {
+		//dashboard doesn't have any pages yet. So we will create the first one
+		page, err = d.createPage(tx, 1, PageDefaultGridSize, PageDefaultWidth, PageDefaultHeight)
+	}
 	if err != nil {
 		//error while getting the last page of the dashboard
-		ctx.Log.Error("error while getting the last page of the dashboard", d.ID)
-		return err
+		ctx.Log.Error("error while getting the last page of the dashboard", d.ID, err)
+		return nil, err
+	}
+
+	//validating the size of the widget
+	if width == 0 || height == 0 || width > page.Width || height > page.Height {
+		ctx.Log.Error("invalid size for the widget", width, height, "in the page", page.ID)
+		return nil, fmt.Errorf("widget size %dx%d can't be fit in a page of size %dx%d", width, height, page.Width, page.Height)
 	}
 
 	//will try to add widget inside the page grid
-	ok, err := page.AddWidget(ctx, w, width, height)
+	item, err := page.addWidget(tx, w, width, height, d.Placement)
 	if err != nil {
 		//error while addding a widget to the page
-		ctx.Log.Error("error while adding the widget to the page", page.ID)
-		return err
+		ctx.Log.Error("error while adding the widget to the page", page.ID, err)
+		return nil, err
 	}
 
-	if ok {
-		ctx.Log.Info("added the widget", w.ID, "to the dashboard", d.ID)
-		return nil
+	if item == nil {
+		ctx.Log.Info("couldn't add the widget to the page. So creating a page and adding the widget to that for dashboard", d.ID)
+		//will create a page if not able to add widget to the page
+		page, err = d.createPage(tx, page.Number+1, page.GridSize, page.Width, page.Height)
+		if err != nil {
+			//error while creating a page
+			ctx.Log.Error("error while creating a page for the dashboard", d.ID, err)
+			return nil, err
+		}
+		//and add the widget to the page
+		item, err = page.addWidget(tx, w, width, height, d.Placement)
+		if err != nil {
+			//error while addding a widget to the page
+			ctx.Log.Error("error while adding the widget to the newly created page", page.ID, err)
+			return nil, err
+		}
+		if item == nil {
+			//widget couldn't be fit even in an empty page
+			ctx.Log.Error("couldn't fit the widget in the newly created page", page.ID)
+			return nil, fmt.Errorf("widget size %dx%d can't be fit in the page %d", width, height, page.ID)
+		}
 	}
 
-	ctx.Log.Info("couldn't add the widget to the page. So creating a page and adding the widget to that for dashboard", d.ID)
-	//will create a page if not able to add widget to the page
-	page, err = d.CreatePage(ctx, page.Number+1)
+	//committing the transaction
+	err = tx.Commit().Error
 	if err != nil {
-		//error while creating a page
-		ctx.Log.Error("error while creating a page for the dashboard", d.ID)
-		return err
+		ctx.Log.Error("error while committing the widget added to the dashboard", d.ID, err)
+		return nil, err
 	}
-	//and add the widget to the page
-	ok, err = page.AddWidget(ctx, w, width, height)
+	committed = true
+
+	//recording the change
+	ctx.Log.Info("added the widget", w.ID, "to the dashboard", d.ID)
+	recordChange(ctx, d.ID, userID)
+	return item, d.markPublicWidget(ctx, w)
+}
+
+//markPublicWidget will mark that the dashboard has public widgets if the given widget is public
+func (d *Dashboard) markPublicWidget(ctx *config.AppContext, w Widget) error {
+	if !w.IsPublic || d.HasPublicWidgets {
+		return nil
+	}
+	err := ctx.Db.Model(&Dashboard{}).Where("id = ?", d.ID).UpdateColumn("has_public_widgets", true).Error
 	if err != nil {
-		//error while addding a widget to the page
-		ctx.Log.Error("error while adding the widget to the newly created page", page.ID)
+		//error while marking the dashboard as having public widgets
+		ctx.Log.Error("error while marking the dashboard as having public widgets", d.ID, err)
 		return err
 	}
+	d.HasPublicWidgets = true
 	return nil
 }
 
-//GetLastPage returns the last page in the dashboard
+//hasPublicWidgetsSQL checks whether any of the widgets in the pages of a dashboard is public
+const hasPublicWidgetsSQL = `EXISTS (SELECT 1 FROM page_grid_items
+	JOIN dashboard_pages ON dashboard_pages.id = page_grid_items.dashboard_page_id
+	JOIN widgets ON widgets.id = page_grid_items.widget_id
+	WHERE dashboard_pages.dashboard_id = dashboards.id AND widgets.is_public AND page_grid_items.deleted_at IS NULL
+	AND dashboard_pages.deleted_at IS NULL AND widgets.deleted_at IS NULL)`
+
+//syncPublicWidgets marks the dashboards matching the given condition as having public widgets if any of their widgets is public
+func syncPublicWidgets(db *gorm.DB, where string, args ...interface{}) error {
+	return db.Model(&Dashboard{}).Where(where, args...).UpdateColumn("has_public_widgets", gorm.Expr(hasPublicWidgetsSQL)).Error
+}
+
+//Refresh fetches the dashboard along with its pages and executes the queries of all its widgets concurrently
+//with the dashboard filters applied. If noCache is true, the queries are executed without looking up the result cache.
+//The user should have the permission to view the dashboard.
+//If the dashboard doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func (d *Dashboard) Refresh(ctx *config.AppContext, userID uint, noCache bool) ([]WidgetResult, error) {
+	/*
+	 * We will get the dashboard along with its pages
+	 * We will get the widgets of the dashboard
+	 * Then we will execute the widgets with the dashboard filters applied
+	 */
+	//getting the dashboard
+	err := d.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	//getting the widgets
+	ws, err := d.GetWidgets(ctx)
+	if err != nil {
+		ctx.Log.Error("error while getting the widgets of the dashboard", d.ID, err)
+		return nil, err
+	}
+
+	//executing the widgets with the dashboard filters applied
+	return RefreshWidgets(ctx, d.ApplyFilters(ws), noCache), nil
+}
+
+//GetPublicDashboard returns the dashboard with the given id along with its pages and page grid items if it is public.
+//If the dashboard doesn't exist or isn't public gorm.ErrRecordNotFound is returned
+func GetPublicDashboard(ctx *config.AppContext, id uint) (*Dashboard, error) {
+	d := &Dashboard{}
+	err := preloadLayout(ctx.Db).Where("id = ? AND is_public = ?", id, true).First(d).Error
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+//GetWidgets returns the widgets in the page grid items of the dashboard. Pages of the dashboard should have been loaded before
+func (d *Dashboard) GetWidgets(ctx *config.AppContext) ([]Widget, error) {
+	ids := []uint{}
+	for _, p := range d.DashboardPages {
+		for _, item := range p.PageGridItems {
+			ids = append(ids, item.WidgetID)
+		}
+	}
+	ws := []Widget{}
+	if len(ids) == 0 {
+		return ws, nil
+	}
+	err := ctx.Db.Where("id IN (?)", ids).Find(&ws).Error
+	return ws, err
+}
+
+//GetLastPage returns the last page in the dashboard along with its page grid items
 func (d *Dashboard) GetLastPage(ctx *config.AppContext) (*DashboardPage, error) {
 	dp := &DashboardPage{}
-	err := ctx.Db.Where("dashboard_id = ?", d.ID).Order("number DESC").First(dp).Error
+	err := ctx.Db.Where("dashboard_id = ?", d.ID).Order("number DESC").Preload("PageGridItems").First(dp).Error
 	if err != nil {
 		return nil, err
 	}
 	return dp, nil
 }
 
-//CreatePage creates a new page for the given dashboard with the given page number
+//lockLastPage returns the last page in the dashboard along with its page grid items locked for the update in the given transaction
+func (d *Dashboard) lockLastPage(tx *gorm.DB) (*DashboardPage, error) {
+	dp := &DashboardPage{}
+	err := tx.Set("gorm:query_option", "FOR UPDATE").Where("dashboard_id = ?", d.ID).Order("number DESC").First(dp).Error
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Set("gorm:query_option", "FOR UPDATE").Where("dashboard_page_id = ?", dp.ID).Find(&dp.PageGridItems).Error
+	if err != nil {
+		return nil, err
+	}
+	return dp, nil
+}
+
+//CreatePage creates a new page of the default size for the given dashboard with the given page number
 func (d *Dashboard) CreatePage(ctx *config.AppContext, pageNumber uint) (*DashboardPage, error) {
+	return d.createPage(ctx.Db, pageNumber, PageDefaultGridSize, PageDefaultWidth, PageDefaultHeight)
+}
+
+//createPage creates a new page of the given size for the given dashboard with the given page number using the given db connection
+func (d *Dashboard) createPage(db *gorm.DB, pageNumber, gridSize, width, height uint) (*DashboardPage, error) {
 	newPage := &DashboardPage{
 		DashboardID:    d.ID,
 		Name:           fmt.Sprintf("%s - %d", d.Name, pageNumber),
 		Number:         pageNumber,
-		GridSize:       PageDefaultGridSize,
-		Width:          PageDefaultWidth,
-		Height:         PageDefaultHeight,
+		GridSize:       gridSize,
+		Width:          width,
+		Height:         height,
 		HasWidgetAdded: true,
 	}
-	err := ctx.Db.Create(newPage).Error
+	err := db.Create(newPage).Error
 	if err != nil {
 		return nil, err
 	}
 	return newPage, nil
 }
 
-//AddWidget will try to add a widget to the dashboard page. If succeeds will return true. Else false.
-func (dp *DashboardPage) AddWidget(ctx *config.AppContext, w Widget, width, height uint) (bool, error) {
+//AddWidget will try to add a widget to the dashboard page at the free space found as per the given placement mode.
+//If succeeds will return the page grid item created. Else nil.
+func (dp *DashboardPage) AddWidget(ctx *config.AppContext, w Widget, width, height uint, mode PlacementMode) (*PageGridItem, error) {
+	return dp.addWidget(ctx.Db, w, width, height, mode)
+}
+
+//addWidget adds the widget to the dashboard page using the given db connection. Page grid items of the page should have been loaded before
+func (dp *DashboardPage) addWidget(db *gorm.DB, w Widget, width, height uint, mode PlacementMode) (*PageGridItem, error) {
+	/*
+	 * We will find the free space in the page
+	 * If found we will create the page grid item at that position
+	 */
+	//finding the free space
+	x, y, ok := dp.FindFreeSpace(width, height, mode)
+	if !ok {
+		return nil, nil
+	}
+
+	//creating the page grid item
 	pageGrid := &PageGridItem{
 		DashboardPageID: dp.ID,
 		WidgetID:        w.ID,
-		X:               0,
-		Y:               0,
+		X:               x,
+		Y:               y,
 		Width:           width,
 		Height:          height,
 	}
-	if len(dp.PageGridItems) == 0 {
-		err := ctx.Db.Create(pageGrid).Error
-		if err == nil {
-			dp.PageGridItems = append(dp.PageGridItems, *pageGrid)
+	err := db.Create(pageGrid).Error
+	if err != nil {
+		return nil, err
+	}
+	dp.PageGridItems = append(dp.PageGridItems, *pageGrid)
+	return pageGrid, nil
+}
+
+//FindFreeSpace finds a free rectangle of the given size in the page as per the placement mode.
+//It returns the top left position of the rectangle and true if found. Else false.
+func (dp *DashboardPage) FindFreeSpace(width, height uint, mode PlacementMode) (uint, uint, bool) {
+	/*
+	 * We will get the page layout
+	 * We will scan the positions from top left row by row
+	 * If the rectangle at the position is free, for first fit we return the position
+	 * For best fit we will score the position and keep the one with the best score
+	 */
+	//getting the page layout
+	grid := dp.GetPageLayout()
+	if width == 0 || height == 0 || height > uint(len(grid)) || width > uint(len(grid[0])) {
+		return 0, 0, false
+	}
+
+	//scanning the positions
+	found := false
+	bestX, bestY, bestScore := uint(0), uint(0), -1
+	for y := uint(0); y+height <= uint(len(grid)); y++ {
+		for x := uint(0); x+width <= uint(len(grid[0])); x++ {
+			if !isFree(grid, x, y, width, height) {
+				continue
+			}
+			if mode != PlacementBestFit {
+				return x, y, true
+			}
+			if score := contactScore(grid, x, y, width, height); score > bestScore {
+				found = true
+				bestX, bestY, bestScore = x, y, score
+			}
+		}
+	}
+	return bestX, bestY, found
+}
+
+//isFree checks whether the rectangle at the given position in the grid is unoccupied
+func isFree(grid [][]bool, x, y, width, height uint) bool {
+	for i := y; i < y+height; i++ {
+		for j := x; j < x+width; j++ {
+			if grid[i][j] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+//contactScore returns the no. of cells along the perimeter of the rectangle at the given position
+//that touch either an occupied cell or the border of the grid. Higher the score tighter the fit.
+func contactScore(grid [][]bool, x, y, width, height uint) int {
+	occupied := func(i, j int) bool {
+		if i < 0 || j < 0 || i >= len(grid) || j >= len(grid[0]) {
+			return true
+		}
+		return grid[i][j]
+	}
+	score := 0
+	for j := int(x); j < int(x+width); j++ {
+		if occupied(int(y)-1, j) {
+			score++
+		}
+		if occupied(int(y+height), j) {
+			score++
+		}
+	}
+	for i := int(y); i < int(y+height); i++ {
+		if occupied(i, int(x)-1) {
+			score++
+		}
+		if occupied(i, int(x+width)) {
+			score++
 		}
-		return err == nil, err
 	}
-	return false, nil
+	return score
 }
 
 //GetPageLayout will return the page layout filled with the occupied positions as true
@@ -213,11 +653,11 @@ func (dp *DashboardPage) GetPageLayout() [][]bool {
 
 	//setting the cells in the grid as true where the grid items exist
 	for _, v := range dp.PageGridItems {
-		if v.Y < 0 || v.X < 0 || v.Y >= uint(len(grid)) || v.X >= uint(len(grid[0])) {
+		if v.Y >= uint(len(grid)) || v.X >= uint(len(grid[0])) {
 			continue
 		}
-		for i := v.Y; i < v.Y+v.Height; i++ {
-			for j := v.X; j < v.X+v.Width; j++ {
+		for i := v.Y; i < v.Y+v.Height && i < uint(len(grid)); i++ {
+			for j := v.X; j < v.X+v.Width && j < uint(len(grid[0])); j++ {
 				grid[i][j] = true
 			}
 		}
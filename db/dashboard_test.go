@@ -0,0 +1,108 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"testing"
+)
+
+/*
+ * This file contains the tests of the placement of the widgets in the dashboard pages
+ */
+
+func TestFindFreeSpace(t *testing.T) {
+	cases := []struct {
+		name          string
+		items         []PageGridItem
+		width, height uint
+		mode          PlacementMode
+		x, y          uint
+		ok            bool
+	}{
+		{
+			name:  "first fit places the widget at the top left of an empty page",
+			width: 3, height: 2,
+			mode: PlacementFirstFit,
+			ok:   true,
+		},
+		{
+			name:  "first fit places the widget at the first free space scanning row by row",
+			items: []PageGridItem{{X: 0, Y: 0, Width: 4, Height: 2}},
+			width: 4, height: 2,
+			mode: PlacementFirstFit,
+			x:    4, ok: true,
+		},
+		{
+			name:  "first fit skips the spaces too small for the widget",
+			items: []PageGridItem{{X: 0, Y: 0, Width: 4, Height: 2}, {X: 7, Y: 0, Width: 3, Height: 2}},
+			width: 4, height: 2,
+			mode: PlacementFirstFit,
+			y:    2, ok: true,
+		},
+		{
+			name:  "best fit places the widget in the gap it fills the tightest",
+			items: []PageGridItem{{X: 0, Y: 0, Width: 3, Height: 3}, {X: 5, Y: 0, Width: 5, Height: 3}},
+			width: 2, height: 3,
+			mode: PlacementBestFit,
+			x:    3, ok: true,
+		},
+		{
+			name:  "best fit prefers the corners of an empty page",
+			width: 10, height: 4,
+			mode: PlacementBestFit,
+			ok:   true,
+		},
+		{
+			name:  "fails if the page is full",
+			items: []PageGridItem{{X: 0, Y: 0, Width: 10, Height: 10}},
+			width: 1, height: 1,
+			mode: PlacementFirstFit,
+		},
+		{
+			name:  "fails if the widget is larger than the page",
+			width: 11, height: 1,
+			mode: PlacementBestFit,
+		},
+		{
+			name:  "fails for the widgets without a size",
+			width: 0, height: 1,
+			mode: PlacementFirstFit,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dp := &DashboardPage{Width: 10, Height: 10, PageGridItems: c.items}
+			x, y, ok := dp.FindFreeSpace(c.width, c.height, c.mode)
+			if ok != c.ok {
+				t.Fatalf("expected the free space to be found %v, got %v", c.ok, ok)
+			}
+			if ok && (x != c.x || y != c.y) {
+				t.Errorf("expected the widget at (%d, %d), got (%d, %d)", c.x, c.y, x, y)
+			}
+		})
+	}
+}
+
+func TestContactScore(t *testing.T) {
+	dp := &DashboardPage{Width: 6, Height: 6, PageGridItems: []PageGridItem{{X: 0, Y: 0, Width: 2, Height: 2}}}
+	grid := dp.GetPageLayout()
+	cases := []struct {
+		name          string
+		x, y          uint
+		width, height uint
+		score         int
+	}{
+		{"doesn't touch anything in the middle of the page", 3, 3, 2, 2, 0},
+		{"touches the border of the page", 4, 4, 2, 2, 4},
+		{"touches an item on the left and the border on the top", 2, 0, 2, 2, 4},
+		{"touches an item on the top and the border on the left", 0, 2, 2, 1, 3},
+		{"fills the whole page", 0, 0, 6, 6, 24},
+	}
+	for _, c := range cases {
+		if score := contactScore(grid, c.x, c.y, c.width, c.height); score != c.score {
+			t.Errorf("%s: expected the score %d, got %d", c.name, c.score, score)
+		}
+	}
+}
@@ -7,65 +7,162 @@ package db
 
 import (
 	"errors"
+	"sort"
+	"strings"
 
 	"github.com/cuttle-ai/octopus-service/config"
-	"github.com/cuttle-ai/octopus-service/datastores"
 	"github.com/cuttle-ai/octopus/interpreter"
 )
 
+//ErrNoTable is returned when the query doesn't have any table to be queried from
+var ErrNoTable = errors.New("Couldn't find the table to be queried from")
+
+//AmbiguousTableError is returned when the query to be executed in single table mode has more than one table
+type AmbiguousTableError struct {
+	//Tables are the names of the tables in the query
+	Tables []string
+}
+
+func (a AmbiguousTableError) Error() string {
+	return "query is ambiguous between the tables " + strings.Join(a.Tables, ", ")
+}
+
+//ResolvedTable is the table chosen for executing the query in single table mode
+type ResolvedTable struct {
+	//UID of the table
+	UID string
+	//Name of the table
+	Name string
+	//DatastoreID is the id of the datastore in which the table exists
+	DatastoreID uint
+}
+
+//ResolveTable returns the table to be queried from in single table mode. If the query has no tables ErrNoTable is returned.
+//If the query has more than one table AmbiguousTableError is returned with the tables in the order of their uids
+func ResolveTable(q interpreter.Query) (*ResolvedTable, error) {
+	if len(q.Tables) == 0 {
+		return nil, ErrNoTable
+	}
+	if len(q.Tables) > 1 {
+		ts := []interpreter.TableNode{}
+		for _, t := range q.Tables {
+			ts = append(ts, t)
+		}
+		sort.Slice(ts, func(i, j int) bool { return ts[i].UID < ts[j].UID })
+		names := []string{}
+		for _, t := range ts {
+			names = append(names, t.Name)
+		}
+		return nil, AmbiguousTableError{Tables: names}
+	}
+	for _, t := range q.Tables {
+		return &ResolvedTable{UID: t.UID, Name: t.Name, DatastoreID: t.DatastoreID}, nil
+	}
+	return nil, ErrNoTable
+}
+
+//spansDatastores checks whether the tables of the query are in more than one datastore
+func spansDatastores(q interpreter.Query) bool {
+	for _, t := range q.Tables {
+		for _, o := range q.Tables {
+			if t.DatastoreID != o.DatastoreID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//ResultColumns returns the names of the columns in the result rows of the query in the order of its select list.
+//For the queries spanning multiple tables, the columns are aliased by the service as the column name prefixed
+//with <table>_ if the name is already taken by another selected column. The queries on a single table are generated
+//by the interpreter and their columns are expected to be named as the column. It isn't guaranteed for the aggregated columns,
+//so the names should be reconciled with the result rows using ReconcileColumns
+func ResultColumns(q interpreter.Query) []string {
+	if len(q.Tables) > 1 {
+		tables := map[string]interpreter.TableNode{}
+		for _, t := range q.Tables {
+			tables[t.UID] = t
+		}
+		return selectAliases(tables, q.Select, false)
+	}
+	cols := []string{}
+	for _, c := range q.Select {
+		cols = append(cols, c.Name)
+	}
+	return cols
+}
+
 //Exec will execute a query and return the result
 func Exec(a config.AppContext, q interpreter.Query) ([]map[string]interface{}, error) {
+	return ExecWithCache(a, q, nil)
+}
+
+//ExecWithCache will execute a query using the result cache and return the result. The cache usage is reported in
+//the given cache
+func ExecWithCache(a config.AppContext, q interpreter.Query, ec *ExecCache) ([]map[string]interface{}, error) {
 	/*
-	 * Based on the number of tables avaiable in the query, we will execute the same
+	 * Based on the number of tables avaiable in the query, we will execute the same.
+	 * Multiple tables are joined in the datastore if all of them are in the same datastore.
+	 * Else they are queried from their datastores and joined in memory
 	 */
 
 	if len(q.Tables) == 0 {
-		return nil, errors.New("Couldn't find the table to be queried from")
+		return nil, ErrNoTable
 	}
 
 	if len(q.Tables) == 1 {
-		return SingleTableMode(a, q)
+		return singleTableMode(a, q, ec)
 	}
 
-	return nil, errors.New("multiple table join query not supported yet")
+	if spansDatastores(q) {
+		return federatedMode(a, q, ec)
+	}
+	return joinMode(a, q, ec)
 }
 
-//SingleTableMode execute the given query in a single table mode. So the query is expected not to have any joins or so
+//SingleTableMode execute the given query in a single table mode. So the query is expected not to have any joins or so.
+//If the query doesn't have exactly one table ErrNoTable or AmbiguousTableError is returned
 func SingleTableMode(a config.AppContext, q interpreter.Query) ([]map[string]interface{}, error) {
+	return singleTableMode(a, q, nil)
+}
+
+//singleTableMode execute the given query in a single table mode using the given result cache
+func singleTableMode(a config.AppContext, q interpreter.Query, ec *ExecCache) ([]map[string]interface{}, error) {
 	/*
-	 * We will convert the query into sql
-	 * Then we will get the table from which query has to happen
-	 * Then we will get the service corresponding to the table
-	 * Will connect to it
-	 * Then will execute the query
+	 * We will get the sql query and the datastore of the table
+	 * Then will execute the query in the datastore
 	 */
-
-	//convert the query
-	qs, err := q.ToSQL()
+	//getting the sql query
+	qs, datastoreID, err := singleTableSQL(a, q)
 	if err != nil {
-		//error while converting the interpreter query to sql
-		a.Log.Error("error while converting the interpreter query to sql")
 		return nil, err
 	}
 
-	//getting the table
-	var t *interpreter.TableNode
-	for _, v := range q.Tables {
-		t = &v
-	}
-	if t == nil {
-		//couldn't find the table
-		return nil, errors.New("couldn't find the table in single query mode")
-	}
+	//execute the query
+	return execDatastore(a, datastoreID, qs.Query, qs.Args, ec)
+}
 
-	//getting the datastore service
-	ser, err := datastores.GetService(a, t.DatastoreID)
+//singleTableSQL returns the sql query for the given query in single table mode along with the datastore of the table
+func singleTableSQL(a config.AppContext, q interpreter.Query) (*interpreter.SQLQuery, uint, error) {
+	/*
+	 * We will resolve the table from which query has to happen
+	 * Then we will convert the query into sql
+	 */
+	//resolving the table
+	t, err := ResolveTable(q)
 	if err != nil {
-		//error while getting the datastore service
-		a.Log.Error("error while getting the datastore service")
-		return nil, err
+		a.Log.Error("couldn't resolve the table in single query mode", err)
+		return nil, 0, err
 	}
+	a.Log.Info("executing the query on the table", t.Name, "in the datastore", t.DatastoreID)
 
-	//execute the query
-	return ser.Exec(qs.Query, qs.Args...)
+	//convert the query
+	qs, err := q.ToSQL()
+	if err != nil {
+		//error while converting the interpreter query to sql
+		a.Log.Error("error while converting the interpreter query to sql")
+		return nil, 0, err
+	}
+	return qs, t.DatastoreID, nil
 }
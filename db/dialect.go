@@ -0,0 +1,69 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/cuttle-ai/octopus-service/config"
+)
+
+/*
+ * This file contains the sql dialects of the datastores used for generating the queries executed in them
+ */
+
+//UnknownDialectError is returned when the dialect configured for a datastore is not supported
+type UnknownDialectError struct {
+	//Dialect configured for the datastore
+	Dialect string
+}
+
+func (u UnknownDialectError) Error() string {
+	return "sql dialect " + u.Dialect + " is not supported"
+}
+
+//dialect is the sql dialect of a datastore. All the supported dialects paginate with LIMIT and OFFSET
+type dialect struct {
+	//openQuote and closeQuote enclose the identifiers
+	openQuote, closeQuote string
+	//numbered is true if the placeholders are numbered as $1, $2 and so on. Else they are ?
+	numbered bool
+	//interpreted is true if the queries generated by the interpreter are in the dialect
+	interpreted bool
+}
+
+//dialects are the supported sql dialects with their name as the key
+var dialects = map[string]dialect{
+	"postgres": {openQuote: `"`, closeQuote: `"`, numbered: true, interpreted: true},
+	"mysql":    {openQuote: "`", closeQuote: "`"},
+	"sqlite":   {openQuote: `"`, closeQuote: `"`},
+}
+
+//datastoreDialect returns the dialect of the given datastore. Datastores without a dialect configured are postgres
+func datastoreDialect(datastoreID uint) (dialect, error) {
+	name, ok := config.DatastoreDialects[datastoreID]
+	if !ok {
+		name = "postgres"
+	}
+	d, ok := dialects[name]
+	if !ok {
+		return d, UnknownDialectError{Dialect: name}
+	}
+	return d, nil
+}
+
+//quote quotes the given identifier for using it in the sql query
+func (d dialect) quote(id string) string {
+	return d.openQuote + strings.Replace(id, d.closeQuote, d.closeQuote+d.closeQuote, -1) + d.closeQuote
+}
+
+//placeholder returns the placeholder of the nth argument of the query starting from 1
+func (d dialect) placeholder(n int) string {
+	if d.numbered {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
@@ -0,0 +1,364 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"fmt"
+
+	"github.com/cuttle-ai/brain/visualization"
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus/interpreter"
+)
+
+/*
+ * This file contains the export and import of the dashboards as portable json documents
+ */
+
+//ExportVersion is the current version of the dashboard export document schema
+const ExportVersion = 1
+
+const (
+	//ExportMaxPages is the maximum no. of pages in a dashboard export document
+	ExportMaxPages = 100
+	//ExportMaxPageItems is the maximum no. of grid items in a page of a dashboard export document
+	ExportMaxPageItems = 500
+	//ExportMaxWidgets is the maximum no. of widgets in a dashboard export document
+	ExportMaxWidgets = 1000
+)
+
+//DashboardExport is the portable document of a dashboard along with its pages, grid items and widget definitions
+type DashboardExport struct {
+	//Version is the version of the document schema
+	Version int `json:"version"`
+	//Name of the dashboard
+	Name string `json:"name"`
+	//Description of the dashboard
+	Description string `json:"description"`
+	//ShowNavigation indicates whether the navigation for the dashboard has to be made visible
+	ShowNavigation bool `json:"showNavigation"`
+	//Placement is the mode used for placing the new widgets in the dashboard pages
+	Placement PlacementMode `json:"placement"`
+	//IsTemplate indicates that the tables in the widget queries of the dashboard are parameterized
+	IsTemplate bool `json:"isTemplate"`
+	//Pages has the pages of the dashboard
+	Pages []PageExport `json:"pages"`
+	//Widgets has the widget definitions of the dashboard
+	Widgets []WidgetExport `json:"widgets"`
+	//Filters has the dashboard level filters. It is nil in the documents exported before the filters were added
+	Filters []FilterExport `json:"filters"`
+}
+
+//PageExport is a page in the dashboard export document
+type PageExport struct {
+	//Name is the name of the dashboard page
+	Name string `json:"name"`
+	//Number is the page number in the dashboard
+	Number uint `json:"number"`
+	//GridSize is the size of the each grid uint
+	GridSize uint `json:"gridSize"`
+	//Width is the width of the page grid
+	Width uint `json:"width"`
+	//Height is the height of the page grid
+	Height uint `json:"height"`
+	//Items has the grid items in the page
+	Items []GridItemExport `json:"items"`
+}
+
+//GridItemExport is a grid item in the dashboard export document
+type GridItemExport struct {
+	//Widget is the index of the widget in the widgets of the document
+	Widget int `json:"widget"`
+	//X is the x position of the grid item in the grid (in grid units)
+	X uint `json:"x"`
+	//Y is the y position of the grid item in the grid (in grid units)
+	Y uint `json:"y"`
+	//Width is the width of the grid item in the grid (in grid units)
+	Width uint `json:"width"`
+	//Height is the height of the grid item in the grid (in grid units)
+	Height uint `json:"height"`
+}
+
+//WidgetExport is a widget definition in the dashboard export document
+type WidgetExport struct {
+	//ID of the widget in the exported dashboard. It is used for restoring the versions of the dashboard and ignored while importing
+	ID uint `json:"id,omitempty"`
+	//Title of the widget
+	Title string `json:"title"`
+	//NL is the natural language query of the widget. Widgets are re-interpreted from it while importing
+	NL string `json:"nl"`
+	//Query is the interpreted query of the widget. It is ignored while importing
+	Query interpreter.Query `json:"query"`
+	//Visualization is the visualization chosen for the widget
+	Visualization visualization.Visualization `json:"visualization"`
+	//RefreshInterval is the interval in seconds after which the widget data has to be refreshed
+	RefreshInterval uint `json:"refreshInterval"`
+}
+
+//FilterExport is a dashboard level filter in the dashboard export document
+type FilterExport struct {
+	//TableUID is the uid of the table having the column to be filtered
+	TableUID string `json:"tableUid,omitempty"`
+	//Column is the name of the column to be filtered
+	Column string `json:"column"`
+	//Operation is the filter operation
+	Operation string `json:"operation"`
+	//Value is the value to be used for filtering
+	Value string `json:"value"`
+}
+
+//NLInterpreter interprets the natural language query of a widget for the user importing the dashboard
+type NLInterpreter func(nl string) (*interpreter.Query, error)
+
+//InvalidExportError is returned when the dashboard export document fails the validation
+type InvalidExportError struct {
+	//Reason why the document is invalid
+	Reason string
+}
+
+func (i InvalidExportError) Error() string {
+	return "invalid dashboard export document: " + i.Reason
+}
+
+//Export returns the portable export document of the dashboard. The user should have the permission to view the dashboard.
+//If the dashboard doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func (d *Dashboard) Export(ctx *config.AppContext, userID uint) (*DashboardExport, error) {
+	/*
+	 * We will get the dashboard along with its pages
+	 * Then we will build the document
+	 */
+	//getting the dashboard
+	err := d.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	//building the document
+	return d.document(ctx)
+}
+
+//document builds the export document of the dashboard. Pages of the dashboard should have been loaded before
+func (d *Dashboard) document(ctx *config.AppContext) (*DashboardExport, error) {
+	/*
+	 * We will get the widgets of the dashboard
+	 * Then we will build the document
+	 */
+	//getting the widgets
+	ws, err := d.GetWidgets(ctx)
+	if err != nil {
+		ctx.Log.Error("error while getting the widgets of the dashboard", d.ID, err)
+		return nil, err
+	}
+
+	//building the document
+	doc := &DashboardExport{
+		Version:        ExportVersion,
+		Name:           d.Name,
+		Description:    d.Description,
+		ShowNavigation: d.ShowNavigation,
+		Placement:      d.Placement,
+		IsTemplate:     d.IsTemplate,
+		Pages:          []PageExport{},
+		Widgets:        []WidgetExport{},
+		Filters:        []FilterExport{},
+	}
+	index := map[uint]int{}
+	for _, w := range ws {
+		index[w.ID] = len(doc.Widgets)
+		q := w.Query
+		q.Result = nil
+		doc.Widgets = append(doc.Widgets, WidgetExport{
+			ID:              w.ID,
+			Title:           w.Title,
+			NL:              w.NL,
+			Query:           q,
+			Visualization:   w.Visualization,
+			RefreshInterval: w.RefreshInterval,
+		})
+	}
+	for _, p := range d.DashboardPages {
+		pe := PageExport{Name: p.Name, Number: p.Number, GridSize: p.GridSize, Width: p.Width, Height: p.Height, Items: []GridItemExport{}}
+		for _, item := range p.PageGridItems {
+			i, ok := index[item.WidgetID]
+			if !ok {
+				//widget of the grid item has been deleted
+				continue
+			}
+			pe.Items = append(pe.Items, GridItemExport{Widget: i, X: item.X, Y: item.Y, Width: item.Width, Height: item.Height})
+		}
+		doc.Pages = append(doc.Pages, pe)
+	}
+	for _, f := range d.Filters {
+		doc.Filters = append(doc.Filters, FilterExport{TableUID: f.TableUID, Column: f.Column, Operation: f.Operation, Value: f.Value})
+	}
+	return doc, nil
+}
+
+//Validate validates the export document. If the document is invalid InvalidExportError is returned
+func (doc DashboardExport) Validate() error {
+	/*
+	 * We will validate the version and the name
+	 * We will validate the no. of pages, items and widgets before allocating the page layouts
+	 * We will validate the size of the pages
+	 * We will validate the widget references, bounds and overlaps of the grid items
+	 * Then we will validate the filters
+	 */
+	//validating the version and the name
+	if doc.Version < 1 || doc.Version > ExportVersion {
+		return InvalidExportError{Reason: fmt.Sprintf("unsupported version %d", doc.Version)}
+	}
+	if len(doc.Name) == 0 {
+		return InvalidExportError{Reason: "name of the dashboard is missing"}
+	}
+
+	//validating the no. of pages, items and widgets
+	if len(doc.Pages) > ExportMaxPages {
+		return InvalidExportError{Reason: fmt.Sprintf("document has more than %d pages", ExportMaxPages)}
+	}
+	if len(doc.Widgets) > ExportMaxWidgets {
+		return InvalidExportError{Reason: fmt.Sprintf("document has more than %d widgets", ExportMaxWidgets)}
+	}
+	for i, p := range doc.Pages {
+		if len(p.Items) > ExportMaxPageItems {
+			return InvalidExportError{Reason: fmt.Sprintf("page %d has more than %d items", i, ExportMaxPageItems)}
+		}
+	}
+
+	for i, p := range doc.Pages {
+		//validating the size of the page
+		if p.GridSize == 0 || p.Width == 0 || p.Height == 0 || p.Width > PageMaxWidth || p.Height > PageMaxHeight {
+			return InvalidExportError{Reason: fmt.Sprintf("page %d has invalid size", i)}
+		}
+
+		//validating the grid items
+		dp := &DashboardPage{Width: p.Width, Height: p.Height}
+		grid := dp.GetPageLayout()
+		for j, item := range p.Items {
+			if item.Widget < 0 || item.Widget >= len(doc.Widgets) {
+				return InvalidExportError{Reason: fmt.Sprintf("item %d of page %d refers to an unknown widget %d", j, i, item.Widget)}
+			}
+			if !fits(item.X, item.Y, item.Width, item.Height, p.Width, p.Height) {
+				return InvalidExportError{Reason: fmt.Sprintf("item %d of page %d is out of the page bounds", j, i)}
+			}
+			if !isFree(grid, item.X, item.Y, item.Width, item.Height) {
+				return InvalidExportError{Reason: fmt.Sprintf("item %d of page %d overlaps with other items", j, i)}
+			}
+			for y := item.Y; y < item.Y+item.Height; y++ {
+				for x := item.X; x < item.X+item.Width; x++ {
+					grid[y][x] = true
+				}
+			}
+		}
+	}
+
+	//validating the filters
+	for i, f := range doc.Filters {
+		if !(DashboardFilter{Column: f.Column, Operation: f.Operation}).valid() {
+			return InvalidExportError{Reason: fmt.Sprintf("filter %d should have a column and a supported operation", i)}
+		}
+	}
+	return nil
+}
+
+//Import validates the export document and recreates the dashboard along with its pages, grid items and widgets
+//for the given user in a transaction. Queries of the widgets are not taken from the document. They are re-interpreted
+//from the natural language queries with the given interpreter of the user. Widgets of the templates are parameterized again.
+//Tables of the filters are dropped as the tables of the re-interpreted queries may differ.
+//If the document is invalid or a widget can't be interpreted InvalidExportError is returned
+func Import(ctx *config.AppContext, userID uint, doc DashboardExport, interpret NLInterpreter) (*Dashboard, error) {
+	/*
+	 * We will validate the document
+	 * We will build the pages and the widgets
+	 * We will re-interpret the queries of the widgets
+	 * Then we will create the dashboard along with its pages and widgets
+	 */
+	//validating the document
+	err := doc.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	//building the pages and the widgets
+	pages, ws := doc.content()
+
+	//re-interpreting the queries of the widgets
+	for i := range ws {
+		q, err := interpret(ws[i].NL)
+		if err != nil || q == nil {
+			ctx.Log.Error("error while interpreting the query of the widget", i, "in the document", err)
+			return nil, InvalidExportError{Reason: fmt.Sprintf("query of the widget %d couldn't be interpreted", i)}
+		}
+		ws[i].Query = *q
+		ws[i].Query.Result = nil
+	}
+	if doc.IsTemplate {
+		ws, _ = parameterize(ws)
+	}
+	filters := []DashboardFilter{}
+	for _, f := range doc.filters() {
+		f.TableUID = ""
+		filters = append(filters, f)
+	}
+
+	//creating the dashboard
+	d := &Dashboard{
+		Name:           doc.Name,
+		Description:    doc.Description,
+		UserID:         userID,
+		ShowNavigation: doc.ShowNavigation,
+		Placement:      doc.Placement,
+		IsTemplate:     doc.IsTemplate,
+	}
+	err = d.createWithContent(ctx, pages, ws, filters)
+	if err != nil {
+		ctx.Log.Error("error while importing the dashboard", doc.Name, err)
+		return nil, err
+	}
+	return d, nil
+}
+
+//filters returns the dashboard filters of the document
+func (doc DashboardExport) filters() []DashboardFilter {
+	res := []DashboardFilter{}
+	for _, f := range doc.Filters {
+		res = append(res, DashboardFilter{TableUID: f.TableUID, Column: f.Column, Operation: f.Operation, Value: f.Value})
+	}
+	return res
+}
+
+//content builds the pages along with their grid items and the widgets of the document.
+//Ids of the widgets are their index in the document offset by 1 and the grid items refer to them
+func (doc DashboardExport) content() ([]DashboardPage, []Widget) {
+	/*
+	 * We will build the widgets
+	 * Then we will build the pages
+	 */
+	//building the widgets
+	ws := []Widget{}
+	for i, we := range doc.Widgets {
+		w := Widget{
+			Title:           we.Title,
+			NL:              we.NL,
+			Visualization:   we.Visualization,
+			RefreshInterval: we.RefreshInterval,
+		}
+		w.ID = uint(i + 1)
+		w.Query = copyQuery(we.Query, func(t interpreter.TableNode) interpreter.TableNode {
+			return t
+		})
+		ws = append(ws, w)
+	}
+
+	//building the pages
+	pages := []DashboardPage{}
+	for _, pe := range doc.Pages {
+		p := DashboardPage{Name: pe.Name, Number: pe.Number, GridSize: pe.GridSize, Width: pe.Width, Height: pe.Height, HasWidgetAdded: len(pe.Items) != 0}
+		for _, item := range pe.Items {
+			p.PageGridItems = append(p.PageGridItems, PageGridItem{WidgetID: uint(item.Widget + 1), X: item.X, Y: item.Y, Width: item.Width, Height: item.Height})
+		}
+		pages = append(pages, p)
+	}
+	return pages, ws
+}
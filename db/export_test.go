@@ -0,0 +1,110 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"testing"
+)
+
+/*
+ * This file contains the tests of the validation of the dashboard export documents
+ */
+
+func TestValidateExport(t *testing.T) {
+	//doc returns a valid document modified by the given function
+	doc := func(modify func(doc *DashboardExport)) DashboardExport {
+		d := DashboardExport{
+			Version: ExportVersion,
+			Name:    "sales",
+			Pages: []PageExport{{Number: 1, GridSize: 10, Width: 100, Height: 100, Items: []GridItemExport{
+				{Widget: 0, X: 0, Y: 0, Width: 50, Height: 30},
+				{Widget: 1, X: 50, Y: 0, Width: 50, Height: 30},
+			}}},
+			Widgets: []WidgetExport{{NL: "sales by city"}, {NL: "sales by month"}},
+			Filters: []FilterExport{{Column: "city", Operation: "=", Value: "x"}},
+		}
+		if modify != nil {
+			modify(&d)
+		}
+		return d
+	}
+	cases := []struct {
+		name string
+		doc  DashboardExport
+		err  error
+	}{
+		{
+			name: "accepts a valid document",
+			doc:  doc(nil),
+		},
+		{
+			name: "accepts a document without filters",
+			doc:  doc(func(d *DashboardExport) { d.Filters = nil }),
+		},
+		{
+			name: "rejects the unsupported versions",
+			doc:  doc(func(d *DashboardExport) { d.Version = ExportVersion + 1 }),
+			err:  InvalidExportError{Reason: "unsupported version 2"},
+		},
+		{
+			name: "rejects a document without a name",
+			doc:  doc(func(d *DashboardExport) { d.Name = "" }),
+			err:  InvalidExportError{Reason: "name of the dashboard is missing"},
+		},
+		{
+			name: "rejects too many pages",
+			doc: doc(func(d *DashboardExport) {
+				d.Pages = make([]PageExport, ExportMaxPages+1)
+			}),
+			err: InvalidExportError{Reason: "document has more than 100 pages"},
+		},
+		{
+			name: "rejects too many items in a page",
+			doc: doc(func(d *DashboardExport) {
+				d.Pages[0].Items = make([]GridItemExport, ExportMaxPageItems+1)
+			}),
+			err: InvalidExportError{Reason: "page 0 has more than 500 items"},
+		},
+		{
+			name: "rejects too many widgets",
+			doc: doc(func(d *DashboardExport) {
+				d.Widgets = make([]WidgetExport, ExportMaxWidgets+1)
+			}),
+			err: InvalidExportError{Reason: "document has more than 1000 widgets"},
+		},
+		{
+			name: "rejects the pages larger than the maximum size",
+			doc:  doc(func(d *DashboardExport) { d.Pages[0].Width = PageMaxWidth + 1 }),
+			err:  InvalidExportError{Reason: "page 0 has invalid size"},
+		},
+		{
+			name: "rejects the items referring to an unknown widget",
+			doc:  doc(func(d *DashboardExport) { d.Pages[0].Items[1].Widget = 2 }),
+			err:  InvalidExportError{Reason: "item 1 of page 0 refers to an unknown widget 2"},
+		},
+		{
+			name: "rejects the items out of the page bounds",
+			doc:  doc(func(d *DashboardExport) { d.Pages[0].Items[1].X = 60 }),
+			err:  InvalidExportError{Reason: "item 1 of page 0 is out of the page bounds"},
+		},
+		{
+			name: "rejects the overlapping items",
+			doc:  doc(func(d *DashboardExport) { d.Pages[0].Items[1].X = 40 }),
+			err:  InvalidExportError{Reason: "item 1 of page 0 overlaps with other items"},
+		},
+		{
+			name: "rejects the filters with unsupported operations",
+			doc:  doc(func(d *DashboardExport) { d.Filters[0].Operation = "in" }),
+			err:  InvalidExportError{Reason: "filter 0 should have a column and a supported operation"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := c.doc.Validate(); err != c.err {
+				t.Errorf("expected the error %v, got %v", c.err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,490 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus/interpreter"
+)
+
+/*
+ * This file contains the federated execution of the queries spanning tables of multiple datastores
+ */
+
+//RowCapExceededError is returned when the no. of rows handled in memory by a federated query exceeds the cap
+type RowCapExceededError struct {
+	//Cap is the maximum no. of rows allowed
+	Cap int
+}
+
+func (r RowCapExceededError) Error() string {
+	return fmt.Sprintf("query spanning multiple datastores exceeded the limit of %d rows", r.Cap)
+}
+
+//federatedPart is the part of a federated query executed in a single datastore
+type federatedPart struct {
+	//datastoreID is the id of the datastore in which the part is executed
+	datastoreID uint
+	//query has the tables of the datastore with the columns to be fetched and the filters to be pushed down
+	query interpreter.Query
+	//rows are the result of the part
+	rows []map[string]interface{}
+}
+
+//federatedJoin is the in memory join of a part with the parts joined before it
+type federatedJoin struct {
+	//part to be joined
+	part int
+	//column of the part used for joining. It is in the <table uid>.<column> form
+	column string
+	//other is the column of the parts joined before used for joining. It is in the <table uid>.<column> form
+	other string
+}
+
+//addColumn adds the column to the selected columns of the query if it is not already there
+func addColumn(q *interpreter.Query, c interpreter.ColumnNode) {
+	for _, s := range q.Select {
+		if s.PUID == c.PUID && s.Name == c.Name {
+			return
+		}
+	}
+	c.AggregationFn = ""
+	q.Select = append(q.Select, c)
+}
+
+//relationshipTable returns the table of the query referred by the given uid or name of a relationship in the given datastore.
+//Tables referred by their name are looked up in the datastore of the relationship if more than one table has the name
+func relationshipTable(tables map[string]interpreter.TableNode, uid, name string, datastoreID uint) (interpreter.TableNode, bool) {
+	found := []interpreter.TableNode{}
+	for _, t := range tables {
+		if refers(uid, name, t) {
+			found = append(found, t)
+		}
+	}
+	if len(found) == 1 {
+		return found[0], true
+	}
+	for _, t := range found {
+		if t.DatastoreID == datastoreID {
+			return t, true
+		}
+	}
+	return interpreter.TableNode{}, false
+}
+
+//federatedPlan splits the query into the parts to be executed in each datastore and
+//the joins to be done in memory between them using the given relationships
+func federatedPlan(q interpreter.Query, rs []TableRelationship) ([]federatedPart, []federatedJoin, error) {
+	/*
+	 * We will split the tables into parts by their datastore in a deterministic order
+	 * We will find the joins between the parts
+	 * We will add the selected, grouped and joined columns to the parts
+	 * Then we will push down the filters to the parts
+	 */
+	//splitting the tables into parts
+	uids := []string{}
+	tables := map[string]interpreter.TableNode{}
+	for _, t := range q.Tables {
+		uids = append(uids, t.UID)
+		tables[t.UID] = t
+	}
+	sort.Strings(uids)
+	parts := []federatedPart{}
+	partOf := map[string]int{}
+	for _, uid := range uids {
+		t := tables[uid]
+		i := -1
+		for j, p := range parts {
+			if p.datastoreID == t.DatastoreID {
+				i = j
+			}
+		}
+		if i == -1 {
+			parts = append(parts, federatedPart{datastoreID: t.DatastoreID, query: interpreter.Query{Tables: map[string]interpreter.TableNode{}}})
+			i = len(parts) - 1
+		}
+		parts[i].query.Tables[t.UID] = t
+		partOf[t.UID] = i
+	}
+
+	//finding the joins between the parts
+	joins := []federatedJoin{}
+	joined := map[int]bool{0: true}
+	for len(joined) < len(parts) {
+		found := false
+		for _, r := range rs {
+			from, okF := relationshipTable(tables, r.fromUID, r.FromTable, r.DatastoreID)
+			to, okT := relationshipTable(tables, r.toUID, r.ToTable, r.DatastoreID)
+			if !okF || !okT {
+				continue
+			}
+			fp, tp := partOf[from.UID], partOf[to.UID]
+			fc := interpreter.ColumnNode{Name: r.FromColumn, PUID: from.UID}
+			tc := interpreter.ColumnNode{Name: r.ToColumn, PUID: to.UID}
+			switch {
+			case joined[tp] && !joined[fp]:
+				joins = append(joins, federatedJoin{part: fp, column: from.UID + "." + r.FromColumn, other: to.UID + "." + r.ToColumn})
+				joined[fp] = true
+			case joined[fp] && !joined[tp]:
+				joins = append(joins, federatedJoin{part: tp, column: to.UID + "." + r.ToColumn, other: from.UID + "." + r.FromColumn})
+				joined[tp] = true
+			default:
+				continue
+			}
+			addColumn(&parts[fp].query, fc)
+			addColumn(&parts[tp].query, tc)
+			found = true
+			break
+		}
+		if !found {
+			for _, uid := range uids {
+				if !joined[partOf[uid]] {
+					return nil, nil, NoRelationshipError{Table: tables[uid].Name}
+				}
+			}
+		}
+	}
+
+	//adding the selected and grouped columns
+	for _, c := range append(append([]interpreter.ColumnNode{}, q.Select...), q.GroupBy...) {
+		i, ok := partOf[c.PUID]
+		if !ok {
+			return nil, nil, fmt.Errorf("couldn't find the table of the column %s", c.Name)
+		}
+		addColumn(&parts[i].query, c)
+	}
+
+	//pushing down the filters
+	for _, f := range q.Filters {
+		i, ok := partOf[f.Column.PUID]
+		if !ok {
+			return nil, nil, fmt.Errorf("couldn't find the table of the column %s", f.Column.Name)
+		}
+		parts[i].query.Filters = append(parts[i].query.Filters, f)
+	}
+	return parts, joins, nil
+}
+
+//qualifyRows returns the rows of a part with the columns aliased by their position keyed as <table uid>.<column>
+func qualifyRows(cols []interpreter.ColumnNode, rows []map[string]interface{}) []map[string]interface{} {
+	keys := selectAliases(nil, cols, true)
+	res := make([]map[string]interface{}, 0, len(rows))
+	for _, r := range rows {
+		m := make(map[string]interface{}, len(keys))
+		for i, k := range keys {
+			m[k] = r["c"+strconv.Itoa(i)]
+		}
+		res = append(res, m)
+	}
+	return res
+}
+
+//joinKey returns the key of the given join column value. Numbers are formatted in one canonical form so that the same number
+//coming in different types from the datastores like int64(1), float64(1), "1" and []byte("1") gives the same key
+func joinKey(v interface{}) string {
+	switch n := v.(type) {
+	case int:
+		return strconv.FormatInt(int64(n), 10)
+	case int32:
+		return strconv.FormatInt(int64(n), 10)
+	case int64:
+		return strconv.FormatInt(n, 10)
+	case []byte:
+		return joinKey(string(n))
+	case string:
+		if i, err := strconv.ParseInt(n, 10, 64); err == nil {
+			return strconv.FormatInt(i, 10)
+		}
+	}
+	f, ok := toFloat(v)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	if f == math.Trunc(f) && math.Abs(f) < math.MaxInt64 {
+		return strconv.FormatInt(int64(f), 10)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+//hashJoin inner joins the rows with the rows of the part on the given columns. Keys are compared by their joinKey.
+//Rows with nil keys are not joined
+func hashJoin(rows, partRows []map[string]interface{}, j federatedJoin, rowCap int) ([]map[string]interface{}, error) {
+	index := map[string][]map[string]interface{}{}
+	for _, r := range partRows {
+		v := r[j.column]
+		if v == nil {
+			continue
+		}
+		k := joinKey(v)
+		index[k] = append(index[k], r)
+	}
+	res := []map[string]interface{}{}
+	for _, r := range rows {
+		v := r[j.other]
+		if v == nil {
+			continue
+		}
+		for _, pr := range index[joinKey(v)] {
+			if len(res) == rowCap {
+				return nil, RowCapExceededError{Cap: rowCap}
+			}
+			m := map[string]interface{}{}
+			for k, v := range r {
+				m[k] = v
+			}
+			for k, v := range pr {
+				m[k] = v
+			}
+			res = append(res, m)
+		}
+	}
+	return res, nil
+}
+
+//toFloat converts the given value from the datastore into a float if it is numeric
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float32:
+		return float64(n), true
+	case float64:
+		return n, true
+	case []byte:
+		f, err := strconv.ParseFloat(string(n), 64)
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+//less compares the given values numerically if both of them are numeric else as strings
+func less(a, b interface{}) bool {
+	fa, okA := toFloat(a)
+	fb, okB := toFloat(b)
+	if okA && okB {
+		return fa < fb
+	}
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+//aggregate is the in memory accumulator of an aggregation function
+type aggregate struct {
+	count    int
+	sum      float64
+	min, max interface{}
+}
+
+//add adds the value to the aggregate. nil values are ignored
+func (a *aggregate) add(v interface{}) {
+	if v == nil {
+		return
+	}
+	a.count++
+	if f, ok := toFloat(v); ok {
+		a.sum += f
+	}
+	if a.min == nil || less(v, a.min) {
+		a.min = v
+	}
+	if a.max == nil || less(a.max, v) {
+		a.max = v
+	}
+}
+
+//result returns the result of the aggregate for the given aggregation function
+func (a aggregate) result(fn string) interface{} {
+	switch strings.ToLower(fn) {
+	case "sum":
+		return a.sum
+	case "avg":
+		if a.count == 0 {
+			return nil
+		}
+		return a.sum / float64(a.count)
+	case "count":
+		return a.count
+	case "min":
+		return a.min
+	}
+	return a.max
+}
+
+//aggregateRows projects the joined rows to the selected columns of the query and aggregates them in memory.
+//Without the group by columns in the query, selected dimensions are grouped when aggregated
+func aggregateRows(q interpreter.Query, rows []map[string]interface{}) ([]map[string]interface{}, error) {
+	/*
+	 * We will find the aliases of the selected columns and the keys of the grouped columns
+	 * If there are no aggregations we will project the rows
+	 * Then we will group the rows and aggregate them
+	 */
+	//finding the aliases and the keys
+	tables := map[string]interpreter.TableNode{}
+	for _, t := range q.Tables {
+		tables[t.UID] = t
+	}
+	aliases := selectAliases(tables, q.Select, false)
+	key := func(c interpreter.ColumnNode) string {
+		return c.PUID + "." + c.Name
+	}
+	aggregated := false
+	groups := []string{}
+	for _, c := range q.Select {
+		if len(c.AggregationFn) == 0 {
+			groups = append(groups, key(c))
+			continue
+		}
+		if _, ok := aggregations[strings.ToLower(c.AggregationFn)]; !ok {
+			return nil, fmt.Errorf("aggregation %s is not supported", c.AggregationFn)
+		}
+		aggregated = true
+	}
+	if len(q.GroupBy) != 0 {
+		groups = []string{}
+		for _, c := range q.GroupBy {
+			groups = append(groups, key(c))
+		}
+	}
+
+	//projecting the rows
+	if !aggregated && len(q.GroupBy) == 0 {
+		res := []map[string]interface{}{}
+		for _, r := range rows {
+			m := map[string]interface{}{}
+			for i, c := range q.Select {
+				m[aliases[i]] = r[key(c)]
+			}
+			res = append(res, m)
+		}
+		return res, nil
+	}
+
+	//grouping and aggregating the rows in the order of their first occurrence
+	order := []string{}
+	firsts := map[string]map[string]interface{}{}
+	aggs := map[string][]aggregate{}
+	for _, r := range rows {
+		vs := []string{}
+		for _, g := range groups {
+			vs = append(vs, fmt.Sprint(r[g]))
+		}
+		k := strings.Join(vs, "\x00")
+		if _, ok := firsts[k]; !ok {
+			order = append(order, k)
+			firsts[k] = r
+			aggs[k] = make([]aggregate, len(q.Select))
+		}
+		for i, c := range q.Select {
+			if len(c.AggregationFn) != 0 {
+				aggs[k][i].add(r[key(c)])
+			}
+		}
+	}
+	res := []map[string]interface{}{}
+	for _, k := range order {
+		m := map[string]interface{}{}
+		for i, c := range q.Select {
+			if len(c.AggregationFn) == 0 {
+				m[aliases[i]] = firsts[k][key(c)]
+				continue
+			}
+			m[aliases[i]] = aggs[k][i].result(c.AggregationFn)
+		}
+		res = append(res, m)
+	}
+	return res, nil
+}
+
+//FederatedMode executes the given query spanning tables of multiple datastores. The tables of each datastore are queried
+//in their datastore with the filters pushed down. The partial results are then joined and aggregated in memory.
+//If the no. of rows of a datastore or after joining exceeds config.MaxFederatedRows RowCapExceededError is returned
+func FederatedMode(a config.AppContext, q interpreter.Query) ([]map[string]interface{}, error) {
+	return federatedMode(a, q, nil)
+}
+
+//federatedMode executes the given query spanning tables of multiple datastores using the given result cache
+func federatedMode(a config.AppContext, q interpreter.Query, ec *ExecCache) ([]map[string]interface{}, error) {
+	/*
+	 * We will get the relationships between the tables
+	 * We will plan the parts to be executed in each datastore
+	 * We will execute the parts in their datastores
+	 * We will join the results of the parts in memory
+	 * Then we will aggregate the joined rows
+	 */
+	//getting the relationships
+	tables := []interpreter.TableNode{}
+	rs := []TableRelationship{}
+	seen := map[uint]bool{}
+	for _, t := range q.Tables {
+		tables = append(tables, t)
+		if seen[t.DatastoreID] {
+			continue
+		}
+		seen[t.DatastoreID] = true
+		drs, err := joinRelationships(a, t.DatastoreID)
+		if err != nil {
+			a.Log.Error("error while getting the relationships of the datastore", t.DatastoreID, err)
+			return nil, err
+		}
+		rs = append(rs, drs...)
+	}
+	rs = append(rs, conventionalRelationships(tables)...)
+
+	//planning the parts
+	parts, joins, err := federatedPlan(q, rs)
+	if err != nil {
+		a.Log.Error("error while planning the query spanning multiple datastores", err)
+		return nil, err
+	}
+
+	//executing the parts
+	rowCap := config.MaxFederatedRows
+	for i, p := range parts {
+		d, err := datastoreDialect(p.datastoreID)
+		if err != nil {
+			a.Log.Error("error while getting the dialect of the datastore", p.datastoreID, err)
+			return nil, err
+		}
+		qs, err := joinSQL(p.query, rs, true, d)
+		if err != nil {
+			a.Log.Error("error while generating the query for the datastore", p.datastoreID, err)
+			return nil, err
+		}
+		rows, err := execDatastore(a, p.datastoreID, qs.Query+" LIMIT "+strconv.Itoa(rowCap+1), qs.Args, ec)
+		if err != nil {
+			a.Log.Error("error while executing the query in the datastore", p.datastoreID, err)
+			return nil, err
+		}
+		if len(rows) > rowCap {
+			return nil, RowCapExceededError{Cap: rowCap}
+		}
+		parts[i].rows = qualifyRows(p.query.Select, rows)
+	}
+
+	//joining the results
+	rows := parts[0].rows
+	for _, j := range joins {
+		rows, err = hashJoin(rows, parts[j.part].rows, j, rowCap)
+		if err != nil {
+			a.Log.Error("error while joining the results of the datastores", err)
+			return nil, err
+		}
+	}
+
+	//aggregating the rows
+	return aggregateRows(q, rows)
+}
@@ -0,0 +1,265 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cuttle-ai/octopus/interpreter"
+)
+
+/*
+ * This file contains the tests of the in memory planning, joining and aggregation of the federated queries
+ */
+
+//testTables returns the tables with their uid as the key
+func testTables(ts ...interpreter.TableNode) map[string]interpreter.TableNode {
+	res := map[string]interpreter.TableNode{}
+	for _, t := range ts {
+		res[t.UID] = t
+	}
+	return res
+}
+
+//partColumns returns the selected columns of the parts as <table uid>.<column>
+func partColumns(parts []federatedPart) [][]string {
+	res := [][]string{}
+	for _, p := range parts {
+		res = append(res, selectAliases(nil, p.query.Select, true))
+	}
+	return res
+}
+
+func TestFederatedPlan(t *testing.T) {
+	orders := interpreter.TableNode{UID: "o", Name: "orders", DatastoreID: 1, Children: []interpreter.ColumnNode{{Name: "customer_id", PUID: "o"}}}
+	customers := interpreter.TableNode{UID: "c", Name: "customers", DatastoreID: 2}
+	profiles := interpreter.TableNode{UID: "p", Name: "profiles", DatastoreID: 1, Children: []interpreter.ColumnNode{{Name: "user_id", PUID: "p"}}}
+	users1 := interpreter.TableNode{UID: "u1", Name: "users", DatastoreID: 1}
+	users2 := interpreter.TableNode{UID: "u2", Name: "users", DatastoreID: 2}
+	cases := []struct {
+		name    string
+		q       interpreter.Query
+		rs      []TableRelationship
+		columns [][]string
+		joins   []federatedJoin
+		err     error
+	}{
+		{
+			name: "joins the parts on a known relationship",
+			q: interpreter.Query{
+				Tables: testTables(orders, customers),
+				Select: []interpreter.ColumnNode{{Name: "name", PUID: "c"}, {Name: "amount", PUID: "o", AggregationFn: "sum"}},
+			},
+			rs:      []TableRelationship{{DatastoreID: 1, FromTable: "orders", FromColumn: "customer_id", ToTable: "customers", ToColumn: "id"}},
+			columns: [][]string{{"c.id", "c.name"}, {"o.customer_id", "o.amount"}},
+			joins:   []federatedJoin{{part: 1, column: "o.customer_id", other: "c.id"}},
+		},
+		{
+			name: "keeps the tables having the same name apart by their uid",
+			q: interpreter.Query{
+				Tables: testTables(profiles, users1, users2),
+				Select: []interpreter.ColumnNode{{Name: "name", PUID: "u1"}, {Name: "name", PUID: "u2"}},
+			},
+			rs:      conventionalRelationships([]interpreter.TableNode{profiles, users1, users2}),
+			columns: [][]string{{"p.user_id", "u1.name"}, {"u2.id", "u2.name"}},
+			joins:   []federatedJoin{{part: 1, column: "u2.id", other: "p.user_id"}},
+		},
+		{
+			name: "pushes down the filters to the part of their table",
+			q: interpreter.Query{
+				Tables:  testTables(orders, customers),
+				Select:  []interpreter.ColumnNode{{Name: "amount", PUID: "o"}},
+				Filters: []interpreter.FilterNode{{Column: interpreter.ColumnNode{Name: "name", PUID: "c"}, Operation: "=", Value: "x"}},
+			},
+			rs:      []TableRelationship{{DatastoreID: 1, FromTable: "orders", FromColumn: "customer_id", ToTable: "customers", ToColumn: "id"}},
+			columns: [][]string{{"c.id"}, {"o.customer_id", "o.amount"}},
+			joins:   []federatedJoin{{part: 1, column: "o.customer_id", other: "c.id"}},
+		},
+		{
+			name: "fails if a table can't be joined",
+			q: interpreter.Query{
+				Tables: testTables(orders, customers),
+				Select: []interpreter.ColumnNode{{Name: "amount", PUID: "o"}},
+			},
+			err: NoRelationshipError{Table: "orders"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			parts, joins, err := federatedPlan(c.q, c.rs)
+			if !reflect.DeepEqual(err, c.err) {
+				t.Fatalf("expected the error %v, got %v", c.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if cols := partColumns(parts); !reflect.DeepEqual(cols, c.columns) {
+				t.Errorf("expected the part columns %v, got %v", c.columns, cols)
+			}
+			if !reflect.DeepEqual(joins, c.joins) {
+				t.Errorf("expected the joins %v, got %v", c.joins, joins)
+			}
+		})
+	}
+	parts, _, _ := federatedPlan(cases[2].q, cases[2].rs)
+	if len(parts[0].query.Filters) != 1 || len(parts[1].query.Filters) != 0 {
+		t.Errorf("expected the filter to be pushed down to the part of customers, got %v", parts)
+	}
+}
+
+func TestHashJoin(t *testing.T) {
+	j := federatedJoin{part: 1, column: "u2.id", other: "p.user_id"}
+	cases := []struct {
+		name     string
+		rows     []map[string]interface{}
+		partRows []map[string]interface{}
+		rowCap   int
+		res      []map[string]interface{}
+		err      error
+	}{
+		{
+			name:     "merges the columns of the tables having the same name",
+			rows:     []map[string]interface{}{{"p.user_id": int64(1), "u1.name": "a"}, {"p.user_id": int64(2), "u1.name": "b"}},
+			partRows: []map[string]interface{}{{"u2.id": 1, "u2.name": "x"}, {"u2.id": 1, "u2.name": "y"}},
+			rowCap:   10,
+			res: []map[string]interface{}{
+				{"p.user_id": int64(1), "u1.name": "a", "u2.id": 1, "u2.name": "x"},
+				{"p.user_id": int64(1), "u1.name": "a", "u2.id": 1, "u2.name": "y"},
+			},
+		},
+		{
+			name:     "joins the byte keys with the int keys",
+			rows:     []map[string]interface{}{{"p.user_id": []byte("1"), "u1.name": "a"}, {"p.user_id": []byte("2"), "u1.name": "b"}},
+			partRows: []map[string]interface{}{{"u2.id": int64(1), "u2.name": "x"}, {"u2.id": int64(3), "u2.name": "y"}},
+			rowCap:   10,
+			res:      []map[string]interface{}{{"p.user_id": []byte("1"), "u1.name": "a", "u2.id": int64(1), "u2.name": "x"}},
+		},
+		{
+			name:     "joins the string keys with the int and float keys",
+			rows:     []map[string]interface{}{{"p.user_id": "1", "u1.name": "a"}, {"p.user_id": "2.5", "u1.name": "b"}, {"p.user_id": "c", "u1.name": "c"}},
+			partRows: []map[string]interface{}{{"u2.id": 1, "u2.name": "x"}, {"u2.id": float64(1), "u2.name": "y"}, {"u2.id": float32(2.5), "u2.name": "z"}, {"u2.id": "c", "u2.name": "w"}},
+			rowCap:   10,
+			res: []map[string]interface{}{
+				{"p.user_id": "1", "u1.name": "a", "u2.id": 1, "u2.name": "x"},
+				{"p.user_id": "1", "u1.name": "a", "u2.id": float64(1), "u2.name": "y"},
+				{"p.user_id": "2.5", "u1.name": "b", "u2.id": float32(2.5), "u2.name": "z"},
+				{"p.user_id": "c", "u1.name": "c", "u2.id": "c", "u2.name": "w"},
+			},
+		},
+		{
+			name:     "skips the rows with nil keys",
+			rows:     []map[string]interface{}{{"p.user_id": nil}},
+			partRows: []map[string]interface{}{{"u2.id": nil}},
+			rowCap:   10,
+			res:      []map[string]interface{}{},
+		},
+		{
+			name:     "fails if the joined rows exceed the cap",
+			rows:     []map[string]interface{}{{"p.user_id": 1}},
+			partRows: []map[string]interface{}{{"u2.id": 1}, {"u2.id": 1}},
+			rowCap:   1,
+			err:      RowCapExceededError{Cap: 1},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := hashJoin(c.rows, c.partRows, j, c.rowCap)
+			if !reflect.DeepEqual(err, c.err) {
+				t.Fatalf("expected the error %v, got %v", c.err, err)
+			}
+			if err == nil && !reflect.DeepEqual(res, c.res) {
+				t.Errorf("expected the rows %v, got %v", c.res, res)
+			}
+		})
+	}
+}
+
+func TestJoinKey(t *testing.T) {
+	cases := []struct {
+		v   interface{}
+		key string
+	}{
+		{int64(12), "12"},
+		{12, "12"},
+		{int32(-12), "-12"},
+		{float64(12), "12"},
+		{"12", "12"},
+		{[]byte("12"), "12"},
+		{"012", "12"},
+		{12.5, "12.5"},
+		{[]byte("12.50"), "12.5"},
+		{9007199254740993, "9007199254740993"},
+		{"9007199254740993", "9007199254740993"},
+		{"a", "a"},
+		{[]byte("a"), "a"},
+		{true, "true"},
+	}
+	for _, c := range cases {
+		if k := joinKey(c.v); k != c.key {
+			t.Errorf("expected the key of %#v to be %s, got %s", c.v, c.key, k)
+		}
+	}
+}
+
+func TestAggregateRows(t *testing.T) {
+	tables := testTables(interpreter.TableNode{UID: "u1", Name: "users"}, interpreter.TableNode{UID: "u2", Name: "users"})
+	rows := []map[string]interface{}{
+		{"u1.name": "a", "u2.name": "x", "u2.amount": 1},
+		{"u1.name": "b", "u2.name": "y", "u2.amount": "2.5"},
+		{"u1.name": "a", "u2.name": "z", "u2.amount": nil},
+		{"u1.name": "a", "u2.name": "x", "u2.amount": int64(3)},
+	}
+	cases := []struct {
+		name string
+		q    interpreter.Query
+		res  []map[string]interface{}
+		err  bool
+	}{
+		{
+			name: "projects the rows without aggregations",
+			q:    interpreter.Query{Tables: tables, Select: []interpreter.ColumnNode{{Name: "name", PUID: "u1"}, {Name: "name", PUID: "u2"}}},
+			res: []map[string]interface{}{
+				{"name": "a", "users_name": "x"}, {"name": "b", "users_name": "y"},
+				{"name": "a", "users_name": "z"}, {"name": "a", "users_name": "x"},
+			},
+		},
+		{
+			name: "groups the aggregations by the selected dimensions",
+			q: interpreter.Query{Tables: tables, Select: []interpreter.ColumnNode{
+				{Name: "name", PUID: "u1"}, {Name: "amount", PUID: "u2", AggregationFn: "sum"}, {Name: "amount", PUID: "u2", AggregationFn: "count"},
+			}},
+			res: []map[string]interface{}{
+				{"name": "a", "amount": 4.0, "users_amount": 2},
+				{"name": "b", "amount": 2.5, "users_amount": 1},
+			},
+		},
+		{
+			name: "groups by the group by columns",
+			q: interpreter.Query{
+				Tables:  tables,
+				Select:  []interpreter.ColumnNode{{Name: "amount", PUID: "u2", AggregationFn: "max"}},
+				GroupBy: []interpreter.ColumnNode{{Name: "name", PUID: "u2"}},
+			},
+			res: []map[string]interface{}{{"amount": int64(3)}, {"amount": "2.5"}, {"amount": nil}},
+		},
+		{
+			name: "fails for the unsupported aggregations",
+			q:    interpreter.Query{Tables: tables, Select: []interpreter.ColumnNode{{Name: "amount", PUID: "u2", AggregationFn: "median"}}},
+			err:  true,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := aggregateRows(c.q, rows)
+			if (err != nil) != c.err {
+				t.Fatalf("expected the error %v, got %v", c.err, err)
+			}
+			if err == nil && !reflect.DeepEqual(res, c.res) {
+				t.Errorf("expected the rows %v, got %v", c.res, res)
+			}
+		})
+	}
+}
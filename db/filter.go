@@ -0,0 +1,242 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus-service/dict"
+	"github.com/cuttle-ai/octopus/interpreter"
+	"github.com/jinzhu/gorm"
+)
+
+/*
+ * This file contains the database interactions for the dashboard level filters applied to all the widgets
+ */
+
+//ErrInvalidFilter is returned when the column or the operation of a dashboard filter is invalid
+var ErrInvalidFilter = errors.New("dashboard filter should have a column and a supported operation")
+
+//filterOperations has the operations supported by the dashboard filters
+var filterOperations = map[string]bool{
+	"=":    true,
+	"!=":   true,
+	">":    true,
+	">=":   true,
+	"<":    true,
+	"<=":   true,
+	"like": true,
+}
+
+//DashboardFilter is a filter applied on all the widgets of the dashboard having the column in their tables.
+//A date range can be given as two filters on the same column with >= and <= operations
+type DashboardFilter struct {
+	gorm.Model
+	//DashboardID  is the id of the dashboard
+	DashboardID uint
+	//TableUID is the uid of the table having the column to be filtered. If empty, the filter is applied
+	//only on the widgets having exactly one table with the column
+	TableUID string
+	//Column is the name of the column to be filtered
+	Column string
+	//Operation is the filter operation. Supported operations are =, !=, >, >=, <, <= and like
+	Operation string
+	//Value is the value to be used for filtering
+	Value string
+}
+
+//SetFilters replaces the filters of the dashboard with the given filters in a transaction and records the change as a new version.
+//The user should have the permission to edit the dashboard.
+//If the dashboard doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned.
+//If any of the filters is invalid ErrInvalidFilter is returned
+func (d *Dashboard) SetFilters(ctx *config.AppContext, userID uint, filters []DashboardFilter) ([]DashboardFilter, error) {
+	/*
+	 * We will validate the filters
+	 * We will check the permissions of the user
+	 * We will start a transaction
+	 * We will replace the existing filters with the new filters
+	 * Then we will record the change as a new version
+	 */
+	//validating the filters
+	for _, f := range filters {
+		if !f.valid() {
+			return nil, ErrInvalidFilter
+		}
+	}
+
+	//checking the permissions
+	_, err := CheckDashboardPermission(ctx, d.ID, userID, PermissionEdit)
+	if err != nil {
+		return nil, err
+	}
+
+	//starting the transaction
+	tx := ctx.Db.Begin()
+
+	//replacing the filters
+	res, err := replaceFilters(ctx, tx, d.ID, filters)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return nil, err
+	}
+
+	//recording the change
+	recordChange(ctx, d.ID, userID)
+	return res, nil
+}
+
+//valid checks whether the filter has a column and a supported operation
+func (f DashboardFilter) valid() bool {
+	return len(f.Column) != 0 && filterOperations[strings.ToLower(f.Operation)]
+}
+
+//replaceFilters replaces the filters of the dashboard with the given dashboard id with the given filters in the given transaction.
+//The caller has to rollback the transaction on error
+func replaceFilters(ctx *config.AppContext, tx *gorm.DB, dashboardID uint, filters []DashboardFilter) ([]DashboardFilter, error) {
+	/*
+	 * We will delete the existing filters
+	 * Then we will create the new filters
+	 */
+	//deleting the existing filters
+	err := tx.Where("dashboard_id = ?", dashboardID).Delete(&DashboardFilter{}).Error
+	if err != nil {
+		//error while deleting the existing filters
+		ctx.Log.Error("error while deleting the filters of the dashboard", dashboardID, err)
+		return nil, err
+	}
+
+	//creating the new filters
+	res := []DashboardFilter{}
+	for _, f := range filters {
+		nf := DashboardFilter{DashboardID: dashboardID, TableUID: f.TableUID, Column: f.Column, Operation: strings.ToLower(f.Operation), Value: f.Value}
+		err = tx.Create(&nf).Error
+		if err != nil {
+			//error while creating the filter
+			ctx.Log.Error("error while creating the filter for the dashboard", dashboardID, err)
+			return nil, err
+		}
+		res = append(res, nf)
+	}
+	return res, nil
+}
+
+//tableColumn returns the column of the table with the given name compared case insensitively. Columns are looked up
+//in the given tables of the dictionary as the query has only the columns it uses. Tables not in the dictionary
+//are looked up with the columns in the query
+func tableColumn(t interpreter.TableNode, tables map[string]interpreter.TableNode, name string) (interpreter.ColumnNode, bool) {
+	if dt, ok := tables[t.UID]; ok {
+		t = dt
+	}
+	if c, ok := dict.Column(t, name); ok {
+		return c, true
+	}
+	for _, c := range t.Children {
+		if strings.EqualFold(c.Name, name) {
+			return c, true
+		}
+	}
+	return interpreter.ColumnNode{}, false
+}
+
+//apply adds the filter to the query if the table of the filter in the query has the filtered column.
+//Columns of the tables are resolved from the given tables of the dictionary of the owner of the query.
+//Filters without a table are added only if exactly one of the tables in the query has the column.
+//Else the query is returned as such
+func (f DashboardFilter) apply(q interpreter.Query, tables map[string]interpreter.TableNode) interpreter.Query {
+	/*
+	 * We will find the tables having the filtered column
+	 * Then we will add the filter if the table is found without ambiguity
+	 */
+	//finding the tables having the column
+	var table interpreter.TableNode
+	var col interpreter.ColumnNode
+	found := 0
+	for _, t := range q.Tables {
+		if len(f.TableUID) != 0 && t.UID != f.TableUID {
+			continue
+		}
+		if c, ok := tableColumn(t, tables, f.Column); ok {
+			table, col = t, c
+			col.PUID = t.UID
+			found++
+		}
+	}
+	if found != 1 {
+		return q
+	}
+
+	//adding the filter
+	q.Filters = append(append([]interpreter.FilterNode{}, q.Filters...), interpreter.FilterNode{
+		UID:       col.UID,
+		Word:      []rune(f.Value),
+		PUID:      table.UID,
+		Column:    col,
+		Operation: f.Operation,
+		Value:     f.Value,
+	})
+	return q
+}
+
+//ApplyFilters merges the filters of the dashboard into the queries of the given widgets.
+//Columns of the tables are resolved from the dictionary of the owners of the widgets.
+//Filters are skipped for the widgets whose tables don't have the filtered column or have it in more than one table
+//when the filter doesn't have a table.
+//Filters of the dashboard should have been loaded before
+func (d *Dashboard) ApplyFilters(ws []Widget) []Widget {
+	res := []Widget{}
+	tables := map[uint]map[string]interpreter.TableNode{}
+	for _, w := range ws {
+		if len(d.Filters) == 0 {
+			res = append(res, w)
+			continue
+		}
+		ts, ok := tables[w.UserID]
+		if !ok {
+			ts = dict.Tables(w.UserID)
+			tables[w.UserID] = ts
+		}
+		for _, f := range d.Filters {
+			w.Query = f.apply(w.Query, ts)
+		}
+		res = append(res, w)
+	}
+	return res
+}
+
+//ApplyDashboardFilters merges the filters of the dashboard having the widget into the query of the widget
+//so that the widget gives the same result alone as in its dashboard. Widgets not added to any dashboard are left as such
+func (w *Widget) ApplyDashboardFilters(ctx *config.AppContext) error {
+	/*
+	 * We will get the dashboard having the widget along with its filters
+	 * Then we will apply the filters to the widget
+	 */
+	//getting the dashboard having the widget
+	d := &Dashboard{}
+	err := ctx.Db.Preload("Filters").
+		Where("id IN ?", ctx.Db.Model(&DashboardPage{}).Select("dashboard_id").
+			Where("id IN ?", ctx.Db.Model(&PageGridItem{}).Select("dashboard_page_id").Where("widget_id = ?", w.ID).SubQuery()).
+			SubQuery()).
+		Order("id ASC").First(d).Error
+	if gorm.IsRecordNotFoundError(err) {
+		//widget isn't in any dashboard
+		return nil
+	}
+	if err != nil {
+		//error while getting the dashboard of the widget
+		ctx.Log.Error("error while getting the dashboard having the widget", w.ID, err)
+		return err
+	}
+
+	//applying the filters
+	*w = d.ApplyFilters([]Widget{*w})[0]
+	return nil
+}
@@ -0,0 +1,68 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"testing"
+
+	"github.com/cuttle-ai/octopus/interpreter"
+)
+
+/*
+ * This file contains the tests of merging the dashboard filters into the widget queries
+ */
+
+func TestApplyFilter(t *testing.T) {
+	orders := interpreter.TableNode{UID: "o", Name: "orders", Children: []interpreter.ColumnNode{{UID: "o1", Name: "amount", PUID: "o"}}}
+	customers := interpreter.TableNode{UID: "c", Name: "customers"}
+	q := interpreter.Query{
+		Tables: testTables(orders, customers),
+		Select: []interpreter.ColumnNode{{UID: "o1", Name: "amount", PUID: "o", AggregationFn: "sum"}},
+	}
+	tables := testTables(
+		interpreter.TableNode{UID: "o", Name: "orders", Children: []interpreter.ColumnNode{
+			{UID: "o1", Name: "amount", PUID: "o"}, {UID: "o2", Name: "city", PUID: "o"}, {UID: "o3", Name: "created_at", PUID: "o"},
+		}},
+		interpreter.TableNode{UID: "c", Name: "customers", Children: []interpreter.ColumnNode{
+			{UID: "c1", Name: "city", PUID: "c"}, {UID: "c2", Name: "name", PUID: "c"},
+		}},
+	)
+	cases := []struct {
+		name   string
+		filter DashboardFilter
+		tables map[string]interpreter.TableNode
+		//column is the uid of the filtered column expected. Empty if the filter isn't expected to be applied
+		column string
+	}{
+		{"applies the filter on a column of the dictionary not used in the query", DashboardFilter{Column: "created_at", Operation: ">=", Value: "2019-01-01"}, tables, "o3"},
+		{"compares the column names case insensitively", DashboardFilter{Column: "NAME", Operation: "=", Value: "x"}, tables, "c2"},
+		{"applies the filter on the given table", DashboardFilter{TableUID: "c", Column: "city", Operation: "=", Value: "x"}, tables, "c1"},
+		{"skips the filter on a column in more than one table", DashboardFilter{Column: "city", Operation: "=", Value: "x"}, tables, ""},
+		{"skips the filter on a column not in the tables", DashboardFilter{Column: "country", Operation: "=", Value: "x"}, tables, ""},
+		{"skips the filter on a table not in the query", DashboardFilter{TableUID: "u", Column: "city", Operation: "=", Value: "x"}, tables, ""},
+		{"looks up the columns in the query for the tables not in the dictionary", DashboardFilter{Column: "amount", Operation: ">", Value: "1"}, nil, "o1"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res := c.filter.apply(q, c.tables)
+			if len(c.column) == 0 {
+				if len(res.Filters) != 0 {
+					t.Errorf("expected the filter not to be applied, got %v", res.Filters)
+				}
+				return
+			}
+			if len(res.Filters) != 1 {
+				t.Fatalf("expected the filter to be applied, got %v", res.Filters)
+			}
+			f := res.Filters[0]
+			if f.UID != c.column || f.Column.UID != c.column || f.Column.PUID != f.PUID || f.Operation != c.filter.Operation || f.Value != c.filter.Value {
+				t.Errorf("expected the filter on the column %s, got %v", c.column, f)
+			}
+		})
+	}
+	if len(q.Filters) != 0 {
+		t.Errorf("expected the given query not to be modified, got %v", q.Filters)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"errors"
+
+	"github.com/cuttle-ai/octopus-service/config"
+)
+
+/*
+ * This file contains the database interactions for moving and resizing the page grid items
+ */
+
+var (
+	//ErrInvalidGridItem is returned when the page grid item doesn't belong to the page or is repeated in a batch
+	ErrInvalidGridItem = errors.New("page grid item doesn't belong to the page")
+	//ErrOutOfBounds is returned when the page grid item doesn't fit inside the page
+	ErrOutOfBounds = errors.New("page grid item is out of the page bounds")
+	//ErrOverlap is returned when the page grid item overlaps with other items in the page
+	ErrOverlap = errors.New("page grid item overlaps with other items in the page")
+)
+
+//GridItemPosition is the new position and size of a page grid item
+type GridItemPosition struct {
+	//ID of the page grid item
+	ID uint
+	//X is the new x position of the grid item in the grid (in grid units)
+	X uint
+	//Y is the new y position of the grid item in the grid (in grid units)
+	Y uint
+	//Width is the new width of the grid item in the grid (in grid units)
+	Width uint
+	//Height is the new height of the grid item in the grid (in grid units)
+	Height uint
+}
+
+//MovePageGridItems moves and resizes the given page grid items of the page with the given id atomically.
+//The user should have the permission to edit the dashboard of the page.
+//If the page doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned.
+//If any of the items is out of the page bounds or overlaps with other items, ErrOutOfBounds or ErrOverlap is returned
+//and none of the items are moved
+func MovePageGridItems(ctx *config.AppContext, userID, pageID uint, positions []GridItemPosition) ([]PageGridItem, error) {
+	/*
+	 * We will check the permissions of the user
+	 * We will start a transaction which is rolled back unless committed
+	 * We will get the page and its grid items with a lock
+	 * Then we will validate the new positions
+	 * Then we will update the positions of the items
+	 * Then we will record the change as a new version of the dashboard
+	 */
+	//checking the permissions
+	dp, err := CheckPagePermission(ctx, pageID, userID, PermissionEdit)
+	if err != nil {
+		return nil, err
+	}
+
+	//starting the transaction
+	tx := ctx.Db.Begin()
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+
+	//getting the page and its grid items
+	locked := &DashboardPage{}
+	err = tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", dp.ID).First(locked).Error
+	if err != nil {
+		//error while getting the page
+		ctx.Log.Error("error while getting the page", dp.ID, err)
+		return nil, err
+	}
+	dp.Width, dp.Height = locked.Width, locked.Height
+	err = tx.Set("gorm:query_option", "FOR UPDATE").Where("dashboard_page_id = ?", dp.ID).Find(&dp.PageGridItems).Error
+	if err != nil {
+		//error while getting the page grid items
+		ctx.Log.Error("error while getting the page grid items of the page", dp.ID, err)
+		return nil, err
+	}
+
+	//validating the new positions
+	items, err := dp.applyPositions(positions)
+	if err != nil {
+		ctx.Log.Error("couldn't move the page grid items of the page", dp.ID, err)
+		return nil, err
+	}
+
+	//updating the positions
+	for _, item := range items {
+		err = tx.Model(&PageGridItem{}).Where("id = ?", item.ID).Updates(map[string]interface{}{
+			"x":      item.X,
+			"y":      item.Y,
+			"width":  item.Width,
+			"height": item.Height,
+		}).Error
+		if err != nil {
+			//error while updating the page grid item
+			ctx.Log.Error("error while updating the position of the page grid item", item.ID, err)
+			return nil, err
+		}
+	}
+
+	err = tx.Commit().Error
+	if err != nil {
+		return nil, err
+	}
+	committed = true
+
+	//recording the change
+	recordChange(ctx, dp.DashboardID, userID)
+	return items, nil
+}
+
+//fits checks whether the rectangle of the given size at the given position lies inside a page of the given size.
+//The comparisons are done without adding the position and the size so that they can't overflow
+func fits(x, y, width, height, pageWidth, pageHeight uint) bool {
+	return width != 0 && height != 0 && width <= pageWidth && x <= pageWidth-width && height <= pageHeight && y <= pageHeight-height
+}
+
+//applyPositions validates the new positions of the page grid items and returns the moved items.
+//Page grid items of the page should have been loaded before
+func (dp *DashboardPage) applyPositions(positions []GridItemPosition) ([]PageGridItem, error) {
+	/*
+	 * We will split the items of the page into moved and unmoved
+	 * We will validate the bounds of the moved items
+	 * We will get the layout of the page with only the unmoved items
+	 * Then we will place the moved items one by one on the layout checking for the overlaps
+	 */
+	//splitting the items
+	moved := map[uint]GridItemPosition{}
+	for _, p := range positions {
+		if _, ok := moved[p.ID]; ok {
+			return nil, ErrInvalidGridItem
+		}
+		moved[p.ID] = p
+	}
+	rest := &DashboardPage{Width: dp.Width, Height: dp.Height}
+	items := []PageGridItem{}
+	for _, item := range dp.PageGridItems {
+		p, ok := moved[item.ID]
+		if !ok {
+			rest.PageGridItems = append(rest.PageGridItems, item)
+			continue
+		}
+		item.X, item.Y, item.Width, item.Height = p.X, p.Y, p.Width, p.Height
+		items = append(items, item)
+	}
+	if len(items) != len(moved) {
+		return nil, ErrInvalidGridItem
+	}
+
+	//validating the bounds
+	for _, item := range items {
+		if !fits(item.X, item.Y, item.Width, item.Height, dp.Width, dp.Height) {
+			return nil, ErrOutOfBounds
+		}
+	}
+
+	//placing the moved items on the layout
+	grid := rest.GetPageLayout()
+	for _, item := range items {
+		if !isFree(grid, item.X, item.Y, item.Width, item.Height) {
+			return nil, ErrOverlap
+		}
+		for i := item.Y; i < item.Y+item.Height; i++ {
+			for j := item.X; j < item.X+item.Width; j++ {
+				grid[i][j] = true
+			}
+		}
+	}
+	return items, nil
+}
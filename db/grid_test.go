@@ -0,0 +1,116 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+/*
+ * This file contains the tests of the validation of the moved and resized page grid items
+ */
+
+func TestFits(t *testing.T) {
+	cases := []struct {
+		name                string
+		x, y, width, height uint
+		fits                bool
+	}{
+		{"fits inside the page", 2, 3, 4, 5, true},
+		{"fits at the bottom right corner of the page", 6, 5, 4, 5, true},
+		{"crosses the right border of the page", 7, 0, 4, 1, false},
+		{"crosses the bottom border of the page", 0, 6, 1, 5, false},
+		{"is wider than the page", 0, 0, 11, 1, false},
+		{"doesn't have a width", 0, 0, 0, 1, false},
+		{"doesn't have a height", 0, 0, 1, 0, false},
+		{"overflows the position and the width", math.MaxUint64, 0, 2, 1, false},
+		{"overflows the position and the height", 0, 2, 1, math.MaxUint64 - 1, false},
+	}
+	for _, c := range cases {
+		if res := fits(c.x, c.y, c.width, c.height, 10, 10); res != c.fits {
+			t.Errorf("%s: expected fits to be %v, got %v", c.name, c.fits, res)
+		}
+	}
+}
+
+func TestApplyPositions(t *testing.T) {
+	item := func(id, x, y, width, height uint) PageGridItem {
+		i := PageGridItem{X: x, Y: y, Width: width, Height: height}
+		i.ID = id
+		return i
+	}
+	dp := &DashboardPage{Width: 10, Height: 10, PageGridItems: []PageGridItem{
+		item(1, 0, 0, 4, 4), item(2, 4, 0, 4, 4), item(3, 0, 4, 4, 4),
+	}}
+	cases := []struct {
+		name      string
+		positions []GridItemPosition
+		res       []PageGridItem
+		err       error
+	}{
+		{
+			name:      "moves an item to a free space",
+			positions: []GridItemPosition{{ID: 1, X: 6, Y: 6, Width: 4, Height: 4}},
+			res:       []PageGridItem{item(1, 6, 6, 4, 4)},
+		},
+		{
+			name:      "resizes an item into the space left by it",
+			positions: []GridItemPosition{{ID: 1, X: 0, Y: 0, Width: 2, Height: 2}},
+			res:       []PageGridItem{item(1, 0, 0, 2, 2)},
+		},
+		{
+			name: "swaps the items moved together",
+			positions: []GridItemPosition{
+				{ID: 1, X: 4, Y: 0, Width: 4, Height: 4},
+				{ID: 2, X: 0, Y: 0, Width: 4, Height: 4},
+			},
+			res: []PageGridItem{item(1, 4, 0, 4, 4), item(2, 0, 0, 4, 4)},
+		},
+		{
+			name:      "fails if an item overlaps with an unmoved item",
+			positions: []GridItemPosition{{ID: 1, X: 2, Y: 2, Width: 4, Height: 4}},
+			err:       ErrOverlap,
+		},
+		{
+			name: "fails if the moved items overlap with each other",
+			positions: []GridItemPosition{
+				{ID: 1, X: 6, Y: 6, Width: 4, Height: 4},
+				{ID: 2, X: 5, Y: 5, Width: 2, Height: 2},
+			},
+			err: ErrOverlap,
+		},
+		{
+			name:      "fails if an item is out of the page bounds",
+			positions: []GridItemPosition{{ID: 1, X: 8, Y: 0, Width: 4, Height: 4}},
+			err:       ErrOutOfBounds,
+		},
+		{
+			name:      "fails if an item doesn't belong to the page",
+			positions: []GridItemPosition{{ID: 4, X: 6, Y: 6, Width: 1, Height: 1}},
+			err:       ErrInvalidGridItem,
+		},
+		{
+			name: "fails if an item is repeated",
+			positions: []GridItemPosition{
+				{ID: 1, X: 6, Y: 6, Width: 1, Height: 1},
+				{ID: 1, X: 8, Y: 8, Width: 1, Height: 1},
+			},
+			err: ErrInvalidGridItem,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := dp.applyPositions(c.positions)
+			if err != c.err {
+				t.Fatalf("expected the error %v, got %v", c.err, err)
+			}
+			if err == nil && !reflect.DeepEqual(res, c.res) {
+				t.Errorf("expected the items %v, got %v", c.res, res)
+			}
+		})
+	}
+}
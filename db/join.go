@@ -0,0 +1,475 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus-service/dict"
+	"github.com/cuttle-ai/octopus/interpreter"
+	"github.com/jinzhu/gorm"
+)
+
+/*
+ * This file contains the execution of the queries joining multiple tables of a datastore
+ */
+
+var (
+	//ErrMultipleDatastores is returned when the tables to be joined are not in the same datastore
+	ErrMultipleDatastores = errors.New("tables to be joined should be in the same datastore")
+	//ErrInvalidRelationship is returned when the tables or the columns of a relationship are missing
+	ErrInvalidRelationship = errors.New("relationship should have the datastore, tables and columns")
+)
+
+//NoRelationshipError is returned when a table in the query can't be joined with the rest of the tables
+type NoRelationshipError struct {
+	//Table which couldn't be joined
+	Table string
+}
+
+func (n NoRelationshipError) Error() string {
+	return "couldn't find a relationship to join the table " + n.Table + " with the other tables in the query"
+}
+
+//aggregations has the aggregation functions supported while joining the tables
+var aggregations = map[string]string{
+	"sum":   "SUM",
+	"avg":   "AVG",
+	"count": "COUNT",
+	"min":   "MIN",
+	"max":   "MAX",
+}
+
+//TableRelationship is a known relationship between the columns of two tables in a datastore used for joining them
+type TableRelationship struct {
+	gorm.Model
+	//DatastoreID is the id of the datastore in which the tables exist
+	DatastoreID uint
+	//FromTable is the name of the table having the reference. Eg:- orders
+	FromTable string
+	//FromColumn is the referring column in the from table. Eg:- customer_id
+	FromColumn string
+	//ToTable is the name of the referred table. Eg:- customers
+	ToTable string
+	//ToColumn is the referred column in the to table. Eg:- id
+	ToColumn string
+	//UserID is the id of the user who created the relationship
+	UserID uint
+	//fromUID and toUID are the uids of the tables of the relationships inferred by the naming convention
+	fromUID, toUID string
+}
+
+//refers checks whether the table with the given uid or name of a relationship is the given table.
+//Tables are referred by their uid if it is available, else by their name
+func refers(uid, name string, t interpreter.TableNode) bool {
+	if len(uid) != 0 {
+		return uid == t.UID
+	}
+	return strings.EqualFold(name, t.Name)
+}
+
+//isAdmin checks whether the user with the given id is an admin of the service
+func isAdmin(userID uint) bool {
+	return config.AdminUsers[userID]
+}
+
+//sessionUserID returns the id of the user of the session. It is 0 for the anonymous sessions
+func sessionUserID(a config.AppContext) uint {
+	if a.Session.User == nil {
+		return 0
+	}
+	return a.Session.User.ID
+}
+
+//hasTables checks whether the dictionary of the user has both the tables of the relationship in its datastore
+func (t TableRelationship) hasTables(userID uint) bool {
+	from, to := false, false
+	for _, tb := range dict.Tables(userID) {
+		if tb.DatastoreID != t.DatastoreID {
+			continue
+		}
+		from = from || strings.EqualFold(tb.Name, t.FromTable)
+		to = to || strings.EqualFold(tb.Name, t.ToTable)
+	}
+	return from && to
+}
+
+//Create creates the relationship by the given user. If the tables or the columns are missing ErrInvalidRelationship is returned.
+//Only the admins and the users having both the tables of the datastore in their dictionary can create it. Else ErrPermissionDenied is returned
+func (t *TableRelationship) Create(ctx *config.AppContext, userID uint) error {
+	/*
+	 * We will validate the relationship
+	 * We will check the permission of the user
+	 * Then we will create the relationship
+	 */
+	//validating the relationship
+	if t.DatastoreID == 0 || len(t.FromTable) == 0 || len(t.FromColumn) == 0 || len(t.ToTable) == 0 || len(t.ToColumn) == 0 {
+		return ErrInvalidRelationship
+	}
+
+	//checking the permission
+	if !isAdmin(userID) && !t.hasTables(userID) {
+		return ErrPermissionDenied
+	}
+
+	//creating the relationship
+	t.ID = 0
+	t.UserID = userID
+	return ctx.Db.Create(t).Error
+}
+
+//DeleteRelationship deletes the relationship with the given id. Only the admins and the user who created it can delete it.
+//Else ErrPermissionDenied is returned
+func DeleteRelationship(ctx *config.AppContext, userID, id uint) error {
+	/*
+	 * We will get the relationship
+	 * We will check the permission of the user
+	 * Then we will delete the relationship
+	 */
+	//getting the relationship
+	t := &TableRelationship{}
+	err := ctx.Db.Where("id = ?", id).First(t).Error
+	if err != nil {
+		return err
+	}
+
+	//checking the permission
+	if t.UserID != userID && !isAdmin(userID) {
+		return ErrPermissionDenied
+	}
+
+	//deleting the relationship
+	return ctx.Db.Delete(t).Error
+}
+
+//GetRelationships returns the known relationships between the tables of the given datastore usable by the given user.
+//They are the ones created by the user or by the admins. Admins get all the relationships of the datastore
+func GetRelationships(ctx *config.AppContext, userID, datastoreID uint) ([]TableRelationship, error) {
+	rs := []TableRelationship{}
+	q := ctx.Db.Where("datastore_id = ?", datastoreID)
+	if !isAdmin(userID) {
+		users := []uint{userID}
+		for id := range config.AdminUsers {
+			users = append(users, id)
+		}
+		q = q.Where("user_id IN (?)", users)
+	}
+	err := q.Order("id ASC").Find(&rs).Error
+	return rs, err
+}
+
+//joinRelationships returns the relationships used for joining the tables of the query in the given datastore.
+//They are the relationships created by the user of the session or by the admins
+func joinRelationships(a config.AppContext, datastoreID uint) ([]TableRelationship, error) {
+	userID := sessionUserID(a)
+	if isAdmin(userID) {
+		userID = 0
+	}
+	return GetRelationships(&a, userID, datastoreID)
+}
+
+//conventionalRelationships infers the relationships between the given tables by the naming convention
+//<table>_id or <singular of table>_id in a table referring to the id column of the other table
+func conventionalRelationships(tables []interpreter.TableNode) []TableRelationship {
+	rs := []TableRelationship{}
+	for _, from := range tables {
+		for _, to := range tables {
+			if from.UID == to.UID {
+				continue
+			}
+			names := []string{strings.ToLower(to.Name) + "_id", strings.TrimSuffix(strings.ToLower(to.Name), "s") + "_id"}
+			for _, c := range from.Children {
+				n := strings.ToLower(c.Name)
+				if n == names[0] || n == names[1] {
+					rs = append(rs, TableRelationship{DatastoreID: from.DatastoreID, FromTable: from.Name, FromColumn: c.Name,
+						ToTable: to.Name, ToColumn: "id", fromUID: from.UID, toUID: to.UID})
+					break
+				}
+			}
+		}
+	}
+	return rs
+}
+
+//selectAliases returns the aliases of the given selected columns. If qualified is true, columns are aliased as <table uid>.<column>.
+//Else they are aliased as the column name, prefixed with <table>_ if the name is already taken by another column
+func selectAliases(tables map[string]interpreter.TableNode, cols []interpreter.ColumnNode, qualified bool) []string {
+	res := []string{}
+	taken := map[string]bool{}
+	for _, c := range cols {
+		alias := c.Name
+		if qualified {
+			alias = c.PUID + "." + c.Name
+		} else if taken[alias] {
+			alias = tables[c.PUID].Name + "_" + c.Name
+		}
+		taken[alias] = true
+		res = append(res, alias)
+	}
+	return res
+}
+
+//tableSQL returns the sql query in the given dialect selecting the given columns of the table. In the dialect of
+//the interpreter it is generated by the interpreter as in the single table mode, so that the tables are referred
+//in the datastore the same way while joining them. In the other dialects the columns are selected from the table by their name
+func tableSQL(t interpreter.TableNode, cols []interpreter.ColumnNode, d dialect) (string, error) {
+	if !d.interpreted {
+		names := []string{}
+		for _, c := range cols {
+			names = append(names, d.quote(c.Name))
+		}
+		return "SELECT " + strings.Join(names, ", ") + " FROM " + d.quote(t.Name), nil
+	}
+	q := interpreter.Query{Tables: map[string]interpreter.TableNode{t.UID: t}, Select: cols}
+	qs, err := q.ToSQL()
+	if err != nil {
+		return "", err
+	}
+	if len(qs.Args) != 0 {
+		return "", fmt.Errorf("query of the table %s shouldn't have any arguments", t.Name)
+	}
+	return strings.TrimRight(strings.TrimSpace(qs.Query), ";"), nil
+}
+
+//joinSQL generates the sql query in the given dialect joining the tables of the query using the given relationships.
+//Each table is a sub query in the dialect selecting its columns used in the query, aliased as t<n>.
+//Tables are joined in a deterministic order starting from the table with the smallest uid.
+//If positional is true, selected columns are aliased by their position in the select list as c<n> else as in ResultColumns
+func joinSQL(q interpreter.Query, rs []TableRelationship, positional bool, d dialect) (*interpreter.SQLQuery, error) {
+	/*
+	 * We will sort the tables for a deterministic join order
+	 * We will find the joins between the tables
+	 * We will find the columns used from each table
+	 * We will build the from clause with the sub queries of the tables
+	 * We will build the select clause
+	 * We will build the where clause
+	 * Then we will build the group by clause
+	 */
+	//sorting the tables
+	tables := map[string]interpreter.TableNode{}
+	uids := []string{}
+	for _, t := range q.Tables {
+		tables[t.UID] = t
+		uids = append(uids, t.UID)
+	}
+	sort.Strings(uids)
+	aliases := map[string]string{}
+	for i, uid := range uids {
+		aliases[uid] = "t" + strconv.Itoa(i)
+	}
+
+	//finding the joins
+	cols := map[string][]interpreter.ColumnNode{}
+	use := func(c interpreter.ColumnNode) (string, error) {
+		if _, ok := tables[c.PUID]; !ok {
+			return "", fmt.Errorf("couldn't find the table of the column %s", c.Name)
+		}
+		for _, u := range cols[c.PUID] {
+			if u.Name == c.Name {
+				return d.quote(aliases[c.PUID]) + "." + d.quote(c.Name), nil
+			}
+		}
+		c.AggregationFn = ""
+		cols[c.PUID] = append(cols[c.PUID], c)
+		return d.quote(aliases[c.PUID]) + "." + d.quote(c.Name), nil
+	}
+	joined := []string{uids[0]}
+	joinedTable := func(uid, name string) (string, bool) {
+		for _, j := range joined {
+			if refers(uid, name, tables[j]) {
+				return j, true
+			}
+		}
+		return "", false
+	}
+	joins := []struct{ uid, on string }{}
+	pending := uids[1:]
+	for len(pending) > 0 {
+		found := false
+		for i, uid := range pending {
+			t := tables[uid]
+			for _, r := range rs {
+				var col, other interpreter.ColumnNode
+				if o, ok := joinedTable(r.toUID, r.ToTable); refers(r.fromUID, r.FromTable, t) && ok {
+					col, other = interpreter.ColumnNode{Name: r.FromColumn, PUID: uid}, interpreter.ColumnNode{Name: r.ToColumn, PUID: o}
+				} else if o, ok := joinedTable(r.fromUID, r.FromTable); refers(r.toUID, r.ToTable, t) && ok {
+					col, other = interpreter.ColumnNode{Name: r.ToColumn, PUID: uid}, interpreter.ColumnNode{Name: r.FromColumn, PUID: o}
+				} else {
+					continue
+				}
+				l, _ := use(col)
+				o, _ := use(other)
+				joins = append(joins, struct{ uid, on string }{uid, l + " = " + o})
+				joined = append(joined, uid)
+				found = true
+				break
+			}
+			if found {
+				pending = append(pending[:i:i], pending[i+1:]...)
+				break
+			}
+		}
+		if !found {
+			return nil, NoRelationshipError{Table: tables[pending[0]].Name}
+		}
+	}
+
+	//finding the columns used
+	selects := []string{}
+	dimensions := []string{}
+	names := selectAliases(tables, q.Select, false)
+	for i, c := range q.Select {
+		if positional {
+			names[i] = "c" + strconv.Itoa(i)
+		}
+		expr, err := use(c)
+		if err != nil {
+			return nil, err
+		}
+		if len(c.AggregationFn) == 0 {
+			dimensions = append(dimensions, expr)
+		} else {
+			fn, ok := aggregations[strings.ToLower(c.AggregationFn)]
+			if !ok {
+				return nil, fmt.Errorf("aggregation %s is not supported", c.AggregationFn)
+			}
+			expr = fn + "(" + expr + ")"
+		}
+		selects = append(selects, expr+" AS "+d.quote(names[i]))
+	}
+	if len(selects) == 0 {
+		return nil, errors.New("couldn't find the columns to be selected")
+	}
+	wheres := []string{}
+	args := []interface{}{}
+	for _, f := range q.Filters {
+		op := strings.ToLower(f.Operation)
+		if !filterOperations[op] {
+			return nil, fmt.Errorf("filter operation %s is not supported", f.Operation)
+		}
+		expr, err := use(f.Column)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, f.Value)
+		wheres = append(wheres, expr+" "+strings.ToUpper(op)+" "+d.placeholder(len(args)))
+	}
+	groups := []string{}
+	for _, c := range q.GroupBy {
+		expr, err := use(c)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, expr)
+	}
+
+	//building the from clause
+	from := func(uid string) (string, error) {
+		sub, err := tableSQL(tables[uid], cols[uid], d)
+		if err != nil {
+			return "", err
+		}
+		return "(" + sub + ") AS " + d.quote(aliases[uid]), nil
+	}
+	fromSQL, err := from(uids[0])
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range joins {
+		sub, err := from(j.uid)
+		if err != nil {
+			return nil, err
+		}
+		fromSQL += " JOIN " + sub + " ON " + j.on
+	}
+
+	//building the select clause
+	sql := "SELECT " + strings.Join(selects, ", ") + " FROM " + fromSQL
+
+	//building the where clause
+	if len(wheres) != 0 {
+		sql += " WHERE " + strings.Join(wheres, " AND ")
+	}
+
+	//building the group by clause. Without the group by columns in the query, selected dimensions are grouped when aggregated
+	if len(groups) == 0 && len(dimensions) != len(selects) {
+		groups = dimensions
+	}
+	if len(groups) != 0 {
+		sql += " GROUP BY " + strings.Join(groups, ", ")
+	}
+
+	return &interpreter.SQLQuery{Query: sql, Args: args}, nil
+}
+
+//JoinMode executes the given query joining its tables. All the tables are expected to be in the same datastore.
+//Tables are joined using the known relationships of the datastore followed by the ones inferred by the naming convention
+func JoinMode(a config.AppContext, q interpreter.Query) ([]map[string]interface{}, error) {
+	return joinMode(a, q, nil)
+}
+
+//joinMode executes the given query joining its tables using the given result cache
+func joinMode(a config.AppContext, q interpreter.Query, ec *ExecCache) ([]map[string]interface{}, error) {
+	/*
+	 * We will generate the join query
+	 * Then we will execute the query in the datastore
+	 */
+	//generating the join query
+	qs, datastoreID, err := joinModeSQL(a, q)
+	if err != nil {
+		return nil, err
+	}
+
+	//executing the query
+	return execDatastore(a, datastoreID, qs.Query, qs.Args, ec)
+}
+
+//joinModeSQL returns the sql query joining the tables of the given query along with the datastore of the tables
+func joinModeSQL(a config.AppContext, q interpreter.Query) (*interpreter.SQLQuery, uint, error) {
+	/*
+	 * We will check whether all the tables are in the same datastore
+	 * We will get the relationships between the tables
+	 * We will get the dialect of the datastore
+	 * Then we will generate the join query
+	 */
+	//checking the datastore of the tables
+	tables := []interpreter.TableNode{}
+	var datastoreID uint
+	for _, t := range q.Tables {
+		if datastoreID != 0 && t.DatastoreID != datastoreID {
+			return nil, 0, ErrMultipleDatastores
+		}
+		datastoreID = t.DatastoreID
+		tables = append(tables, t)
+	}
+
+	//getting the relationships
+	rs, err := joinRelationships(a, datastoreID)
+	if err != nil {
+		a.Log.Error("error while getting the relationships of the datastore", datastoreID, err)
+		return nil, 0, err
+	}
+	rs = append(rs, conventionalRelationships(tables)...)
+
+	//getting the dialect
+	d, err := datastoreDialect(datastoreID)
+	if err != nil {
+		a.Log.Error("error while getting the dialect of the datastore", datastoreID, err)
+		return nil, 0, err
+	}
+
+	//generating the join query
+	qs, err := joinSQL(q, rs, false, d)
+	if err != nil {
+		a.Log.Error("error while generating the join query", err)
+		return nil, 0, err
+	}
+	return qs, datastoreID, nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/cuttle-ai/octopus/interpreter"
+)
+
+/*
+ * This file contains the tests of the sql generated for joining the tables of a query
+ */
+
+func TestDialect(t *testing.T) {
+	cases := []struct {
+		name        string
+		d           dialect
+		quoted      string
+		placeholder string
+	}{
+		{"postgres", dialects["postgres"], `"a""b"`, "$2"},
+		{"mysql", dialects["mysql"], "`a\"b`", "?"},
+		{"sqlite", dialects["sqlite"], `"a""b"`, "?"},
+	}
+	for _, c := range cases {
+		if q := c.d.quote(`a"b`); q != c.quoted {
+			t.Errorf("%s: expected the identifier to be quoted as %s, got %s", c.name, c.quoted, q)
+		}
+		if p := c.d.placeholder(2); p != c.placeholder {
+			t.Errorf("%s: expected the placeholder %s, got %s", c.name, c.placeholder, p)
+		}
+	}
+}
+
+func TestJoinSQL(t *testing.T) {
+	orders := interpreter.TableNode{UID: "o", Name: "orders", Children: []interpreter.ColumnNode{{Name: "customer_id", PUID: "o"}}}
+	customers := interpreter.TableNode{UID: "c", Name: "customers"}
+	tables := testTables(orders, customers)
+	known := []TableRelationship{{FromTable: "orders", FromColumn: "customer_id", ToTable: "customers", ToColumn: "id"}}
+	cases := []struct {
+		name       string
+		q          interpreter.Query
+		rs         []TableRelationship
+		positional bool
+		d          dialect
+		res        *interpreter.SQLQuery
+		err        error
+	}{
+		{
+			name: "joins the tables on a known relationship grouping the aggregations by the dimensions",
+			q: interpreter.Query{Tables: tables, Select: []interpreter.ColumnNode{
+				{Name: "name", PUID: "c"}, {Name: "amount", PUID: "o", AggregationFn: "sum"},
+			}},
+			rs: known,
+			d:  dialects["mysql"],
+			res: &interpreter.SQLQuery{
+				Query: "SELECT `t0`.`name` AS `name`, SUM(`t1`.`amount`) AS `amount` FROM (SELECT `id`, `name` FROM `customers`) AS `t0` " +
+					"JOIN (SELECT `customer_id`, `amount` FROM `orders`) AS `t1` ON `t1`.`customer_id` = `t0`.`id` GROUP BY `t0`.`name`",
+				Args: []interface{}{},
+			},
+		},
+		{
+			name: "joins the tables on a conventional relationship with the filters and the positional aliases",
+			q: interpreter.Query{
+				Tables:  tables,
+				Select:  []interpreter.ColumnNode{{Name: "name", PUID: "c"}, {Name: "amount", PUID: "o"}},
+				Filters: []interpreter.FilterNode{{Column: interpreter.ColumnNode{Name: "city", PUID: "c"}, Operation: "like", Value: "x%"}},
+			},
+			rs:         conventionalRelationships([]interpreter.TableNode{orders, customers}),
+			positional: true,
+			d:          dialects["sqlite"],
+			res: &interpreter.SQLQuery{
+				Query: `SELECT "t0"."name" AS "c0", "t1"."amount" AS "c1" FROM (SELECT "id", "name", "city" FROM "customers") AS "t0" ` +
+					`JOIN (SELECT "customer_id", "amount" FROM "orders") AS "t1" ON "t1"."customer_id" = "t0"."id" WHERE "t0"."city" LIKE ?`,
+				Args: []interface{}{"x%"},
+			},
+		},
+		{
+			name: "aliases the columns having the same name by their table and groups by the group by columns",
+			q: interpreter.Query{
+				Tables:  tables,
+				Select:  []interpreter.ColumnNode{{Name: "id", PUID: "c", AggregationFn: "count"}, {Name: "id", PUID: "o", AggregationFn: "count"}},
+				GroupBy: []interpreter.ColumnNode{{Name: "city", PUID: "c"}},
+			},
+			rs: known,
+			d:  dialects["mysql"],
+			res: &interpreter.SQLQuery{
+				Query: "SELECT COUNT(`t0`.`id`) AS `id`, COUNT(`t1`.`id`) AS `orders_id` FROM (SELECT `id`, `city` FROM `customers`) AS `t0` " +
+					"JOIN (SELECT `customer_id`, `id` FROM `orders`) AS `t1` ON `t1`.`customer_id` = `t0`.`id` GROUP BY `t0`.`city`",
+				Args: []interface{}{},
+			},
+		},
+		{
+			name: "fails if a table can't be joined",
+			q:    interpreter.Query{Tables: tables, Select: []interpreter.ColumnNode{{Name: "name", PUID: "c"}}},
+			d:    dialects["mysql"],
+			err:  NoRelationshipError{Table: "orders"},
+		},
+		{
+			name: "fails for the unsupported aggregations",
+			q:    interpreter.Query{Tables: tables, Select: []interpreter.ColumnNode{{Name: "amount", PUID: "o", AggregationFn: "median"}}},
+			rs:   known,
+			d:    dialects["mysql"],
+			err:  errors.New("aggregation median is not supported"),
+		},
+		{
+			name: "fails for the unsupported filter operations",
+			q: interpreter.Query{
+				Tables:  tables,
+				Select:  []interpreter.ColumnNode{{Name: "amount", PUID: "o"}},
+				Filters: []interpreter.FilterNode{{Column: interpreter.ColumnNode{Name: "city", PUID: "c"}, Operation: "in", Value: "x"}},
+			},
+			rs:  known,
+			d:   dialects["mysql"],
+			err: errors.New("filter operation in is not supported"),
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := joinSQL(c.q, c.rs, c.positional, c.d)
+			if !reflect.DeepEqual(err, c.err) {
+				t.Fatalf("expected the error %v, got %v", c.err, err)
+			}
+			if !reflect.DeepEqual(res, c.res) {
+				t.Errorf("expected the query %v, got %v", c.res, res)
+			}
+		})
+	}
+}
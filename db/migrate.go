@@ -0,0 +1,377 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"errors"
+	"time"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/jinzhu/gorm"
+)
+
+/*
+ * This file contains the versioned schema migrations of the database models
+ */
+
+//ErrDbNotEnabled is returned when the migrations are run without the database enabled
+var ErrDbNotEnabled = errors.New("database is not enabled")
+
+//Migration is a versioned change to the database schema
+type Migration struct {
+	//Version of the migration. Migrations are applied in the increasing order of their versions
+	Version uint
+	//Name is the description of the migration
+	Name string
+	//Up applies the migration
+	Up func(tx *gorm.DB) error
+	//Down reverts the migration
+	Down func(tx *gorm.DB) error
+}
+
+//SchemaMigration is the record of a migration applied to the database
+type SchemaMigration struct {
+	//Version of the applied migration
+	Version uint `gorm:"primary_key;auto_increment:false"`
+	//Name of the applied migration
+	Name string
+	//AppliedAt is the time at which the migration was applied
+	AppliedAt time.Time
+}
+
+//migrationLock is the key of the postgres advisory lock held by the transaction applying or reverting a migration.
+//It serializes the migrations run concurrently by multiple instances of the service
+const migrationLock = 783216
+
+//schemaMigrationsSQL creates the table of the applied migrations
+const schemaMigrationsSQL = "CREATE TABLE IF NOT EXISTS schema_migrations (version integer PRIMARY KEY, name text, applied_at timestamp with time zone)"
+
+//table is the schema of a table frozen at a migration
+type table struct {
+	//name of the table
+	name string
+	//columns of the table other than the ones of gorm.Model as pairs of name and type
+	columns [][2]string
+}
+
+//create creates the table with the columns of gorm.Model and its columns. If the table already exists,
+//the missing columns are added to it
+func (t table) create(tx *gorm.DB) error {
+	/*
+	 * We will create the table with the columns of gorm.Model
+	 * Then we will add the columns of the table
+	 */
+	//creating the table
+	err := tx.Exec("CREATE TABLE IF NOT EXISTS " + t.name + ` (id serial PRIMARY KEY, created_at timestamp with time zone,
+		updated_at timestamp with time zone, deleted_at timestamp with time zone)`).Error
+	if err != nil {
+		return err
+	}
+	err = tx.Exec("CREATE INDEX IF NOT EXISTS idx_" + t.name + "_deleted_at ON " + t.name + " (deleted_at)").Error
+	if err != nil {
+		return err
+	}
+
+	//adding the columns
+	for _, c := range t.columns {
+		err = tx.Exec("ALTER TABLE " + t.name + " ADD COLUMN IF NOT EXISTS \"" + c[0] + "\" " + c[1]).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//createTables creates the given tables
+func createTables(tx *gorm.DB, tables ...table) error {
+	for _, t := range tables {
+		err := t.create(tx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//dropTables drops the tables with the given names
+func dropTables(tx *gorm.DB, names ...string) error {
+	for _, n := range names {
+		err := tx.Exec("DROP TABLE IF EXISTS " + n).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//index is an index to be created on a table
+type index struct {
+	//table to be indexed
+	table string
+	//name of the index
+	name string
+	//columns to be indexed
+	columns string
+	//unique indicates whether the index is unique
+	unique bool
+}
+
+//indexes has the indexes to be created on the tables of the dashboard models
+var indexes = []index{
+	{"dashboards", "idx_dashboards_user_id", "user_id", false},
+	{"dashboard_user_mappings", "idx_dashboard_user_mappings_dashboard_id", "dashboard_id", false},
+	{"dashboard_user_mappings", "idx_dashboard_user_mappings_user_id", "user_id", false},
+	{"dashboard_pages", "idx_dashboard_pages_dashboard_id", "dashboard_id", false},
+	{"page_grid_items", "idx_page_grid_items_dashboard_page_id", "dashboard_page_id", false},
+	{"widgets", "idx_widgets_user_id", "user_id", false},
+	{"dashboard_filters", "idx_dashboard_filters_dashboard_id", "dashboard_id", false},
+	{"dashboard_versions", "idx_dashboard_versions_dashboard_id_revision", "dashboard_id, revision", true},
+}
+
+//Migrations has the migrations of the database schema in the increasing order of their versions.
+//Schema of each migration is frozen in the migration so that it doesn't change with the later changes to the models
+var Migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create the dashboard, page, grid item and widget tables",
+		Up: func(tx *gorm.DB) error {
+			return createTables(tx,
+				table{"dashboards", [][2]string{
+					{"name", "text"}, {"description", "text"}, {"user_id", "integer"}, {"is_public", "boolean"},
+					{"has_public_widgets", "boolean"}, {"show_navigation", "boolean"}, {"is_template", "boolean"}, {"placement", "integer"},
+				}},
+				table{"dashboard_user_mappings", [][2]string{
+					{"dashboard_id", "integer"}, {"user_id", "integer"}, {"share", "boolean"}, {"manage", "boolean"}, {"edit", "boolean"},
+				}},
+				table{"dashboard_pages", [][2]string{
+					{"dashboard_id", "integer"}, {"name", "text"}, {"number", "integer"}, {"grid_size", "integer"},
+					{"width", "integer"}, {"height", "integer"}, {"has_widget_added", "boolean"},
+				}},
+				table{"page_grid_items", [][2]string{
+					{"dashboard_page_id", "integer"}, {"widget_id", "integer"}, {"x", "integer"}, {"y", "integer"},
+					{"width", "integer"}, {"height", "integer"},
+				}},
+				table{"widgets", [][2]string{
+					{"user_id", "integer"}, {"title", "text"}, {"nl", "text"}, {"query_json", "text"}, {"visualization_json", "text"},
+					{"refresh_interval", "integer"}, {"last_refreshed_at", "timestamp with time zone"}, {"is_public", "boolean"},
+				}},
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropTables(tx, "widgets", "page_grid_items", "dashboard_pages", "dashboard_user_mappings", "dashboards")
+		},
+	},
+	{
+		Version: 2,
+		Name:    "create the dashboard filter and version tables",
+		Up: func(tx *gorm.DB) error {
+			return createTables(tx,
+				table{"dashboard_filters", [][2]string{
+					{"dashboard_id", "integer"}, {"column", "text"}, {"operation", "text"}, {"value", "text"},
+				}},
+				table{"dashboard_versions", [][2]string{
+					{"dashboard_id", "integer"}, {"revision", "integer"}, {"user_id", "integer"}, {"restored_from", "integer"},
+					{"snapshot_json", "text"},
+				}},
+			)
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropTables(tx, "dashboard_versions", "dashboard_filters")
+		},
+	},
+	{
+		Version: 3,
+		Name:    "create the indexes on dashboard_id, user_id and dashboard_page_id",
+		Up: func(tx *gorm.DB) error {
+			for _, i := range indexes {
+				unique := ""
+				if i.unique {
+					unique = "UNIQUE "
+				}
+				err := tx.Exec("CREATE " + unique + "INDEX IF NOT EXISTS " + i.name + " ON " + i.table + " (" + i.columns + ")").Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		Down: func(tx *gorm.DB) error {
+			for _, i := range indexes {
+				err := tx.Exec("DROP INDEX IF EXISTS " + i.name).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version: 4,
+		Name:    "create the table relationship table",
+		Up: func(tx *gorm.DB) error {
+			err := createTables(tx, table{"table_relationships", [][2]string{
+				{"datastore_id", "integer"}, {"from_table", "text"}, {"from_column", "text"}, {"to_table", "text"}, {"to_column", "text"},
+			}})
+			if err != nil {
+				return err
+			}
+			return tx.Exec("CREATE INDEX IF NOT EXISTS idx_table_relationships_datastore_id ON table_relationships (datastore_id)").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropTables(tx, "table_relationships")
+		},
+	},
+	{
+		Version: 5,
+		Name:    "create the unique index on the dashboard_id and user_id of the dashboard user mappings",
+		Up: func(tx *gorm.DB) error {
+			err := tx.Exec(`UPDATE dashboard_user_mappings SET deleted_at = NOW() WHERE deleted_at IS NULL AND id NOT IN
+				(SELECT MIN(id) FROM dashboard_user_mappings WHERE deleted_at IS NULL GROUP BY dashboard_id, user_id)`).Error
+			if err != nil {
+				return err
+			}
+			return tx.Exec(`CREATE UNIQUE INDEX idx_dashboard_user_mappings_dashboard_id_user_id
+				ON dashboard_user_mappings (dashboard_id, user_id) WHERE deleted_at IS NULL`).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("DROP INDEX IF EXISTS idx_dashboard_user_mappings_dashboard_id_user_id").Error
+		},
+	},
+	{
+		Version: 6,
+		Name:    "add the table uid to the dashboard filters",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE dashboard_filters ADD COLUMN IF NOT EXISTS table_uid text").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE dashboard_filters DROP COLUMN IF EXISTS table_uid").Error
+		},
+	},
+	{
+		Version: 7,
+		Name:    "add the user who created the table relationships",
+		Up: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE table_relationships ADD COLUMN IF NOT EXISTS user_id integer").Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("ALTER TABLE table_relationships DROP COLUMN IF EXISTS user_id").Error
+		},
+	},
+}
+
+//beginMigration starts the transaction for applying or reverting a migration. The transaction holds the migration lock
+//and the table of the applied migrations is created if it doesn't exist
+func beginMigration(ctx *config.AppContext) (*gorm.DB, error) {
+	tx := ctx.Db.Begin()
+	err := tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLock).Error
+	if err == nil {
+		err = tx.Exec(schemaMigrationsSQL).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	return tx, nil
+}
+
+//isApplied checks whether the migration with the given version has been applied to the database
+func isApplied(tx *gorm.DB, version uint) (bool, error) {
+	c := 0
+	err := tx.Model(&SchemaMigration{}).Where("version = ?", version).Count(&c).Error
+	return c != 0, err
+}
+
+//Migrate applies the pending migrations in the increasing order of their versions.
+//Each migration is applied in its own transaction along with its record in the migrations table.
+//The transaction holds an advisory lock so that the migrations run concurrently by multiple instances don't race
+func Migrate(ctx *config.AppContext) error {
+	/*
+	 * We will check whether the database is enabled
+	 * Then we will apply the pending migrations one by one holding the migration lock
+	 */
+	//checking whether the database is enabled
+	if ctx.Db == nil {
+		return ErrDbNotEnabled
+	}
+
+	//applying the pending migrations
+	for _, m := range Migrations {
+		tx, err := beginMigration(ctx)
+		if err != nil {
+			ctx.Log.Error("error while starting the migration", m.Version, err)
+			return err
+		}
+		applied, err := isApplied(tx, m.Version)
+		if err == nil && applied {
+			tx.Rollback()
+			continue
+		}
+		if err == nil {
+			ctx.Log.Info("applying the migration", m.Version, m.Name)
+			err = m.Up(tx)
+		}
+		if err == nil {
+			err = tx.Create(&SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: gorm.NowFunc()}).Error
+		}
+		if err != nil {
+			//error while applying the migration
+			tx.Rollback()
+			ctx.Log.Error("error while applying the migration", m.Version, err)
+			return err
+		}
+		err = tx.Commit().Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//MigrateDown reverts the given no. of the latest applied migrations in the decreasing order of their versions.
+//Each migration is reverted in its own transaction holding the migration lock along with removing its record from the migrations table
+func MigrateDown(ctx *config.AppContext, steps int) error {
+	/*
+	 * We will check whether the database is enabled
+	 * Then we will revert the latest applied migrations one by one holding the migration lock
+	 */
+	//checking whether the database is enabled
+	if ctx.Db == nil {
+		return ErrDbNotEnabled
+	}
+
+	//reverting the migrations
+	for i := len(Migrations) - 1; i >= 0 && steps > 0; i-- {
+		m := Migrations[i]
+		tx, err := beginMigration(ctx)
+		if err != nil {
+			ctx.Log.Error("error while starting the migration", m.Version, err)
+			return err
+		}
+		applied, err := isApplied(tx, m.Version)
+		if err == nil && !applied {
+			tx.Rollback()
+			continue
+		}
+		if err == nil {
+			ctx.Log.Info("reverting the migration", m.Version, m.Name)
+			err = m.Down(tx)
+		}
+		if err == nil {
+			err = tx.Where("version = ?", m.Version).Delete(&SchemaMigration{}).Error
+		}
+		if err != nil {
+			//error while reverting the migration
+			tx.Rollback()
+			ctx.Log.Error("error while reverting the migration", m.Version, err)
+			return err
+		}
+		err = tx.Commit().Error
+		if err != nil {
+			return err
+		}
+		steps--
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cuttle-ai/octopus/interpreter"
+)
+
+/*
+ * This file contains the ordering of the result rows used for paginating and streaming the results
+ */
+
+//sortKey is a selected column by which the result rows are ordered
+type sortKey struct {
+	//position of the column in the select list starting from 1
+	position int
+	//desc is true if the rows are ordered in the descending order of the column
+	desc bool
+}
+
+var (
+	//orderByRegex matches the order by keyword
+	orderByRegex = regexp.MustCompile(`(?i)\bORDER\s+BY\b`)
+	//orderTailRegex matches the clauses following the order by clause
+	orderTailRegex = regexp.MustCompile(`(?i)\b(LIMIT|OFFSET|FETCH)\b`)
+	//directionRegex matches the direction and the nulls ordering at the end of an ordering expression
+	directionRegex = regexp.MustCompile(`(?i)\s+(ASC|DESC)(\s+NULLS\s+(FIRST|LAST))?$|\s+NULLS\s+(FIRST|LAST)$`)
+	//functionRegex matches an aggregation function applied on an expression
+	functionRegex = regexp.MustCompile(`^(\w+)\s*\((?i:\s*DISTINCT\s+)?(.*)\)$`)
+)
+
+//maskSQL returns the sql query with the quoted strings, identifiers and the parenthesized expressions blanked out,
+//so that the keywords and the commas found in it are at the top level of the query. Positions are preserved
+func maskSQL(sql string) string {
+	b := []byte(sql)
+	var quote byte
+	depth := 0
+	for i := 0; i < len(b); i++ {
+		c := b[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				if i+1 < len(b) && b[i+1] == quote {
+					b[i+1] = ' '
+					i++
+				} else {
+					quote = 0
+				}
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0:
+			continue
+		}
+		b[i] = ' '
+	}
+	return string(b)
+}
+
+//orderItems returns the ordering expressions in the top level order by clause of the given sql query along with their direction
+func orderItems(sql string) []string {
+	/*
+	 * We will mask the sql query
+	 * We will find the last top level order by clause
+	 * We will find the end of the clause
+	 * Then we will split the clause into the ordering expressions
+	 */
+	//masking the query
+	masked := maskSQL(sql)
+
+	//finding the order by clause
+	locs := orderByRegex.FindAllStringIndex(masked, -1)
+	if len(locs) == 0 {
+		return nil
+	}
+	start := locs[len(locs)-1][1]
+
+	//finding the end of the clause
+	end := len(sql)
+	if loc := orderTailRegex.FindStringIndex(masked[start:]); loc != nil {
+		end = start + loc[0]
+	}
+
+	//splitting the clause
+	items := []string{}
+	for start < end {
+		i := strings.IndexByte(masked[start:end], ',')
+		if i < 0 {
+			i = end - start
+		}
+		if item := strings.TrimSpace(sql[start : start+i]); len(item) != 0 {
+			items = append(items, item)
+		}
+		start += i + 1
+	}
+	return items
+}
+
+//unquote removes the quotes around the given identifier
+func unquote(id string) string {
+	id = strings.TrimSpace(id)
+	if len(id) >= 2 && (id[0] == '"' || id[0] == '`') && id[len(id)-1] == id[0] {
+		return id[1 : len(id)-1]
+	}
+	return id
+}
+
+//selectPosition returns the position in the select list of the query of the column ordered by the given ordering expression
+//along with its direction. The expression is matched by the position, the alias of the column in the result or the name of the
+//column along with its aggregation function. Position is 0 if the expression doesn't match any selected column
+func selectPosition(q interpreter.Query, item string) (int, bool) {
+	/*
+	 * We will find the direction of the ordering
+	 * We will match the expression by the position
+	 * We will match the expression by the alias of the column in the result
+	 * Then we will match the expression by the name of the column and its aggregation function
+	 */
+	//finding the direction
+	expr := strings.TrimSpace(item)
+	desc := false
+	if m := directionRegex.FindStringSubmatch(expr); m != nil {
+		desc = strings.EqualFold(m[1], "DESC")
+		expr = strings.TrimSpace(expr[:len(expr)-len(m[0])])
+	}
+
+	//matching by the position
+	if n, err := strconv.Atoi(expr); err == nil {
+		if n < 1 || n > len(q.Select) {
+			return 0, desc
+		}
+		return n, desc
+	}
+
+	//matching by the alias
+	for i, alias := range ResultColumns(q) {
+		if alias == unquote(expr) {
+			return i + 1, desc
+		}
+	}
+
+	//matching by the name and the aggregation function
+	fn := ""
+	if m := functionRegex.FindStringSubmatch(expr); m != nil {
+		fn, expr = m[1], m[2]
+	}
+	if i := strings.LastIndex(expr, "."); i >= 0 {
+		expr = expr[i+1:]
+	}
+	name := unquote(expr)
+	pos := 0
+	for i, c := range q.Select {
+		if !strings.EqualFold(c.Name, name) {
+			continue
+		}
+		if strings.EqualFold(aggregations[strings.ToLower(c.AggregationFn)], fn) {
+			return i + 1, desc
+		}
+		if pos == 0 {
+			pos = i + 1
+		}
+	}
+	return pos, desc
+}
+
+//queryOrder returns the order of the result rows of the query. The own order of the query is taken from the top level
+//order by clause of the sql query generated by the interpreter. Ordering expressions not matching a selected column are skipped.
+//All the selected columns follow by their position as the tie breakers, so that the order is the same across the executions
+func queryOrder(q interpreter.Query) []sortKey {
+	keys := []sortKey{}
+	used := map[int]bool{}
+	if qs, err := q.ToSQL(); err == nil && qs != nil {
+		for _, item := range orderItems(qs.Query) {
+			pos, desc := selectPosition(q, item)
+			if pos == 0 || used[pos] {
+				continue
+			}
+			used[pos] = true
+			keys = append(keys, sortKey{position: pos, desc: desc})
+		}
+	}
+	for i := range q.Select {
+		if !used[i+1] {
+			keys = append(keys, sortKey{position: i + 1})
+		}
+	}
+	return keys
+}
+
+//orderByClause returns the order by clause ordering the rows by the given keys referring the columns by their position
+func orderByClause(keys []sortKey) string {
+	items := []string{}
+	for _, k := range keys {
+		item := strconv.Itoa(k.position)
+		if k.desc {
+			item += " DESC"
+		}
+		items = append(items, item)
+	}
+	if len(items) == 0 {
+		return ""
+	}
+	return " ORDER BY " + strings.Join(items, ", ")
+}
+
+//sortRows sorts the rows of a query spanning datastores by the given keys referring the given columns of the rows by their position.
+//nil values are sorted after the rest in the ascending order and before the rest in the descending order as in the datastores
+func sortRows(rows []map[string]interface{}, cols []string, keys []sortKey) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		for _, k := range keys {
+			if k.position < 1 || k.position > len(cols) {
+				continue
+			}
+			a, b := rows[i][cols[k.position-1]], rows[j][cols[k.position-1]]
+			if k.desc {
+				a, b = b, a
+			}
+			switch {
+			case a == nil && b == nil:
+				continue
+			case a == nil:
+				return false
+			case b == nil:
+				return true
+			case less(a, b):
+				return true
+			case less(b, a):
+				return false
+			}
+		}
+		return false
+	})
+}
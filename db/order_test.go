@@ -0,0 +1,136 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cuttle-ai/octopus/interpreter"
+)
+
+/*
+ * This file contains the tests of the ordering of the result rows
+ */
+
+func TestOrderItems(t *testing.T) {
+	cases := []struct {
+		name  string
+		sql   string
+		items []string
+	}{
+		{"no order by clause", `SELECT "city" FROM "sales"`, nil},
+		{
+			"order by clause at the end",
+			`SELECT "city", SUM("amount") FROM "sales" GROUP BY "city" ORDER BY SUM("amount") DESC, "city"`,
+			[]string{`SUM("amount") DESC`, `"city"`},
+		},
+		{
+			"order by clause followed by the limit",
+			`SELECT "city" FROM "sales" order by 1 desc nulls last limit 10 offset 5`,
+			[]string{"1 desc nulls last"},
+		},
+		{
+			"order by in the sub queries, the window functions and the strings",
+			`SELECT "a", RANK() OVER (ORDER BY "b") FROM (SELECT * FROM "t" ORDER BY "c") AS s WHERE "d" = 'x ORDER BY y, z' ORDER BY "a"`,
+			[]string{`"a"`},
+		},
+		{
+			"order by in the quoted identifiers",
+			`SELECT "order by" FROM "t"`,
+			nil,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if items := orderItems(c.sql); !reflect.DeepEqual(items, c.items) {
+				t.Errorf("expected the ordering expressions %q, got %q", c.items, items)
+			}
+		})
+	}
+}
+
+func TestSelectPosition(t *testing.T) {
+	q := interpreter.Query{
+		Tables: testTables(interpreter.TableNode{UID: "s", Name: "sales"}),
+		Select: []interpreter.ColumnNode{
+			{Name: "city", PUID: "s"}, {Name: "amount", PUID: "s", AggregationFn: "count"}, {Name: "amount", PUID: "s", AggregationFn: "sum"},
+		},
+	}
+	cases := []struct {
+		item     string
+		position int
+		desc     bool
+	}{
+		{"2", 2, false},
+		{"3 DESC", 3, true},
+		{"4", 0, false},
+		{`"city" asc`, 1, false},
+		{`"sales"."city" DESC NULLS LAST`, 1, true},
+		{`SUM("sales"."amount") DESC`, 3, true},
+		{`count(distinct "amount")`, 2, false},
+		{`AVG("amount")`, 2, false},
+		{`amount`, 2, false},
+		{`"country"`, 0, false},
+		{`LOWER("city") || 'x'`, 0, false},
+	}
+	for _, c := range cases {
+		pos, desc := selectPosition(q, c.item)
+		if pos != c.position || (pos != 0 && desc != c.desc) {
+			t.Errorf("%s: expected the position %d and desc %v, got %d and %v", c.item, c.position, c.desc, pos, desc)
+		}
+	}
+}
+
+func TestOrderByClause(t *testing.T) {
+	keys := []sortKey{{position: 2, desc: true}, {position: 1}, {position: 3}}
+	if clause := orderByClause(keys); clause != " ORDER BY 2 DESC, 1, 3" {
+		t.Errorf("expected the order by clause ORDER BY 2 DESC, 1, 3, got %s", clause)
+	}
+	if clause := orderByClause(nil); clause != "" {
+		t.Errorf("expected no order by clause without the keys, got %s", clause)
+	}
+}
+
+func TestSortRows(t *testing.T) {
+	cols := []string{"city", "amount"}
+	rows := func() []map[string]interface{} {
+		return []map[string]interface{}{
+			{"city": "b", "amount": 2}, {"city": "a", "amount": "10"}, {"city": nil, "amount": 2},
+			{"city": "c", "amount": nil}, {"city": "a", "amount": 1.5},
+		}
+	}
+	cases := []struct {
+		name string
+		keys []sortKey
+		res  []map[string]interface{}
+	}{
+		{
+			name: "sorts by the columns in their order with nil last",
+			keys: []sortKey{{position: 1}, {position: 2}},
+			res: []map[string]interface{}{
+				{"city": "a", "amount": 1.5}, {"city": "a", "amount": "10"}, {"city": "b", "amount": 2},
+				{"city": "c", "amount": nil}, {"city": nil, "amount": 2},
+			},
+		},
+		{
+			name: "sorts by the own order of the query first with nil first in the descending order",
+			keys: []sortKey{{position: 2, desc: true}, {position: 1}},
+			res: []map[string]interface{}{
+				{"city": "c", "amount": nil}, {"city": "a", "amount": "10"}, {"city": "b", "amount": 2},
+				{"city": nil, "amount": 2}, {"city": "a", "amount": 1.5},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res := rows()
+			sortRows(res, cols, c.keys)
+			if !reflect.DeepEqual(res, c.res) {
+				t.Errorf("expected the rows %v, got %v", c.res, res)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/jinzhu/gorm"
+)
+
+/*
+ * This file contains the database interactions for managing the dashboard pages
+ */
+
+var (
+	//ErrInvalidPageOrder is returned when the page order doesn't have exactly the pages of the dashboard
+	ErrInvalidPageOrder = errors.New("page order should have all the pages of the dashboard exactly once")
+	//ErrInvalidPageSize is returned when the grid size, width or height of the page is zero or the page is larger than the maximum size
+	ErrInvalidPageSize = fmt.Errorf("grid size, width and height of the page should be greater than zero and the page can't be larger than %dx%d",
+		PageMaxWidth, PageMaxHeight)
+)
+
+//RenamePage renames the page with the given id. The user should have the permission to edit the dashboard of the page.
+//If the page doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func RenamePage(ctx *config.AppContext, userID, pageID uint, name string) (*DashboardPage, error) {
+	/*
+	 * We will check the permissions of the user
+	 * We will rename the page
+	 * Then we will record the change as a new version of the dashboard
+	 */
+	//checking the permissions
+	dp, err := CheckPagePermission(ctx, pageID, userID, PermissionEdit)
+	if err != nil {
+		return nil, err
+	}
+
+	//renaming the page
+	err = ctx.Db.Model(&DashboardPage{}).Where("id = ?", dp.ID).Update("name", name).Error
+	if err != nil {
+		return nil, err
+	}
+	dp.Name = name
+
+	//recording the change
+	recordChange(ctx, dp.DashboardID, userID)
+	return dp, nil
+}
+
+//ResizePage changes the grid size, width and height of the page with the given id.
+//The user should have the permission to edit the dashboard of the page.
+//If the page doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned.
+//If the existing grid items of the page won't fit in the new size ErrOutOfBounds is returned
+func ResizePage(ctx *config.AppContext, userID, pageID, gridSize, width, height uint) (*DashboardPage, error) {
+	/*
+	 * We will validate the size
+	 * We will check the permissions of the user
+	 * We will start a transaction which is rolled back unless committed
+	 * We will get the page and its grid items with a lock
+	 * We will check whether the existing grid items fit in the new size
+	 * We will update the page
+	 * Then we will record the change as a new version of the dashboard
+	 */
+	//validating the size
+	if gridSize == 0 || width == 0 || height == 0 || width > PageMaxWidth || height > PageMaxHeight {
+		return nil, ErrInvalidPageSize
+	}
+
+	//checking the permissions
+	dp, err := CheckPagePermission(ctx, pageID, userID, PermissionEdit)
+	if err != nil {
+		return nil, err
+	}
+
+	//starting the transaction
+	tx := ctx.Db.Begin()
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+
+	//getting the page and its grid items
+	err = tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", dp.ID).First(dp).Error
+	if err != nil {
+		//error while getting the page
+		ctx.Log.Error("error while getting the page", dp.ID, err)
+		return nil, err
+	}
+	err = tx.Where("dashboard_page_id = ?", dp.ID).Find(&dp.PageGridItems).Error
+	if err != nil {
+		//error while getting the page grid items
+		ctx.Log.Error("error while getting the page grid items of the page", dp.ID, err)
+		return nil, err
+	}
+
+	//checking whether the grid items fit
+	for _, item := range dp.PageGridItems {
+		if !fits(item.X, item.Y, item.Width, item.Height, width, height) {
+			ctx.Log.Error("page grid item", item.ID, "won't fit in the page", dp.ID, "after resizing")
+			return nil, ErrOutOfBounds
+		}
+	}
+
+	//updating the page
+	err = tx.Model(&DashboardPage{}).Where("id = ?", dp.ID).Updates(map[string]interface{}{
+		"grid_size": gridSize,
+		"width":     width,
+		"height":    height,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return nil, err
+	}
+	committed = true
+	dp.GridSize, dp.Width, dp.Height = gridSize, width, height
+
+	//recording the change
+	recordChange(ctx, dp.DashboardID, userID)
+	return dp, nil
+}
+
+//ReorderPages rewrites the page numbers of the dashboard in the order of the given page ids starting from 1.
+//The user should have the permission to edit the dashboard.
+//If the dashboard doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned.
+//If the page ids are not exactly the pages of the dashboard ErrInvalidPageOrder is returned
+func (d *Dashboard) ReorderPages(ctx *config.AppContext, userID uint, pageIDs []uint) ([]DashboardPage, error) {
+	/*
+	 * We will check the permissions of the user
+	 * We will start a transaction
+	 * We will get the pages of the dashboard
+	 * We will validate the page ids
+	 * We will update the page numbers
+	 * Then we will record the change as a new version
+	 */
+	//checking the permissions
+	_, err := CheckDashboardPermission(ctx, d.ID, userID, PermissionEdit)
+	if err != nil {
+		return nil, err
+	}
+
+	//starting the transaction
+	tx := ctx.Db.Begin()
+
+	//getting the pages
+	pages := []DashboardPage{}
+	err = tx.Set("gorm:query_option", "FOR UPDATE").Where("dashboard_id = ?", d.ID).Find(&pages).Error
+	if err != nil {
+		//error while getting the pages of the dashboard
+		tx.Rollback()
+		ctx.Log.Error("error while getting the pages of the dashboard", d.ID, err)
+		return nil, err
+	}
+
+	//validating the page ids
+	index := map[uint]int{}
+	for i, p := range pages {
+		index[p.ID] = i
+	}
+	seen := map[uint]bool{}
+	for _, id := range pageIDs {
+		if _, ok := index[id]; !ok || seen[id] {
+			tx.Rollback()
+			return nil, ErrInvalidPageOrder
+		}
+		seen[id] = true
+	}
+	if len(seen) != len(pages) {
+		tx.Rollback()
+		return nil, ErrInvalidPageOrder
+	}
+
+	//updating the page numbers
+	ordered := []DashboardPage{}
+	for i, id := range pageIDs {
+		p := pages[index[id]]
+		p.Number = uint(i + 1)
+		err = tx.Model(&DashboardPage{}).Where("id = ?", p.ID).Update("number", p.Number).Error
+		if err != nil {
+			//error while updating the page number
+			tx.Rollback()
+			ctx.Log.Error("error while updating the number of the page", p.ID, err)
+			return nil, err
+		}
+		ordered = append(ordered, p)
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return nil, err
+	}
+
+	//recording the change
+	recordChange(ctx, d.ID, userID)
+	return ordered, nil
+}
+
+//DeletePage deletes the page with the given id along with its grid items and renumbers the remaining pages without gaps.
+//The user should have the permission to edit the dashboard of the page.
+//If the page doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func DeletePage(ctx *config.AppContext, userID, pageID uint) error {
+	/*
+	 * We will check the permissions of the user
+	 * We will start a transaction
+	 * We will delete the grid items of the page
+	 * We will delete the page
+	 * We will renumber the pages after the deleted page
+	 * Then we will record the change as a new version of the dashboard
+	 */
+	//checking the permissions
+	dp, err := CheckPagePermission(ctx, pageID, userID, PermissionEdit)
+	if err != nil {
+		return err
+	}
+
+	//starting the transaction
+	tx := ctx.Db.Begin()
+
+	//deleting the grid items
+	err = tx.Where("dashboard_page_id = ?", dp.ID).Delete(&PageGridItem{}).Error
+	if err != nil {
+		//error while deleting the grid items of the page
+		tx.Rollback()
+		ctx.Log.Error("error while deleting the grid items of the page", dp.ID, err)
+		return err
+	}
+
+	//deleting the page
+	err = tx.Where("id = ?", dp.ID).Delete(&DashboardPage{}).Error
+	if err != nil {
+		//error while deleting the page
+		tx.Rollback()
+		ctx.Log.Error("error while deleting the page", dp.ID, err)
+		return err
+	}
+
+	//renumbering the pages
+	err = tx.Model(&DashboardPage{}).Where("dashboard_id = ? AND number > ?", dp.DashboardID, dp.Number).
+		UpdateColumn("number", gorm.Expr("number - 1")).Error
+	if err != nil {
+		//error while renumbering the pages
+		tx.Rollback()
+		ctx.Log.Error("error while renumbering the pages of the dashboard", dp.DashboardID, err)
+		return err
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return err
+	}
+
+	//recording the change
+	recordChange(ctx, dp.DashboardID, userID)
+	return nil
+}
@@ -0,0 +1,350 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus-service/datastores"
+	"github.com/cuttle-ai/octopus/interpreter"
+)
+
+/*
+ * This file contains the paginated execution of the queries
+ */
+
+//ResultPage is the window of the result rows of a query to be fetched
+type ResultPage struct {
+	//Limit is the maximum no. of rows to be fetched. It is capped at config.MaxSearchRows. 0 means the cap
+	Limit int
+	//Offset is the no. of rows to be skipped
+	Offset int
+}
+
+//Normalize caps the limit of the page at the maximum no. of rows allowed and clears the negative values
+func (p ResultPage) Normalize() ResultPage {
+	if p.Limit <= 0 || p.Limit > config.MaxSearchRows {
+		p.Limit = config.MaxSearchRows
+	}
+	if p.Offset < 0 {
+		p.Offset = 0
+	}
+	return p
+}
+
+//ExecPage executes the query using the given result cache and returns the rows in the given page along with the total no. of rows
+//in the result. The page is pushed down to the datastore except for the queries spanning datastores which are paginated in memory.
+//Rows are ordered by the own order of the query followed by all the selected columns, so that the pages of the result don't overlap or skip rows
+func ExecPage(a config.AppContext, q interpreter.Query, p ResultPage, ec *ExecCache) ([]map[string]interface{}, int, error) {
+	/*
+	 * We will normalize the page
+	 * We will paginate in memory for the queries spanning datastores
+	 * We will get the paged query
+	 * We will get the total no. of rows
+	 * Then we will get the rows in the page
+	 */
+	//normalizing the page
+	p = p.Normalize()
+
+	//paginating in memory
+	if len(q.Tables) == 0 {
+		return nil, 0, ErrNoTable
+	}
+	if spansDatastores(q) {
+		rows, err := federatedMode(a, q, ec)
+		if err != nil {
+			return nil, 0, err
+		}
+		sortRows(rows, ResultColumns(q), queryOrder(q))
+		return pageRows(rows, p), len(rows), nil
+	}
+
+	//getting the paged query
+	pq, err := newPagedQuery(a, q, ec)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	//getting the total no. of rows
+	total, err := pq.count(a)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	//getting the rows in the page
+	rows, err := pq.fetch(a, p)
+	if err != nil {
+		return nil, 0, err
+	}
+	return rows, total, nil
+}
+
+//ExecChunks executes the query and passes the rows of the result to fn in chunks of the given size.
+//The query is executed once and its rows are read from the datastore as they are passed, so the whole result is never held
+//in memory except for the queries spanning datastores and the datastores which can't stream the rows. Rows are ordered by
+//the own order of the query followed by all the selected columns. The chunks are not cached as they would evict the smaller
+//results from the cache. It stops at the first error returned by fn and returns the same. It stops with the error of the context
+//when the context is done, cancelling the query in the datastore
+func ExecChunks(ctx context.Context, a config.AppContext, q interpreter.Query, size int, fn func([]map[string]interface{}) error) error {
+	/*
+	 * We will default the chunk size
+	 * We will chunk in memory for the queries spanning datastores
+	 * We will get the paged query
+	 * Then we will stream the rows of the query in chunks
+	 */
+	//defaulting the chunk size
+	if size <= 0 {
+		size = config.MaxSearchRows
+	}
+
+	//chunking in memory
+	if len(q.Tables) == 0 {
+		return ErrNoTable
+	}
+	ec := &ExecCache{bypass: true}
+	if spansDatastores(q) {
+		rows, err := federatedMode(a, q, ec)
+		if err != nil {
+			return err
+		}
+		sortRows(rows, ResultColumns(q), queryOrder(q))
+		return chunkRows(ctx, rows, size, fn)
+	}
+
+	//getting the paged query
+	pq, err := newPagedQuery(a, q, ec)
+	if err != nil {
+		return err
+	}
+	pq.ctx = ctx
+
+	//streaming the rows
+	return pq.stream(a, size, fn)
+}
+
+//chunkRows passes the rows to fn in chunks of the given size till the context is done
+func chunkRows(ctx context.Context, rows []map[string]interface{}, size int, fn func([]map[string]interface{}) error) error {
+	for off := 0; off < len(rows); off += size {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		err := fn(pageRows(rows, ResultPage{Limit: size, Offset: off}))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//CountRows returns the total no. of rows in the result of the query without fetching them except for the queries
+//spanning datastores. The count is not cached
+func CountRows(ctx context.Context, a config.AppContext, q interpreter.Query) (int, error) {
+	/*
+	 * We will count in memory for the queries spanning datastores
+	 * We will get the paged query
+	 * Then we will count the rows
+	 */
+	//counting in memory
+	if len(q.Tables) == 0 {
+		return 0, ErrNoTable
+	}
+	ec := &ExecCache{bypass: true}
+	if spansDatastores(q) {
+		rows, err := federatedMode(a, q, ec)
+		return len(rows), err
+	}
+
+	//getting the paged query
+	pq, err := newPagedQuery(a, q, ec)
+	if err != nil {
+		return 0, err
+	}
+	pq.ctx = ctx
+
+	//counting the rows
+	return pq.count(a)
+}
+
+//pageRows returns the rows in the given page of the rows
+func pageRows(rows []map[string]interface{}, p ResultPage) []map[string]interface{} {
+	if p.Offset >= len(rows) {
+		return []map[string]interface{}{}
+	}
+	end := p.Offset + p.Limit
+	if end > len(rows) {
+		end = len(rows)
+	}
+	return rows[p.Offset:end]
+}
+
+//pagedQuery is a query pushed down to its datastore as a sub query so that its rows can be counted and fetched page by page
+type pagedQuery struct {
+	//datastoreID is the id of the datastore
+	datastoreID uint
+	//sub is the query aliased as a sub query
+	sub string
+	//args are the arguments of the query
+	args []interface{}
+	//order is the order of the rows of the query
+	order []sortKey
+	//ec is the result cache used for executing the query
+	ec *ExecCache
+	//ctx is the context till which the query is executed
+	ctx context.Context
+}
+
+//newPagedQuery returns the paged query for the given query using the given result cache. The query is expected to be on a single datastore
+func newPagedQuery(a config.AppContext, q interpreter.Query, ec *ExecCache) (*pagedQuery, error) {
+	var qs *interpreter.SQLQuery
+	var datastoreID uint
+	var err error
+	if len(q.Tables) == 1 {
+		qs, datastoreID, err = singleTableSQL(a, q)
+	} else {
+		qs, datastoreID, err = joinModeSQL(a, q)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &pagedQuery{
+		datastoreID: datastoreID,
+		sub:         "(" + strings.TrimRight(strings.TrimSpace(qs.Query), ";") + ") AS paged_query",
+		args:        qs.Args,
+		order:       queryOrder(q),
+		ec:          ec,
+		ctx:         context.Background(),
+	}, nil
+}
+
+//count returns the total no. of rows in the result of the query
+func (p *pagedQuery) count(a config.AppContext) (int, error) {
+	res, err := execDatastoreContext(p.ctx, a, p.datastoreID, "SELECT COUNT(*) AS total FROM "+p.sub, p.args, p.ec)
+	if err != nil {
+		a.Log.Error("error while counting the rows of the query", err)
+		return 0, err
+	}
+	total := 0
+	if len(res) != 0 {
+		if f, ok := toFloat(res[0]["total"]); ok {
+			total = int(f)
+		}
+	}
+	return total, nil
+}
+
+//orderBy returns the order by clause ordering the rows by the own order of the query followed by all the selected columns
+//by their position. Datastores don't guarantee the order of the rows between the executions without it
+func (p *pagedQuery) orderBy() string {
+	return orderByClause(p.order)
+}
+
+//fetch returns the rows of the query in the given page. Rows are ordered by the own order of the query followed by all the selected columns
+func (p *pagedQuery) fetch(a config.AppContext, pg ResultPage) ([]map[string]interface{}, error) {
+	rows, err := execDatastoreContext(p.ctx, a, p.datastoreID, "SELECT * FROM "+p.sub+p.orderBy()+" LIMIT "+strconv.Itoa(pg.Limit)+" OFFSET "+strconv.Itoa(pg.Offset), p.args, p.ec)
+	if err != nil {
+		a.Log.Error("error while fetching the page of the query", err)
+		return nil, err
+	}
+	return rows, nil
+}
+
+//rowsQueryer is implemented by the datastores which can return the rows of a query as they are read instead of
+//returning the whole result. *sql.DB implements it
+type rowsQueryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+//stream executes the query once with its rows ordered and passes them to fn in chunks of the given size as they are read from
+//the datastore. Datastores which can't stream the rows return the whole result which is then passed in chunks.
+//Byte values read from the datastore are passed as strings
+func (p *pagedQuery) stream(a config.AppContext, size int, fn func([]map[string]interface{}) error) error {
+	/*
+	 * We will get the datastore service
+	 * We will execute the query as a whole if the datastore can't stream the rows
+	 * We will execute the query
+	 * We will read the rows passing them in chunks
+	 * Then we will pass the last chunk
+	 */
+	//getting the datastore service
+	query := "SELECT * FROM " + p.sub + p.orderBy()
+	ser, err := datastores.GetService(a, p.datastoreID)
+	if err != nil {
+		a.Log.Error("error while getting the datastore service", p.datastoreID)
+		return err
+	}
+
+	//executing the query as a whole
+	rq, ok := ser.(rowsQueryer)
+	if !ok {
+		rows, err := execContext(p.ctx, ser, query, p.args)
+		if err != nil {
+			a.Log.Error("error while executing the query for streaming", err)
+			return err
+		}
+		return chunkRows(p.ctx, rows, size, fn)
+	}
+
+	//executing the query
+	rows, err := rq.QueryContext(p.ctx, query, p.args...)
+	if err != nil {
+		a.Log.Error("error while executing the query for streaming", err)
+		return err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	//reading the rows
+	chunk := make([]map[string]interface{}, 0, size)
+	for rows.Next() {
+		vals := make([]interface{}, len(cols))
+		ptrs := make([]interface{}, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		err = rows.Scan(ptrs...)
+		if err != nil {
+			a.Log.Error("error while reading the rows of the query", err)
+			return err
+		}
+		row := make(map[string]interface{}, len(cols))
+		for i, c := range cols {
+			if b, ok := vals[i].([]byte); ok {
+				row[c] = string(b)
+				continue
+			}
+			row[c] = vals[i]
+		}
+		chunk = append(chunk, row)
+		if len(chunk) < size {
+			continue
+		}
+		err = fn(chunk)
+		if err != nil {
+			return err
+		}
+		chunk = make([]map[string]interface{}, 0, size)
+	}
+	if p.ctx.Err() != nil {
+		return p.ctx.Err()
+	}
+	err = rows.Err()
+	if err != nil {
+		a.Log.Error("error while reading the rows of the query", err)
+		return err
+	}
+
+	//passing the last chunk
+	if len(chunk) == 0 {
+		return nil
+	}
+	return fn(chunk)
+}
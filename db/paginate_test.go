@@ -0,0 +1,56 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+/*
+ * This file contains the tests of the paginated and the chunked execution of the queries
+ */
+
+func TestChunkRows(t *testing.T) {
+	errStop := errors.New("stop")
+	cases := []struct {
+		name   string
+		rows   int
+		size   int
+		stopAt int
+		chunks []int
+		err    error
+	}{
+		{name: "passes the rows in chunks of the size", rows: 5, size: 2, chunks: []int{2, 2, 1}},
+		{name: "passes the rows fitting in a chunk at once", rows: 2, size: 3, chunks: []int{2}},
+		{name: "doesn't pass an empty result", rows: 0, size: 3, chunks: []int{}},
+		{name: "stops at the first error", rows: 5, size: 2, stopAt: 2, chunks: []int{2, 2}, err: errStop},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			chunks := []int{}
+			err := chunkRows(context.Background(), testRows(c.rows), c.size, func(rows []map[string]interface{}) error {
+				chunks = append(chunks, len(rows))
+				if len(chunks) == c.stopAt {
+					return errStop
+				}
+				return nil
+			})
+			if err != c.err {
+				t.Fatalf("expected the error %v, got %v", c.err, err)
+			}
+			if !reflect.DeepEqual(chunks, c.chunks) {
+				t.Errorf("expected the chunks %v, got %v", c.chunks, chunks)
+			}
+		})
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := chunkRows(ctx, testRows(2), 1, func([]map[string]interface{}) error { return nil }); err != context.Canceled {
+		t.Errorf("expected the error of the context, got %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"errors"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/jinzhu/gorm"
+)
+
+/*
+ * This file contains the permission checks for the dashboard, page and widget operations
+ */
+
+//Permission is a right a user can have over a dashboard
+type Permission uint
+
+const (
+	//PermissionView is the right to view the dashboard and its widgets
+	PermissionView Permission = 0
+	//PermissionEdit is the right to edit the dashboard, its pages and widgets
+	PermissionEdit Permission = 1
+	//PermissionShare is the right to share the dashboard with other users
+	PermissionShare Permission = 2
+	//PermissionManage is the right to manage the user permissions of the dashboard
+	PermissionManage Permission = 3
+	//PermissionOwner is the right held only by the owner of the dashboard. Eg:- deleting the dashboard
+	PermissionOwner Permission = 4
+)
+
+//ErrPermissionDenied is returned when the user doesn't have the permission for an operation
+var ErrPermissionDenied = errors.New("permission denied")
+
+//Access has the rights a user has over a dashboard
+type Access struct {
+	//Owner indicates that the user is the owner of the dashboard
+	Owner bool
+	//View indicates that the user can view the dashboard
+	View bool
+	//Edit indicates that the user can edit the dashboard
+	Edit bool
+	//Share indicates that the user can share the dashboard
+	Share bool
+	//Manage indicates that the user can manage the user permissions of the dashboard
+	Manage bool
+}
+
+//Has checks whether the access includes the given permission
+func (a Access) Has(p Permission) bool {
+	switch p {
+	case PermissionView:
+		return a.View
+	case PermissionEdit:
+		return a.Edit
+	case PermissionShare:
+		return a.Share
+	case PermissionManage:
+		return a.Manage
+	case PermissionOwner:
+		return a.Owner
+	}
+	return false
+}
+
+//GetAccess returns the access the given user has over the dashboard.
+//If the dashboard doesn't exist gorm.ErrRecordNotFound is returned
+func (d *Dashboard) GetAccess(ctx *config.AppContext, userID uint) (Access, error) {
+	/*
+	 * If the user is the owner, the user has all the rights
+	 * We will then check the user mappings of the dashboard for the shared rights
+	 * If the dashboard is public, the user can view the dashboard
+	 */
+	//owner of the dashboard
+	if d.UserID == userID {
+		return Access{Owner: true, View: true, Edit: true, Share: true, Manage: true}, nil
+	}
+
+	//checking the user mappings
+	a := Access{View: d.IsPublic}
+	m := &DashboardUserMappings{}
+	err := ctx.Db.Where("dashboard_id = ? AND user_id = ?", d.ID, userID).First(m).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		//error while getting the user mappings of the dashboard
+		ctx.Log.Error("error while getting the user mapping of the dashboard", d.ID, "for the user", userID, err)
+		return a, err
+	}
+	if err == nil {
+		a.View = true
+		a.Edit = m.Edit
+		a.Share = m.Share
+		a.Manage = m.Manage
+	}
+	return a, nil
+}
+
+//CheckPermission checks whether the given user has the permission over the dashboard.
+//The dashboard should have been fetched before. If the user doesn't have the permission ErrPermissionDenied is returned
+func (d *Dashboard) CheckPermission(ctx *config.AppContext, userID uint, p Permission) error {
+	a, err := d.GetAccess(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !a.Has(p) {
+		ctx.Log.Warn("user", userID, "doesn't have the permission", p, "for the dashboard", d.ID)
+		return ErrPermissionDenied
+	}
+	return nil
+}
+
+//CheckDashboardPermission checks whether the given user has the permission over the dashboard with the given id.
+//If the dashboard doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func CheckDashboardPermission(ctx *config.AppContext, dashboardID, userID uint, p Permission) (*Dashboard, error) {
+	d := &Dashboard{}
+	err := ctx.Db.Where("id = ?", dashboardID).First(d).Error
+	if err != nil {
+		return nil, err
+	}
+	return d, d.CheckPermission(ctx, userID, p)
+}
+
+//CheckPagePermission checks whether the given user has the permission over the dashboard of the page with the given id.
+//If the page doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func CheckPagePermission(ctx *config.AppContext, pageID, userID uint, p Permission) (*DashboardPage, error) {
+	dp := &DashboardPage{}
+	err := ctx.Db.Where("id = ?", pageID).Preload("PageGridItems").First(dp).Error
+	if err != nil {
+		return nil, err
+	}
+	_, err = CheckDashboardPermission(ctx, dp.DashboardID, userID, p)
+	return dp, err
+}
+
+//CheckPermission checks whether the given user has the permission over the widget.
+//Creator of the widget has all the permissions. Other users get the permissions they have over any of the
+//dashboards the widget is added to. If the user doesn't have the permission ErrPermissionDenied is returned
+func (w *Widget) CheckPermission(ctx *config.AppContext, userID uint, p Permission) error {
+	/*
+	 * If the user created the widget, the user has all the permissions
+	 * Else we will get the dashboards in which the widget is present
+	 * If the user has the permission in any of the dashboards, then the user has the permission
+	 */
+	//creator of the widget
+	if w.UserID == userID {
+		return nil
+	}
+
+	//getting the dashboards of the widget
+	ds := []Dashboard{}
+	err := ctx.Db.Where("id IN ?", ctx.Db.Model(&DashboardPage{}).Select("dashboard_id").
+		Where("id IN ?", ctx.Db.Model(&PageGridItem{}).Select("dashboard_page_id").Where("widget_id = ?", w.ID).SubQuery()).
+		SubQuery()).Find(&ds).Error
+	if err != nil {
+		//error while getting the dashboards of the widget
+		ctx.Log.Error("error while getting the dashboards of the widget", w.ID, err)
+		return err
+	}
+
+	//checking the permissions in the dashboards
+	for i := range ds {
+		err = ds[i].CheckPermission(ctx, userID, p)
+		if err == nil {
+			return nil
+		}
+		if err != ErrPermissionDenied {
+			return err
+		}
+	}
+	ctx.Log.Warn("user", userID, "doesn't have the permission", p, "for the widget", w.ID)
+	return ErrPermissionDenied
+}
@@ -0,0 +1,171 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cuttle-ai/octopus/interpreter"
+)
+
+/*
+ * This file contains the schema of the result rows of the queries
+ */
+
+//ColumnType is the type of the values in a column of the result
+type ColumnType string
+
+const (
+	//ColumnString is the type of the text columns. Columns of unknown types are treated as text
+	ColumnString ColumnType = "string"
+	//ColumnInt is the type of the integer columns
+	ColumnInt ColumnType = "int"
+	//ColumnFloat is the type of the decimal columns
+	ColumnFloat ColumnType = "float"
+	//ColumnBool is the type of the boolean columns
+	ColumnBool ColumnType = "bool"
+	//ColumnTime is the type of the date and time columns
+	ColumnTime ColumnType = "time"
+)
+
+//ResultColumn is a column in the result rows of a query
+type ResultColumn struct {
+	//Name is the key of the column in the result rows
+	Name string
+	//DisplayName is the name of the column in the dictionary to be shown to the user
+	DisplayName string
+	//Description of the column in the dictionary
+	Description string
+	//DataType is the data type of the column in the dictionary
+	DataType string
+	//Type is the type of the values in the column
+	Type ColumnType
+	//Dimension is true if the column is a dimension and false if it is a measure. Aggregated columns are measures
+	Dimension bool
+	//AggregationFn is the aggregation applied on the column. It is empty if the column is not aggregated
+	AggregationFn string
+	//DateFormat is the format of the date values in the column
+	DateFormat string
+}
+
+//columnType returns the column type for the data type of a column in the dictionary
+func columnType(dataType string) ColumnType {
+	t := strings.ToLower(dataType)
+	switch {
+	case strings.Contains(t, "int"):
+		return ColumnInt
+	case strings.Contains(t, "float"), strings.Contains(t, "double"), strings.Contains(t, "decimal"),
+		strings.Contains(t, "numeric"), strings.Contains(t, "real"), strings.Contains(t, "number"):
+		return ColumnFloat
+	case strings.Contains(t, "bool"):
+		return ColumnBool
+	case strings.Contains(t, "date"), strings.Contains(t, "time"):
+		return ColumnTime
+	}
+	return ColumnString
+}
+
+//ResultSchema returns the columns of the result rows of the query in the order of its select list.
+//Types of the aggregated columns are the types of the aggregation results. The names of the columns are the ones
+//expected by ResultColumns, so the schema has to be reconciled with the result rows using ReconcileColumns
+func ResultSchema(q interpreter.Query) []ResultColumn {
+	names := ResultColumns(q)
+	res := []ResultColumn{}
+	for i, c := range q.Select {
+		t := columnType(c.DataType)
+		switch strings.ToLower(c.AggregationFn) {
+		case "count":
+			t = ColumnInt
+		case "avg":
+			t = ColumnFloat
+		}
+		display := strings.TrimSpace(string(c.Word))
+		if len(display) == 0 {
+			display = c.Name
+		}
+		res = append(res, ResultColumn{
+			Name:          names[i],
+			DisplayName:   display,
+			Description:   c.Description,
+			DataType:      c.DataType,
+			Type:          t,
+			Dimension:     c.Dimension && len(c.AggregationFn) == 0,
+			AggregationFn: c.AggregationFn,
+			DateFormat:    c.DateFormat,
+		})
+	}
+	return res
+}
+
+//valueType returns the column type of the given value from the datastore. Values of unknown types are treated as text
+func valueType(v interface{}) ColumnType {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return ColumnInt
+	case float32, float64:
+		return ColumnFloat
+	case bool:
+		return ColumnBool
+	case time.Time:
+		return ColumnTime
+	}
+	return ColumnString
+}
+
+//ReconcileColumns returns the columns of the schema matched with the keys of the given result row. Columns are matched
+//by their name and then case insensitively, taking the key of the row as their name. Columns missing in the row are dropped.
+//Keys of the row not matching any column are appended in the alphabetical order with the type of their value
+func ReconcileColumns(cols []ResultColumn, row map[string]interface{}) []ResultColumn {
+	/*
+	 * We will match the columns by their name
+	 * We will match the rest of the columns case insensitively
+	 * Then we will append the keys of the row not matched
+	 */
+	//matching the columns by their name
+	matched := make([]string, len(cols))
+	found := map[string]bool{}
+	for i, c := range cols {
+		if _, ok := row[c.Name]; ok && !found[c.Name] {
+			matched[i] = c.Name
+			found[c.Name] = true
+		}
+	}
+
+	//matching the columns case insensitively
+	keys := []string{}
+	for k := range row {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for i, c := range cols {
+		if len(matched[i]) != 0 {
+			continue
+		}
+		for _, k := range keys {
+			if !found[k] && strings.EqualFold(k, c.Name) {
+				matched[i] = k
+				found[k] = true
+				break
+			}
+		}
+	}
+	res := []ResultColumn{}
+	for i, c := range cols {
+		if len(matched[i]) != 0 {
+			c.Name = matched[i]
+			res = append(res, c)
+		}
+	}
+
+	//appending the keys not matched
+	for _, k := range keys {
+		if !found[k] {
+			res = append(res, ResultColumn{Name: k, DisplayName: k, Type: valueType(row[k])})
+		}
+	}
+	return res
+}
@@ -0,0 +1,57 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"reflect"
+	"testing"
+)
+
+/*
+ * This file contains the tests of the reconciliation of the result schema with the result rows
+ */
+
+func TestReconcileColumns(t *testing.T) {
+	cols := []ResultColumn{
+		{Name: "name", Type: ColumnString, Dimension: true},
+		{Name: "amount", Type: ColumnFloat, AggregationFn: "sum"},
+	}
+	cases := []struct {
+		name string
+		row  map[string]interface{}
+		res  []ResultColumn
+	}{
+		{
+			name: "keeps the columns matching the keys of the row",
+			row:  map[string]interface{}{"amount": 1.5, "name": "a"},
+			res:  cols,
+		},
+		{
+			name: "takes the keys of the row matching the columns case insensitively",
+			row:  map[string]interface{}{"NAME": "a", "amount": 1.5},
+			res: []ResultColumn{
+				{Name: "NAME", Type: ColumnString, Dimension: true},
+				{Name: "amount", Type: ColumnFloat, AggregationFn: "sum"},
+			},
+		},
+		{
+			name: "drops the missing columns and appends the keys not matched with the type of their value",
+			row:  map[string]interface{}{"name": "a", "sum_amount": int64(2), "count": 3},
+			res: []ResultColumn{
+				{Name: "name", Type: ColumnString, Dimension: true},
+				{Name: "count", DisplayName: "count", Type: ColumnInt},
+				{Name: "sum_amount", DisplayName: "sum_amount", Type: ColumnInt},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res := ReconcileColumns(cols, c.row)
+			if !reflect.DeepEqual(res, c.res) {
+				t.Errorf("expected the columns %v, got %v", c.res, res)
+			}
+		})
+	}
+}
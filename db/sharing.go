@@ -0,0 +1,176 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/jinzhu/gorm"
+)
+
+/*
+ * This file contains the database interactions for sharing the dashboards with other users
+ */
+
+//ErrAlreadyShared is returned when the dashboard is already shared with the user
+var ErrAlreadyShared = errors.New("dashboard is already shared with the user")
+
+//ErrInvalidCollaborator is returned when the collaborator can't be added to the dashboard. Eg:- owner of the dashboard
+var ErrInvalidCollaborator = errors.New("invalid collaborator for the dashboard")
+
+//canGrant checks whether the access allows granting the rights in the mapping
+func (a Access) canGrant(m DashboardUserMappings) bool {
+	return (!m.Share || a.Share) && (!m.Manage || a.Manage) && (!m.Edit || a.Edit)
+}
+
+//GetCollaborators returns the user mappings of the dashboard if the given user can view the dashboard.
+//If the dashboard doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func (d *Dashboard) GetCollaborators(ctx *config.AppContext, userID uint) ([]DashboardUserMappings, error) {
+	/*
+	 * We will check the permissions of the user
+	 * Then we will get the user mappings
+	 */
+	//checking the permissions
+	_, err := CheckDashboardPermission(ctx, d.ID, userID, PermissionView)
+	if err != nil {
+		return nil, err
+	}
+
+	//getting the user mappings
+	ms := []DashboardUserMappings{}
+	err = ctx.Db.Where("dashboard_id = ?", d.ID).Order("created_at ASC").Find(&ms).Error
+	return ms, err
+}
+
+//Share shares the dashboard with the user in the mapping. The given user should have either the share or
+//the manage permission and can only grant the rights the user holds.
+//If the dashboard doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func (d *Dashboard) Share(ctx *config.AppContext, userID uint, m *DashboardUserMappings) error {
+	/*
+	 * We will get the dashboard and the access of the user
+	 * We will validate the collaborator
+	 * We will check whether the user can grant the rights
+	 * We will check whether the dashboard is already shared with the collaborator
+	 * Then we will create the mapping unless a concurrent share has created it
+	 */
+	//getting the dashboard and the access
+	existing := &Dashboard{}
+	err := ctx.Db.Where("id = ?", d.ID).First(existing).Error
+	if err != nil {
+		return err
+	}
+	a, err := existing.GetAccess(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	//validating the collaborator
+	if m.UserID == 0 || m.UserID == existing.UserID {
+		return ErrInvalidCollaborator
+	}
+
+	//checking whether the user can grant the rights
+	if !(a.Share || a.Manage) || !a.canGrant(*m) {
+		ctx.Log.Warn("user", userID, "can't grant the rights to", m.UserID, "for the dashboard", d.ID)
+		return ErrPermissionDenied
+	}
+
+	//checking whether the dashboard is already shared with the collaborator
+	c := 0
+	err = ctx.Db.Model(&DashboardUserMappings{}).Where("dashboard_id = ? AND user_id = ?", d.ID, m.UserID).Count(&c).Error
+	if err != nil {
+		return err
+	}
+	if c != 0 {
+		return ErrAlreadyShared
+	}
+
+	//creating the mapping
+	m.ID = 0
+	m.DashboardID = d.ID
+	err = ctx.Db.Set("gorm:insert_option", "ON CONFLICT (dashboard_id, user_id) WHERE deleted_at IS NULL DO NOTHING").Create(m).Error
+	if err == sql.ErrNoRows {
+		//mapping was created by a concurrent share
+		return ErrAlreadyShared
+	}
+	return err
+}
+
+//UpdateCollaborator updates the rights of the collaborator in the mapping. The given user should have the manage permission
+//and can only grant the rights the user holds.
+//If the dashboard or the collaborator doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func (d *Dashboard) UpdateCollaborator(ctx *config.AppContext, userID uint, m *DashboardUserMappings) error {
+	/*
+	 * We will get the dashboard and the access of the user
+	 * We will check whether the user can grant the rights
+	 * Then we will update the mapping
+	 */
+	//getting the dashboard and the access
+	existing := &Dashboard{}
+	err := ctx.Db.Where("id = ?", d.ID).First(existing).Error
+	if err != nil {
+		return err
+	}
+	a, err := existing.GetAccess(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	//checking whether the user can grant the rights
+	if !a.Manage || !a.canGrant(*m) {
+		ctx.Log.Warn("user", userID, "can't update the rights of", m.UserID, "for the dashboard", d.ID)
+		return ErrPermissionDenied
+	}
+
+	//updating the mapping
+	res := ctx.Db.Model(&DashboardUserMappings{}).Where("dashboard_id = ? AND user_id = ?", d.ID, m.UserID).Updates(map[string]interface{}{
+		"share":  m.Share,
+		"manage": m.Manage,
+		"edit":   m.Edit,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	m.DashboardID = d.ID
+	return nil
+}
+
+//RevokeCollaborator revokes the access of the collaborator to the dashboard. The given user should have the manage permission.
+//Users can also revoke their own access.
+//If the dashboard or the collaborator doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func (d *Dashboard) RevokeCollaborator(ctx *config.AppContext, userID, collaboratorID uint) error {
+	/*
+	 * We will check the permissions of the user
+	 * Then we will delete the mapping
+	 */
+	//checking the permissions
+	p := PermissionManage
+	if userID == collaboratorID {
+		p = PermissionView
+	}
+	_, err := CheckDashboardPermission(ctx, d.ID, userID, p)
+	if err != nil {
+		return err
+	}
+
+	//deleting the mapping
+	res := ctx.Db.Where("dashboard_id = ? AND user_id = ?", d.ID, collaboratorID).Delete(&DashboardUserMappings{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
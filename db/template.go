@@ -0,0 +1,456 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus-service/dict"
+	"github.com/cuttle-ai/octopus/interpreter"
+	"github.com/jinzhu/gorm"
+)
+
+/*
+ * This file contains the database interactions for duplicating the dashboards and instantiating the templates
+ */
+
+//ErrMissingBinding is returned when a table parameter of a template doesn't have a binding while instantiating it
+var ErrMissingBinding = errors.New("binding for the table parameter of the template is missing")
+
+//InvalidBindingError is returned when the table bound to a table parameter of a template isn't in the dictionary
+//of the user or doesn't have a column used by the template
+type InvalidBindingError struct {
+	//Param is the table parameter
+	Param string
+	//Table is the uid of the table bound to the parameter
+	Table string
+	//Column is the column missing in the table. It is empty if the table isn't in the dictionary
+	Column string
+}
+
+func (i InvalidBindingError) Error() string {
+	if len(i.Column) == 0 {
+		return "table " + i.Table + " bound to " + i.Param + " isn't in the dictionary of the user"
+	}
+	return "table " + i.Table + " bound to " + i.Param + " doesn't have the column " + i.Column
+}
+
+//TableBinding is the table to which a table parameter in the template has to be pointed at.
+//The table is resolved by its uid from the dictionary of the user instantiating the template
+type TableBinding struct {
+	//UID is the uid of the table
+	UID string
+}
+
+//DuplicateOptions are the options for duplicating a dashboard
+type DuplicateOptions struct {
+	//Name of the new dashboard. Defaults to "Copy of " the name of the dashboard
+	Name string
+	//AsTemplate will save the copy as a template with the tables in the widget queries parameterized
+	AsTemplate bool
+	//Bindings has the tables to which the table parameters have to be pointed at when the dashboard is a template
+	Bindings map[string]TableBinding
+}
+
+//isTemplateParam checks whether the given table uid is a table parameter of a template
+func isTemplateParam(uid string) bool {
+	return strings.HasPrefix(uid, "{{") && strings.HasSuffix(uid, "}}")
+}
+
+//templateParam returns the table parameter for the given index
+func templateParam(i int) string {
+	return fmt.Sprintf("{{table_%d}}", i)
+}
+
+//copyQuery returns a copy of the query with the table uids replaced as per the given function
+func copyQuery(q interpreter.Query, replace func(t interpreter.TableNode) interpreter.TableNode) interpreter.Query {
+	/*
+	 * We will copy the tables with the replacement
+	 * Then we will point the columns to the replaced tables
+	 */
+	//copying the tables
+	uids := map[string]string{}
+	tables := map[string]interpreter.TableNode{}
+	for k, t := range q.Tables {
+		n := replace(t)
+		uids[t.UID] = n.UID
+		n.Children = append([]interpreter.ColumnNode{}, t.Children...)
+		for i := range n.Children {
+			n.Children[i].PUID = n.UID
+		}
+		if k == t.UID {
+			k = n.UID
+		}
+		tables[k] = n
+	}
+
+	//pointing the columns to the replaced tables
+	repoint := func(cols []interpreter.ColumnNode) []interpreter.ColumnNode {
+		res := append([]interpreter.ColumnNode{}, cols...)
+		for i := range res {
+			if uid, ok := uids[res[i].PUID]; ok {
+				res[i].PUID = uid
+			}
+		}
+		return res
+	}
+	c := q
+	c.Tables = tables
+	c.Select = repoint(q.Select)
+	c.GroupBy = repoint(q.GroupBy)
+	c.Filters = append([]interpreter.FilterNode{}, q.Filters...)
+	for i := range c.Filters {
+		if uid, ok := uids[c.Filters[i].Column.PUID]; ok {
+			c.Filters[i].Column.PUID = uid
+		}
+	}
+	c.Result = nil
+	return c
+}
+
+//parameterize returns the widgets with the tables in their queries replaced by the table parameters along with
+//the parameters used for the table uids. Same table across the widgets will be replaced by the same parameter
+func parameterize(ws []Widget) ([]Widget, map[string]string) {
+	/*
+	 * We will find the distinct tables across the widgets in a stable order
+	 * Then we will replace the tables with the parameters
+	 */
+	//finding the distinct tables
+	uids := []string{}
+	for _, w := range ws {
+		for _, t := range w.Query.Tables {
+			uids = append(uids, t.UID)
+		}
+	}
+	sort.Strings(uids)
+	params := map[string]string{}
+	for _, uid := range uids {
+		if _, ok := params[uid]; !ok {
+			params[uid] = templateParam(len(params) + 1)
+		}
+	}
+
+	//replacing the tables
+	res := []Widget{}
+	for _, w := range ws {
+		w.Query = copyQuery(w.Query, func(t interpreter.TableNode) interpreter.TableNode {
+			t.UID = params[t.UID]
+			t.DatastoreID = 0
+			return t
+		})
+		res = append(res, w)
+	}
+	return res, params
+}
+
+//bind returns the widgets with the table parameters in their queries replaced by the tables given in the bindings.
+//Bound tables are resolved from the given tables of the dictionary of the user. The columns used by the widgets should exist
+//in the bound tables and are pointed at the columns of the dictionary
+func bind(ws []Widget, bindings map[string]TableBinding, tables map[string]interpreter.TableNode) ([]Widget, error) {
+	/*
+	 * We will resolve the bindings from the dictionary
+	 * Then we will replace the parameters in the widgets with the resolved tables
+	 * Then we will resolve the columns used from the bound tables
+	 */
+	//resolving the bindings
+	resolved := map[string]interpreter.TableNode{}
+	for param, b := range bindings {
+		t, ok := tables[b.UID]
+		if !ok {
+			return nil, InvalidBindingError{Param: param, Table: b.UID}
+		}
+		resolved[param] = t
+	}
+
+	res := []Widget{}
+	for _, w := range ws {
+		//replacing the parameters
+		var err error
+		params := map[string]string{}
+		w.Query = copyQuery(w.Query, func(t interpreter.TableNode) interpreter.TableNode {
+			if !isTemplateParam(t.UID) {
+				return t
+			}
+			b, ok := resolved[t.UID]
+			if !ok {
+				err = ErrMissingBinding
+				return t
+			}
+			params[b.UID] = t.UID
+			t.UID, t.Word, t.Name, t.DatastoreID = b.UID, b.Word, b.Name, b.DatastoreID
+			return t
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		//resolving the columns
+		resolve := func(c *interpreter.ColumnNode) error {
+			param, ok := params[c.PUID]
+			if !ok {
+				return nil
+			}
+			dc, ok := dict.Column(resolved[param], c.Name)
+			if !ok {
+				return InvalidBindingError{Param: param, Table: c.PUID, Column: c.Name}
+			}
+			c.UID = dc.UID
+			return nil
+		}
+		for k, t := range w.Query.Tables {
+			for i := range t.Children {
+				if err = resolve(&t.Children[i]); err != nil {
+					return nil, err
+				}
+			}
+			w.Query.Tables[k] = t
+		}
+		for _, cols := range [][]interpreter.ColumnNode{w.Query.Select, w.Query.GroupBy} {
+			for i := range cols {
+				if err = resolve(&cols[i]); err != nil {
+					return nil, err
+				}
+			}
+		}
+		for i := range w.Query.Filters {
+			if err = resolve(&w.Query.Filters[i].Column); err != nil {
+				return nil, err
+			}
+		}
+		res = append(res, w)
+	}
+	return res, nil
+}
+
+//retargetFilters returns the copies of the filters with their tables replaced as per the given mapping of the table uids.
+//Filters of the tables not in the mapping are copied as such
+func retargetFilters(filters []DashboardFilter, uids map[string]string) []DashboardFilter {
+	res := []DashboardFilter{}
+	for _, f := range filters {
+		if uid, ok := uids[f.TableUID]; ok {
+			f.TableUID = uid
+		}
+		res = append(res, f)
+	}
+	return res
+}
+
+//TemplateParameters returns the table parameters used in the widgets of the template dashboard along with
+//the names of the tables they were created from. Pages of the dashboard should have been loaded before
+func (d *Dashboard) TemplateParameters(ctx *config.AppContext) (map[string]string, error) {
+	ws, err := d.GetWidgets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	params := map[string]string{}
+	for _, w := range ws {
+		for _, t := range w.Query.Tables {
+			if isTemplateParam(t.UID) {
+				params[t.UID] = t.Name
+			}
+		}
+	}
+	return params, nil
+}
+
+//Duplicate deep copies the dashboard along with its pages, page grid items, widgets and filters for the given user in a transaction.
+//If the dashboard is a template, the table parameters of the widgets are bound as per the options to the tables
+//in the dictionary of the user.
+//If the copy is saved as a template, tables of the widgets are parameterized.
+//The user should have the permission to view the dashboard.
+//If the dashboard doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func (d *Dashboard) Duplicate(ctx *config.AppContext, userID uint, opts DuplicateOptions) (*Dashboard, error) {
+	/*
+	 * We will get the dashboard along with its pages
+	 * We will get the widgets of the dashboard
+	 * We will bind or parameterize the widgets and the tables of the filters as per the options
+	 * Then we will create the copy of the dashboard along with its pages, widgets and filters
+	 */
+	//getting the dashboard
+	err := d.Get(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	//getting the widgets
+	ws, err := d.GetWidgets(ctx)
+	if err != nil {
+		ctx.Log.Error("error while getting the widgets of the dashboard", d.ID, err)
+		return nil, err
+	}
+
+	//binding or parameterizing the widgets and the filters. Copying a template as a template keeps the parameters as such
+	filters := d.Filters
+	if d.IsTemplate && !opts.AsTemplate {
+		ws, err = bind(ws, opts.Bindings, dict.Tables(userID))
+		if err != nil {
+			ctx.Log.Error("error while binding the table parameters of the template", d.ID, err)
+			return nil, err
+		}
+		uids := map[string]string{}
+		for param, b := range opts.Bindings {
+			uids[param] = b.UID
+		}
+		filters = retargetFilters(filters, uids)
+	}
+	if opts.AsTemplate && !d.IsTemplate {
+		var params map[string]string
+		ws, params = parameterize(ws)
+		filters = retargetFilters(filters, params)
+	}
+
+	//creating the copy
+	name := opts.Name
+	if len(name) == 0 {
+		name = "Copy of " + d.Name
+	}
+	nd := &Dashboard{
+		Name:           name,
+		Description:    d.Description,
+		UserID:         userID,
+		ShowNavigation: d.ShowNavigation,
+		Placement:      d.Placement,
+		IsTemplate:     opts.AsTemplate,
+	}
+	err = nd.createWithContent(ctx, d.DashboardPages, ws, filters)
+	if err != nil {
+		ctx.Log.Error("error while creating the copy of the dashboard", d.ID, err)
+		return nil, err
+	}
+	return nd, nil
+}
+
+//createWithContent creates the dashboard along with the copies of the given pages, their grid items, widgets and filters
+//in a transaction. Grid items of the pages refer to the widgets with their existing ids.
+//Widgets are created for the owner of the dashboard. The first version of the dashboard is recorded after creating it
+func (d *Dashboard) createWithContent(ctx *config.AppContext, pages []DashboardPage, ws []Widget, filters []DashboardFilter) error {
+	/*
+	 * We will start a transaction
+	 * We will create the dashboard
+	 * We will create the copies of the pages, widgets and filters
+	 * Then we will record the first version of the dashboard
+	 */
+	//starting the transaction
+	tx := ctx.Db.Begin()
+
+	//creating the dashboard
+	d.ID = 0
+	d.DashboardPages = nil
+	d.Filters = nil
+	err := tx.Create(d).Error
+	if err != nil {
+		//error while creating the dashboard
+		tx.Rollback()
+		ctx.Log.Error("error while creating the dashboard", err)
+		return err
+	}
+
+	//creating the copies of the pages, widgets and filters
+	err = d.createContent(ctx, tx, pages, ws)
+	if err == nil && len(filters) != 0 {
+		d.Filters, err = replaceFilters(ctx, tx, d.ID, filters)
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return err
+	}
+
+	//recording the first version
+	recordChange(ctx, d.ID, d.UserID)
+	return nil
+}
+
+//createContent creates the copies of the given pages, their grid items and widgets for the dashboard in the given transaction.
+//Grid items of the pages refer to the widgets with their existing ids. Widgets are created for the owner of the dashboard.
+//The caller has to rollback the transaction on error
+func (d *Dashboard) createContent(ctx *config.AppContext, tx *gorm.DB, pages []DashboardPage, ws []Widget) error {
+	/*
+	 * We will create the copies of the widgets
+	 * Then we will create the copies of the pages and their grid items
+	 */
+	//creating the copies of the widgets
+	widgetIDs := map[uint]uint{}
+	for _, w := range ws {
+		oldID := w.ID
+		err := d.createWidget(tx, &w)
+		if err != nil {
+			//error while creating the copy of the widget
+			ctx.Log.Error("error while creating the copy of the widget", oldID, err)
+			return err
+		}
+		widgetIDs[oldID] = w.ID
+	}
+
+	//creating the copies of the pages and their grid items
+	return d.createPages(ctx, tx, pages, widgetIDs)
+}
+
+//createWidget creates the copy of the widget for the owner of the dashboard in the given transaction.
+//The copy is private and not refreshed yet
+func (d *Dashboard) createWidget(tx *gorm.DB, w *Widget) error {
+	w.Model = gorm.Model{}
+	w.UserID = d.UserID
+	w.IsPublic = false
+	w.LastRefreshedAt = nil
+	return tx.Create(w).Error
+}
+
+//createPages creates the copies of the given pages and their grid items for the dashboard in the given transaction.
+//Grid items are pointed at the widgets as per the given mapping of the existing widget ids to the new ones.
+//Grid items whose widgets aren't in the mapping are skipped. The caller has to rollback the transaction on error
+func (d *Dashboard) createPages(ctx *config.AppContext, tx *gorm.DB, pages []DashboardPage, widgetIDs map[uint]uint) error {
+	d.DashboardPages = nil
+	for _, p := range pages {
+		np := &DashboardPage{
+			DashboardID:    d.ID,
+			Name:           p.Name,
+			Number:         p.Number,
+			GridSize:       p.GridSize,
+			Width:          p.Width,
+			Height:         p.Height,
+			HasWidgetAdded: p.HasWidgetAdded,
+		}
+		err := tx.Create(np).Error
+		if err != nil {
+			//error while creating the copy of the page
+			ctx.Log.Error("error while creating the copy of the page", p.ID, err)
+			return err
+		}
+		for _, item := range p.PageGridItems {
+			widgetID, ok := widgetIDs[item.WidgetID]
+			if !ok {
+				//widget of the grid item doesn't exist anymore
+				ctx.Log.Warn("skipping the page grid item", item.ID, "as its widget", item.WidgetID, "couldn't be found")
+				continue
+			}
+			ni := &PageGridItem{
+				DashboardPageID: np.ID,
+				WidgetID:        widgetID,
+				X:               item.X,
+				Y:               item.Y,
+				Width:           item.Width,
+				Height:          item.Height,
+			}
+			err = tx.Create(ni).Error
+			if err != nil {
+				//error while creating the copy of the page grid item
+				ctx.Log.Error("error while creating the copy of the page grid item", item.ID, err)
+				return err
+			}
+			np.PageGridItems = append(np.PageGridItems, *ni)
+		}
+		d.DashboardPages = append(d.DashboardPages, *np)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/cuttle-ai/octopus/interpreter"
+)
+
+/*
+ * This file contains the tests of the parameterization of the dashboard templates and their binding to the tables
+ */
+
+func TestParameterize(t *testing.T) {
+	orders := interpreter.TableNode{UID: "o", Name: "orders", DatastoreID: 1, Children: []interpreter.ColumnNode{{UID: "o1", Name: "amount", PUID: "o"}}}
+	customers := interpreter.TableNode{UID: "c", Name: "customers", DatastoreID: 2}
+	ws := []Widget{
+		{Query: interpreter.Query{
+			Tables: testTables(orders),
+			Select: []interpreter.ColumnNode{{UID: "o1", Name: "amount", PUID: "o"}},
+		}},
+		{Query: interpreter.Query{
+			Tables:  testTables(orders, customers),
+			Select:  []interpreter.ColumnNode{{Name: "name", PUID: "c"}},
+			Filters: []interpreter.FilterNode{{Column: interpreter.ColumnNode{Name: "amount", PUID: "o"}, Operation: ">", Value: "1"}},
+		}},
+	}
+	res, params := parameterize(ws)
+	if exp := map[string]string{"c": "{{table_1}}", "o": "{{table_2}}"}; !reflect.DeepEqual(params, exp) {
+		t.Fatalf("expected the parameters %v, got %v", exp, params)
+	}
+	pOrders := interpreter.TableNode{UID: "{{table_2}}", Name: "orders", Children: []interpreter.ColumnNode{{UID: "o1", Name: "amount", PUID: "{{table_2}}"}}}
+	pCustomers := interpreter.TableNode{UID: "{{table_1}}", Name: "customers", Children: []interpreter.ColumnNode{}}
+	if exp := testTables(pOrders); !reflect.DeepEqual(res[0].Query.Tables, exp) {
+		t.Errorf("expected the tables %v, got %v", exp, res[0].Query.Tables)
+	}
+	if exp := testTables(pOrders, pCustomers); !reflect.DeepEqual(res[1].Query.Tables, exp) {
+		t.Errorf("expected the tables %v, got %v", exp, res[1].Query.Tables)
+	}
+	if puid := res[1].Query.Select[0].PUID; puid != "{{table_1}}" {
+		t.Errorf("expected the selected column to point at {{table_1}}, got %s", puid)
+	}
+	if puid := res[1].Query.Filters[0].Column.PUID; puid != "{{table_2}}" {
+		t.Errorf("expected the filtered column to point at {{table_2}}, got %s", puid)
+	}
+	if ws[1].Query.Select[0].PUID != "c" || ws[1].Query.Filters[0].Column.PUID != "o" {
+		t.Errorf("expected the queries of the given widgets not to be modified, got %v", ws[1].Query)
+	}
+}
+
+func TestBind(t *testing.T) {
+	param := "{{table_1}}"
+	ws := []Widget{{Query: interpreter.Query{
+		Tables: testTables(interpreter.TableNode{UID: param, Name: "orders", Children: []interpreter.ColumnNode{{Name: "amount", PUID: param}}}),
+		Select: []interpreter.ColumnNode{{Name: "amount", PUID: param, AggregationFn: "sum"}},
+	}}}
+	sales := interpreter.TableNode{UID: "s", Word: []rune("sales"), Name: "sales", DatastoreID: 3, Children: []interpreter.ColumnNode{{UID: "s1", Name: "amount", PUID: "s"}}}
+	users := interpreter.TableNode{UID: "u", Name: "users", DatastoreID: 3, Children: []interpreter.ColumnNode{{UID: "u1", Name: "name", PUID: "u"}}}
+	tables := testTables(sales, users)
+	cases := []struct {
+		name     string
+		bindings map[string]TableBinding
+		tables   map[string]interpreter.TableNode
+		selected []interpreter.ColumnNode
+		err      error
+	}{
+		{
+			name:     "points the parameters and the columns at the bound tables",
+			bindings: map[string]TableBinding{param: {UID: "s"}},
+			tables: testTables(interpreter.TableNode{UID: "s", Word: []rune("sales"), Name: "sales", DatastoreID: 3,
+				Children: []interpreter.ColumnNode{{UID: "s1", Name: "amount", PUID: "s"}}}),
+			selected: []interpreter.ColumnNode{{UID: "s1", Name: "amount", PUID: "s", AggregationFn: "sum"}},
+		},
+		{
+			name: "fails if a parameter doesn't have a binding",
+			err:  ErrMissingBinding,
+		},
+		{
+			name:     "fails if the bound table isn't in the dictionary",
+			bindings: map[string]TableBinding{param: {UID: "x"}},
+			err:      InvalidBindingError{Param: param, Table: "x"},
+		},
+		{
+			name:     "fails if the bound table doesn't have a column used",
+			bindings: map[string]TableBinding{param: {UID: "u"}},
+			err:      InvalidBindingError{Param: param, Table: "u", Column: "amount"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			res, err := bind(ws, c.bindings, tables)
+			if !reflect.DeepEqual(err, c.err) {
+				t.Fatalf("expected the error %v, got %v", c.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if !reflect.DeepEqual(res[0].Query.Tables, c.tables) {
+				t.Errorf("expected the tables %v, got %v", c.tables, res[0].Query.Tables)
+			}
+			if !reflect.DeepEqual(res[0].Query.Select, c.selected) {
+				t.Errorf("expected the selected columns %v, got %v", c.selected, res[0].Query.Select)
+			}
+		})
+	}
+}
+
+func TestRetargetFilters(t *testing.T) {
+	filters := []DashboardFilter{{TableUID: "o", Column: "amount"}, {TableUID: "x", Column: "name"}, {Column: "date"}}
+	res := retargetFilters(filters, map[string]string{"o": "{{table_1}}"})
+	exp := []DashboardFilter{{TableUID: "{{table_1}}", Column: "amount"}, {TableUID: "x", Column: "name"}, {Column: "date"}}
+	if !reflect.DeepEqual(res, exp) {
+		t.Errorf("expected the filters %v, got %v", exp, res)
+	}
+	if filters[0].TableUID != "o" {
+		t.Errorf("expected the given filters not to be modified, got %v", filters)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"time"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/jinzhu/gorm"
+)
+
+/*
+ * This file contains the database interactions for the trash bin of the soft deleted dashboards
+ */
+
+//GetTrash returns the soft deleted dashboards of the given user, latest deleted first. Pages of the dashboards won't be loaded
+func GetTrash(ctx *config.AppContext, userID uint) ([]Dashboard, error) {
+	ds := []Dashboard{}
+	err := ctx.Db.Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", userID).Order("deleted_at DESC").Find(&ds).Error
+	return ds, err
+}
+
+//RestoreFromTrash un-deletes the soft deleted dashboard along with the pages, page grid items and filters deleted along with it.
+//Pages and grid items deleted before the dashboard was deleted remain deleted. Only the owner can restore the dashboard.
+//The restore is recorded as a new version of the dashboard.
+//If the dashboard doesn't exist in the trash gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func (d *Dashboard) RestoreFromTrash(ctx *config.AppContext, userID uint) error {
+	/*
+	 * We will get the dashboard from the trash
+	 * We will check the permissions of the user
+	 * We will start a transaction
+	 * We will restore the page grid items deleted along with the dashboard
+	 * We will restore the pages deleted along with the dashboard
+	 * We will restore the filters
+	 * We will restore the dashboard
+	 * Then we will record the change as a new version
+	 */
+	//getting the dashboard from the trash
+	err := ctx.Db.Unscoped().Where("id = ? AND deleted_at IS NOT NULL", d.ID).First(d).Error
+	if err != nil {
+		return err
+	}
+	deletedAt := *d.DeletedAt
+
+	//checking the permissions
+	err = d.CheckPermission(ctx, userID, PermissionOwner)
+	if err != nil {
+		return err
+	}
+
+	//starting the transaction
+	tx := ctx.Db.Begin()
+
+	//restoring the page grid items
+	err = tx.Unscoped().Model(&PageGridItem{}).
+		Where("deleted_at >= ? AND dashboard_page_id IN ?", deletedAt,
+			tx.Unscoped().Model(&DashboardPage{}).Select("id").Where("dashboard_id = ? AND deleted_at >= ?", d.ID, deletedAt).SubQuery()).
+		UpdateColumn("deleted_at", nil).Error
+	if err != nil {
+		//error while restoring the page grid items
+		tx.Rollback()
+		ctx.Log.Error("error while restoring the page grid items of the dashboard", d.ID, err)
+		return err
+	}
+
+	//restoring the pages
+	err = tx.Unscoped().Model(&DashboardPage{}).Where("dashboard_id = ? AND deleted_at >= ?", d.ID, deletedAt).
+		UpdateColumn("deleted_at", nil).Error
+	if err != nil {
+		//error while restoring the pages
+		tx.Rollback()
+		ctx.Log.Error("error while restoring the pages of the dashboard", d.ID, err)
+		return err
+	}
+
+	//restoring the filters
+	err = tx.Unscoped().Model(&DashboardFilter{}).Where("dashboard_id = ? AND deleted_at >= ?", d.ID, deletedAt).
+		UpdateColumn("deleted_at", nil).Error
+	if err != nil {
+		//error while restoring the filters
+		tx.Rollback()
+		ctx.Log.Error("error while restoring the filters of the dashboard", d.ID, err)
+		return err
+	}
+
+	//restoring the dashboard
+	err = tx.Unscoped().Model(&Dashboard{}).Where("id = ?", d.ID).UpdateColumn("deleted_at", nil).Error
+	if err != nil {
+		//error while restoring the dashboard
+		tx.Rollback()
+		ctx.Log.Error("error while restoring the dashboard", d.ID, err)
+		return err
+	}
+	d.DeletedAt = nil
+	err = tx.Commit().Error
+	if err != nil {
+		return err
+	}
+
+	//recording the change
+	recordChange(ctx, d.ID, userID)
+	return nil
+}
+
+//PurgeTrash hard deletes the dashboards, pages, page grid items and filters soft deleted before the given time in a transaction.
+//Versions and the user mappings of the purged dashboards are deleted as well
+func PurgeTrash(ctx *config.AppContext, before time.Time) error {
+	/*
+	 * We will start a transaction
+	 * We will delete the versions and the user mappings of the dashboards to be purged
+	 * We will purge the page grid items, pages and filters
+	 * Then we will purge the dashboards
+	 */
+	//starting the transaction
+	tx := ctx.Db.Begin()
+
+	//deleting the versions and the user mappings
+	purged := tx.Unscoped().Model(&Dashboard{}).Select("id").Where("deleted_at < ?", before).SubQuery()
+	for _, m := range []interface{}{&DashboardVersion{}, &DashboardUserMappings{}} {
+		err := tx.Unscoped().Where("dashboard_id IN ?", purged).Delete(m).Error
+		if err != nil {
+			//error while deleting the records of the purged dashboards
+			tx.Rollback()
+			ctx.Log.Error("error while deleting the records of the dashboards in trash", err)
+			return err
+		}
+	}
+
+	//purging the page grid items, pages, filters and then the dashboards
+	for _, m := range []interface{}{&PageGridItem{}, &DashboardPage{}, &DashboardFilter{}, &Dashboard{}} {
+		err := tx.Unscoped().Where("deleted_at < ?", before).Delete(m).Error
+		if err != nil {
+			//error while purging the trash
+			tx.Rollback()
+			ctx.Log.Error("error while purging the trash", err)
+			return err
+		}
+	}
+
+	return tx.Commit().Error
+}
+
+//PurgeTrashCheck is to be used as a go routine which periodically purges the trash items older than the retention period
+func PurgeTrashCheck(ctx *config.AppContext) {
+	/*
+	 * We will check whether the database is enabled
+	 * Then we will go into a infinte for loop purging the trash periodically
+	 */
+	//checking whether the database is enabled
+	if ctx.Db == nil {
+		ctx.Log.Info("database is not enabled. So trash won't be purged")
+		return
+	}
+
+	//purging the trash periodically
+	for {
+		err := PurgeTrash(ctx, gorm.NowFunc().Add(-config.TrashRetention))
+		if err != nil {
+			ctx.Log.Error("error while purging the trash", err)
+		}
+		time.Sleep(config.TrashPurgeCheck)
+	}
+}
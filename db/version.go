@@ -0,0 +1,318 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package db
+
+import (
+	"encoding/json"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/jinzhu/gorm"
+)
+
+/*
+ * This file contains the database interactions for the version history of the dashboards
+ */
+
+//DashboardVersion is a snapshot of the layout of the dashboard recorded on each change to it
+type DashboardVersion struct {
+	gorm.Model
+	//DashboardID  is the id of the dashboard
+	DashboardID uint
+	//Revision is the version number of the dashboard starting from 1
+	Revision uint
+	//UserID of the user who made the change
+	UserID uint
+	//RestoredFrom is the revision from which this version was restored. 0 if the version is not a restore
+	RestoredFrom uint
+	//Snapshot has the pages, grid items and widget definitions of the dashboard. It is persisted as json in SnapshotJSON
+	Snapshot *DashboardExport `gorm:"-" json:",omitempty"`
+	//SnapshotJSON is the json serialized form of the snapshot
+	SnapshotJSON string `gorm:"type:text" json:"-"`
+}
+
+//BeforeSave will serialize the snapshot of the version before saving it
+func (v *DashboardVersion) BeforeSave() error {
+	if v.Snapshot == nil {
+		return nil
+	}
+	b, err := json.Marshal(v.Snapshot)
+	if err != nil {
+		return err
+	}
+	v.SnapshotJSON = string(b)
+	return nil
+}
+
+//AfterFind will deserialize the snapshot of the version after fetching it
+func (v *DashboardVersion) AfterFind() error {
+	if len(v.SnapshotJSON) == 0 {
+		return nil
+	}
+	v.Snapshot = &DashboardExport{}
+	return json.Unmarshal([]byte(v.SnapshotJSON), v.Snapshot)
+}
+
+//recordVersion records the current layout of the dashboard with the given id as its next revision
+func recordVersion(ctx *config.AppContext, dashboardID, userID, restoredFrom uint) (*DashboardVersion, error) {
+	/*
+	 * We will get the dashboard along with its pages
+	 * We will build the snapshot of the dashboard
+	 * We will start a transaction
+	 * We will lock the dashboard and find the next revision
+	 * Then we will create the version
+	 */
+	//getting the dashboard
+	d := &Dashboard{}
+	err := preloadLayout(ctx.Db).Where("id = ?", dashboardID).First(d).Error
+	if err != nil {
+		return nil, err
+	}
+
+	//building the snapshot
+	doc, err := d.document(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	//starting the transaction
+	tx := ctx.Db.Begin()
+
+	//finding the next revision
+	err = tx.Set("gorm:query_option", "FOR UPDATE").Where("id = ?", dashboardID).First(&Dashboard{}).Error
+	if err != nil {
+		//error while locking the dashboard
+		tx.Rollback()
+		return nil, err
+	}
+	var last uint
+	err = tx.Model(&DashboardVersion{}).Where("dashboard_id = ?", dashboardID).Select("COALESCE(MAX(revision), 0)").Row().Scan(&last)
+	if err != nil {
+		//error while finding the last revision of the dashboard
+		tx.Rollback()
+		return nil, err
+	}
+
+	//creating the version
+	v := &DashboardVersion{DashboardID: dashboardID, Revision: last + 1, UserID: userID, RestoredFrom: restoredFrom, Snapshot: doc}
+	err = tx.Create(v).Error
+	if err != nil {
+		//error while creating the version
+		tx.Rollback()
+		return nil, err
+	}
+	return v, tx.Commit().Error
+}
+
+//recordChange records the current layout of the dashboard as a new version after a change made by the given user.
+//The change has already been made. So failures are only logged
+func recordChange(ctx *config.AppContext, dashboardID, userID uint) {
+	_, err := recordVersion(ctx, dashboardID, userID, 0)
+	if err != nil {
+		ctx.Log.Error("error while recording the version of the dashboard", dashboardID, err)
+	}
+}
+
+//GetVersions returns the version history of the dashboard without the snapshots, latest first.
+//The user should have the permission to view the dashboard.
+//If the dashboard doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func (d *Dashboard) GetVersions(ctx *config.AppContext, userID uint) ([]DashboardVersion, error) {
+	/*
+	 * We will check the permissions of the user
+	 * Then we will get the versions
+	 */
+	//checking the permissions
+	_, err := CheckDashboardPermission(ctx, d.ID, userID, PermissionView)
+	if err != nil {
+		return nil, err
+	}
+
+	//getting the versions
+	vs := []DashboardVersion{}
+	err = ctx.Db.Select("id, created_at, updated_at, deleted_at, dashboard_id, revision, user_id, restored_from").
+		Where("dashboard_id = ?", d.ID).Order("revision DESC").Find(&vs).Error
+	return vs, err
+}
+
+//GetVersion returns the given revision of the dashboard along with its snapshot.
+//The user should have the permission to view the dashboard.
+//If the dashboard or the revision doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func (d *Dashboard) GetVersion(ctx *config.AppContext, userID, revision uint) (*DashboardVersion, error) {
+	/*
+	 * We will check the permissions of the user
+	 * Then we will get the version
+	 */
+	//checking the permissions
+	_, err := CheckDashboardPermission(ctx, d.ID, userID, PermissionView)
+	if err != nil {
+		return nil, err
+	}
+
+	//getting the version
+	v := &DashboardVersion{}
+	err = ctx.Db.Where("dashboard_id = ? AND revision = ?", d.ID, revision).First(v).Error
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+//Restore replaces the layout of the dashboard with the given revision in a transaction and records it as a new revision.
+//Widgets of the revision are restored in place keeping their public access. Widgets which don't exist anymore are recreated.
+//Filters of the dashboard are replaced by the ones in the revision if the revision has them.
+//The user should have the permission to edit the dashboard.
+//If the dashboard or the revision doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func (d *Dashboard) Restore(ctx *config.AppContext, userID, revision uint) (*DashboardVersion, error) {
+	/*
+	 * We will check the permissions of the user
+	 * We will get the version to be restored
+	 * We will start a transaction which is rolled back unless committed
+	 * We will delete the existing page grid items and pages
+	 * We will update the dashboard with the details in the snapshot
+	 * We will restore the widgets in the snapshot
+	 * We will create the pages in the snapshot
+	 * We will restore the filters in the snapshot
+	 * We will update whether the dashboard has public widgets
+	 * Then we will record the restored layout as a new revision
+	 */
+	//checking the permissions
+	existing, err := CheckDashboardPermission(ctx, d.ID, userID, PermissionEdit)
+	if err != nil {
+		return nil, err
+	}
+
+	//getting the version
+	v := &DashboardVersion{}
+	err = ctx.Db.Where("dashboard_id = ? AND revision = ?", d.ID, revision).First(v).Error
+	if err != nil {
+		return nil, err
+	}
+	if v.Snapshot == nil {
+		ctx.Log.Error("snapshot is missing for the revision", revision, "of the dashboard", d.ID)
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	//starting the transaction
+	tx := ctx.Db.Begin()
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+
+	//deleting the existing page grid items and pages
+	err = tx.Where("dashboard_page_id IN ?", tx.Model(&DashboardPage{}).Select("id").Where("dashboard_id = ?", d.ID).SubQuery()).
+		Delete(&PageGridItem{}).Error
+	if err != nil {
+		//error while deleting the page grid items
+		ctx.Log.Error("error while deleting the page grid items of the dashboard", d.ID, err)
+		return nil, err
+	}
+	err = tx.Where("dashboard_id = ?", d.ID).Delete(&DashboardPage{}).Error
+	if err != nil {
+		//error while deleting the pages
+		ctx.Log.Error("error while deleting the pages of the dashboard", d.ID, err)
+		return nil, err
+	}
+
+	//updating the dashboard
+	doc := v.Snapshot
+	err = tx.Model(&Dashboard{}).Where("id = ?", d.ID).Updates(map[string]interface{}{
+		"name":            doc.Name,
+		"description":     doc.Description,
+		"show_navigation": doc.ShowNavigation,
+		"placement":       doc.Placement,
+	}).Error
+	if err != nil {
+		//error while updating the dashboard
+		ctx.Log.Error("error while updating the dashboard", d.ID, err)
+		return nil, err
+	}
+
+	//restoring the widgets
+	pages, ws := doc.content()
+	widgetIDs := map[uint]uint{}
+	for i, w := range ws {
+		ref := w.ID
+		err = existing.restoreWidget(tx, doc.Widgets[i].ID, &w)
+		if err != nil {
+			//error while restoring the widget
+			ctx.Log.Error("error while restoring the widget", doc.Widgets[i].ID, "of the dashboard", d.ID, err)
+			return nil, err
+		}
+		widgetIDs[ref] = w.ID
+	}
+
+	//creating the pages
+	err = existing.createPages(ctx, tx, pages, widgetIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	//restoring the filters
+	if doc.Filters != nil {
+		_, err = replaceFilters(ctx, tx, d.ID, doc.filters())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//updating whether the dashboard has public widgets
+	err = syncPublicWidgets(tx, "id = ?", d.ID)
+	if err != nil {
+		ctx.Log.Error("error while updating the public widgets of the dashboard", d.ID, err)
+		return nil, err
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return nil, err
+	}
+	committed = true
+
+	//recording the new revision
+	return recordVersion(ctx, d.ID, userID, revision)
+}
+
+//restoreWidget restores the widget with the given id to the definition in the given widget in the given transaction.
+//Deleted widget is undeleted. If the widget doesn't exist anymore, it is recreated for the owner of the dashboard.
+//The id of the restored widget is set in the given widget. The caller has to rollback the transaction on error
+func (d *Dashboard) restoreWidget(tx *gorm.DB, id uint, w *Widget) error {
+	/*
+	 * We will serialize the query and the visualization of the widget
+	 * We will update the existing widget
+	 * If the widget doesn't exist, we will recreate it
+	 */
+	//serializing the query and the visualization
+	err := w.BeforeSave()
+	if err != nil {
+		return err
+	}
+
+	//updating the existing widget
+	if id != 0 {
+		res := tx.Unscoped().Model(&Widget{}).Where("id = ?", id).UpdateColumns(map[string]interface{}{
+			"title":              w.Title,
+			"nl":                 w.NL,
+			"query_json":         w.QueryJSON,
+			"visualization_json": w.VisualizationJSON,
+			"refresh_interval":   w.RefreshInterval,
+			"updated_at":         gorm.NowFunc(),
+			"deleted_at":         nil,
+		})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected != 0 {
+			w.ID = id
+			return nil
+		}
+	}
+
+	//recreating the widget
+	return d.createWidget(tx, w)
+}
@@ -4,7 +4,17 @@
 
 package db
 
-import "github.com/jinzhu/gorm"
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cuttle-ai/brain/visualization"
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus/interpreter"
+	"github.com/jinzhu/gorm"
+)
 
 /*
  * This file contains the defition of the widget in the dashboard
@@ -13,4 +23,289 @@ import "github.com/jinzhu/gorm"
 //Widget represents a widget which can be a visualization or something else in a dashboard page
 type Widget struct {
 	gorm.Model
+	//UserID of the user who created the widget
+	UserID uint
+	//Title of the widget
+	Title string
+	//NL is the natural language query of the widget
+	NL string
+	//Query is the interpreted query of the widget. It is persisted as json in QueryJSON
+	Query interpreter.Query `gorm:"-"`
+	//QueryJSON is the json serialized form of the interpreted query
+	QueryJSON string `gorm:"type:text" json:"-"`
+	//Visualization is the visualization chosen for the widget. It is persisted as json in VisualizationJSON
+	Visualization visualization.Visualization `gorm:"-"`
+	//VisualizationJSON is the json serialized form of the visualization
+	VisualizationJSON string `gorm:"type:text" json:"-"`
+	//RefreshInterval is the interval in seconds after which the widget data has to be refreshed. 0 means no auto refresh
+	RefreshInterval uint
+	//LastRefreshedAt is the time at which the widget data was last refreshed
+	LastRefreshedAt *time.Time
+	//IsPublic indicates whether the widget can be viewed without logging in
+	IsPublic bool
+}
+
+//WidgetResult has the widget along with the result of its query
+type WidgetResult struct {
+	//Widget is the widget whose query has been executed
+	Widget Widget
+	//Result is the result of the widget query
+	Result []map[string]interface{}
+	//Error is the error occurred while executing the widget query if any
+	Error string
+	//Cache has the details of the result cache usage while executing the widget query
+	Cache *CacheStatus `json:",omitempty"`
+}
+
+//widgetSizes has the default size (width, height) of the widget in grid units for each visualization type
+var widgetSizes = map[string][2]uint{
+	"table":  {60, 40},
+	"line":   {50, 30},
+	"bar":    {50, 30},
+	"column": {50, 30},
+	"area":   {50, 30},
+	"pie":    {30, 30},
+	"donut":  {30, 30},
+	"kpi":    {20, 10},
+	"number": {20, 10},
+}
+
+//defaultWidgetSize is the size (width, height) of the widget in grid units for unknown visualization types
+var defaultWidgetSize = [2]uint{40, 30}
+
+//WidgetSize returns the width and height in grid units to be used for a widget with the given visualization
+func WidgetSize(v visualization.Visualization) (uint, uint) {
+	s, ok := widgetSizes[strings.ToLower(v.Type)]
+	if !ok {
+		s = defaultWidgetSize
+	}
+	return s[0], s[1]
+}
+
+//BeforeSave will serialize the query and the visualization of the widget before saving it
+func (w *Widget) BeforeSave() error {
+	/*
+	 * We will serialize the query without the result
+	 * Then we will serialize the visualization
+	 */
+	//serializing the query
+	q := w.Query
+	q.Result = nil
+	b, err := json.Marshal(q)
+	if err != nil {
+		return err
+	}
+	w.QueryJSON = string(b)
+
+	//serializing the visualization
+	b, err = json.Marshal(w.Visualization)
+	if err != nil {
+		return err
+	}
+	w.VisualizationJSON = string(b)
+	return nil
+}
+
+//AfterFind will deserialize the query and the visualization of the widget after fetching it
+func (w *Widget) AfterFind() error {
+	if len(w.QueryJSON) != 0 {
+		if err := json.Unmarshal([]byte(w.QueryJSON), &w.Query); err != nil {
+			return err
+		}
+	}
+	if len(w.VisualizationJSON) != 0 {
+		if err := json.Unmarshal([]byte(w.VisualizationJSON), &w.Visualization); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//Create creates the widget
+func (w *Widget) Create(ctx *config.AppContext) error {
+	w.ID = 0
+	return ctx.Db.Create(w).Error
+}
+
+//Get fetches the widget with the given id if the given user can view it.
+//If the widget doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func (w *Widget) Get(ctx *config.AppContext, userID uint) error {
+	err := ctx.Db.Where("id = ?", w.ID).First(w).Error
+	if err != nil {
+		return err
+	}
+	return w.CheckPermission(ctx, userID, PermissionView)
+}
+
+//Execute will execute the query of the widget using the given result cache and return the result.
+//The widget is not modified, so it can be used for the read only views of the widget
+func (w *Widget) Execute(ctx *config.AppContext, ec *ExecCache) ([]map[string]interface{}, error) {
+	res, err := ExecWithCache(*ctx, w.Query, ec)
+	if err != nil {
+		//error while executing the widget query
+		ctx.Log.Error("error while executing the query of the widget", w.ID, err)
+		return nil, err
+	}
+	return res, nil
+}
+
+//Refresh will execute the query of the widget using the given result cache and return the result.
+//It also updates the last refreshed time of the widget unless the result was served from the cache.
+//The time at which a cached result was fetched is in the cache status of the execution
+func (w *Widget) Refresh(ctx *config.AppContext, ec *ExecCache) ([]map[string]interface{}, error) {
+	/*
+	 * We will execute the query
+	 * Then we will update the last refreshed time if the result wasn't served from the cache
+	 */
+	//executing the query
+	res, err := w.Execute(ctx, ec)
+	if err != nil {
+		return nil, err
+	}
+
+	//updating the last refreshed time
+	if ec != nil && ec.Status.Hit {
+		return res, nil
+	}
+	n := time.Now()
+	err = ctx.Db.Model(&Widget{}).Where("id = ?", w.ID).UpdateColumn("last_refreshed_at", n).Error
+	if err != nil {
+		//error while updating the last refreshed time
+		ctx.Log.Error("error while updating the last refreshed time of the widget", w.ID, err)
+		return nil, err
+	}
+	w.LastRefreshedAt = &n
+	return res, nil
+}
+
+//RefreshWidgets executes the queries of the given widgets concurrently with a bounded no. of workers and updates
+//their last refreshed time if their result wasn't served from the cache. Results are returned in the order of the widgets. Failure of a widget is reported in its
+//result without failing the others. If noCache is true, the queries are executed in the datastores without looking up the result cache
+func RefreshWidgets(ctx *config.AppContext, ws []Widget, noCache bool) []WidgetResult {
+	return execWidgets(ctx, ws, noCache, true)
+}
+
+//ExecuteWidgets executes the queries of the given widgets concurrently like RefreshWidgets without modifying the widgets.
+//It is used for the read only views of the widgets
+func ExecuteWidgets(ctx *config.AppContext, ws []Widget) []WidgetResult {
+	return execWidgets(ctx, ws, false, false)
+}
+
+//execWidgets executes the queries of the given widgets concurrently with a bounded no. of workers.
+//If refresh is true, the last refreshed time of the widgets is updated
+func execWidgets(ctx *config.AppContext, ws []Widget, noCache, refresh bool) []WidgetResult {
+	/*
+	 * We will start the workers
+	 * Then we will send the widgets to the workers
+	 * Then we will wait for the workers to finish
+	 */
+	//starting the workers
+	results := make([]WidgetResult, len(ws))
+	jobs := make(chan int)
+	workers := config.MaxWidgetWorkers
+	if workers > len(ws) {
+		workers = len(ws)
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				ec := &ExecCache{NoCache: noCache}
+				var res []map[string]interface{}
+				var err error
+				if refresh {
+					res, err = ws[j].Refresh(ctx, ec)
+				} else {
+					res, err = ws[j].Execute(ctx, ec)
+				}
+				results[j] = WidgetResult{Widget: ws[j], Result: res, Cache: &ec.Status}
+				if err != nil {
+					results[j].Error = "Couldn't fetch the data for the widget"
+				}
+			}
+		}()
+	}
+
+	//sending the widgets to the workers
+	for i := range ws {
+		jobs <- i
+	}
+	close(jobs)
+
+	//waiting for the workers to finish
+	wg.Wait()
+	return results
+}
+
+//SetPublic makes the widget public or private if the given user can manage it. The dashboards having the widget
+//are marked as having public widgets accordingly.
+//If the widget doesn't exist gorm.ErrRecordNotFound is returned.
+//If the user doesn't have the permission ErrPermissionDenied is returned
+func (w *Widget) SetPublic(ctx *config.AppContext, userID uint, public bool) error {
+	/*
+	 * We will get the widget
+	 * We will check the permissions of the user
+	 * We will start a transaction
+	 * We will update the widget
+	 * Then we will update the dashboards having the widget
+	 */
+	//getting the widget
+	err := ctx.Db.Where("id = ?", w.ID).First(w).Error
+	if err != nil {
+		return err
+	}
+
+	//checking the permissions
+	err = w.CheckPermission(ctx, userID, PermissionManage)
+	if err != nil {
+		return err
+	}
+
+	//starting the transaction
+	tx := ctx.Db.Begin()
+
+	//updating the widget
+	err = tx.Model(&Widget{}).Where("id = ?", w.ID).UpdateColumn("is_public", public).Error
+	if err != nil {
+		//error while updating the widget
+		tx.Rollback()
+		ctx.Log.Error("error while updating the public access of the widget", w.ID, err)
+		return err
+	}
+
+	//updating the dashboards
+	err = syncPublicWidgets(tx, "id IN ?", tx.Model(&DashboardPage{}).Select("dashboard_id").
+		Where("id IN ?", tx.Model(&PageGridItem{}).Select("dashboard_page_id").Where("widget_id = ?", w.ID).SubQuery()).
+		SubQuery())
+	if err != nil {
+		//error while updating the dashboards having the widget
+		tx.Rollback()
+		ctx.Log.Error("error while updating the dashboards having the widget", w.ID, err)
+		return err
+	}
+	err = tx.Commit().Error
+	if err != nil {
+		return err
+	}
+	w.IsPublic = public
+	return nil
+}
+
+//GetPublicWidget returns the widget with the given id if it is public.
+//If the widget doesn't exist or isn't public gorm.ErrRecordNotFound is returned
+func GetPublicWidget(ctx *config.AppContext, id uint) (*Widget, error) {
+	w := &Widget{}
+	err := ctx.Db.Where("id = ? AND is_public = ?", id, true).First(w).Error
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+//Delete deletes the widget
+func (w *Widget) Delete(ctx *config.AppContext) error {
+	return ctx.Db.Where("id = ?", w.ID).Delete(&Widget{}).Error
 }
@@ -0,0 +1,66 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package dict
+
+import (
+	"strconv"
+
+	"github.com/cuttle-ai/octopus/interpreter"
+)
+
+//Tables returns the tables in the dictionary of the given user with their uid as the key.
+//Columns in the dictionary are added to the children of their tables
+func Tables(userID uint) map[string]interpreter.TableNode {
+	/*
+	 * We will get the dictionary of the user
+	 * We will collect the tables and the columns in the dictionary
+	 * Then we will add the columns to their tables
+	 */
+	//getting the dictionary
+	req := interpreter.DICTRequest{ID: strconv.Itoa(int(userID)), Type: interpreter.DICTGet, Out: make(chan interpreter.DICTRequest)}
+	go interpreter.SendDICTToChannel(interpreter.DICTInputChannel, req)
+	res := <-req.Out
+
+	//collecting the tables and the columns
+	tables := map[string]interpreter.TableNode{}
+	cols := []interpreter.ColumnNode{}
+	for _, n := range res.DICT.Map {
+		switch v := n.(type) {
+		case *interpreter.TableNode:
+			t := *v
+			t.Children = append([]interpreter.ColumnNode{}, v.Children...)
+			tables[t.UID] = t
+		case *interpreter.ColumnNode:
+			cols = append(cols, *v)
+		}
+	}
+
+	//adding the columns to their tables
+	for _, c := range cols {
+		t, ok := tables[c.PUID]
+		if !ok || HasColumn(t, c.Name) {
+			continue
+		}
+		t.Children = append(t.Children, c)
+		tables[c.PUID] = t
+	}
+	return tables
+}
+
+//HasColumn checks whether the table has a column with the given name
+func HasColumn(t interpreter.TableNode, name string) bool {
+	_, ok := Column(t, name)
+	return ok
+}
+
+//Column returns the column of the table with the given name. ok will be false if the table doesn't have the column
+func Column(t interpreter.TableNode, name string) (c interpreter.ColumnNode, ok bool) {
+	for _, c := range t.Children {
+		if c.Name == name {
+			return c, true
+		}
+	}
+	return c, false
+}
@@ -15,6 +15,7 @@ replace github.com/cuttle-ai/db-toolkit => ../db-toolkit/
 replace github.com/cuttle-ai/go-sdk => ../go-sdk/
 
 require (
+	github.com/apache/arrow/go/arrow v0.0.0-20200923215132-ac86123a3f01
 	github.com/cuttle-ai/auth-service v0.0.0-00010101000000-000000000000
 	github.com/cuttle-ai/brain v0.0.0-00010101000000-000000000000
 	github.com/cuttle-ai/configs v0.0.0-20190824112953-7860fdfd0dae
@@ -23,4 +24,5 @@ require (
 	github.com/cuttle-ai/octopus v0.0.0-00010101000000-000000000000
 	github.com/hashicorp/consul/api v1.4.0
 	github.com/jinzhu/gorm v1.9.12
+	github.com/xitongsys/parquet-go v1.5.1
 )
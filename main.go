@@ -10,37 +10,98 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 
 	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus-service/db"
 	"github.com/cuttle-ai/octopus-service/log"
 	"github.com/cuttle-ai/octopus-service/routes"
+	_ "github.com/cuttle-ai/octopus-service/routes/dashboard"
 	_ "github.com/cuttle-ai/octopus-service/routes/dict"
 	_ "github.com/cuttle-ai/octopus-service/routes/interpreter"
+	_ "github.com/cuttle-ai/octopus-service/routes/public"
+	_ "github.com/cuttle-ai/octopus-service/routes/relationship"
+	_ "github.com/cuttle-ai/octopus-service/routes/widget"
 )
 
 /*
  * This file contains the main start point of the application
  */
 
+//migrate runs the migrate subcommand. Usage:- migrate [up|down [steps]]
+func migrate(args []string) {
+	/*
+	 * We will parse the direction and the no. of steps
+	 * Then we will run the migrations
+	 */
+	//parsing the direction and the no. of steps
+	direction := "up"
+	if len(args) > 0 {
+		direction = args[0]
+	}
+	steps := 1
+	if len(args) > 1 {
+		s, err := strconv.Atoi(args[1])
+		if err != nil || s <= 0 {
+			log.Fatal("invalid no. of steps for the migration", args[1])
+		}
+		steps = s
+	}
+
+	//running the migrations
+	appCtx := config.NewAppContext(log.NewLogger(0))
+	var err error
+	switch direction {
+	case "up":
+		err = db.Migrate(appCtx)
+	case "down":
+		err = db.MigrateDown(appCtx, steps)
+	default:
+		log.Fatal("unknown migration direction", direction, "expected up or down")
+	}
+	if err != nil {
+		log.Fatal("error while running the migrations", err)
+	}
+	log.Info("successfully ran the migrations", direction)
+}
+
 func main() {
 	/*
+	 * Run the migrate subcommand if asked for
+	 * Apply the pending migrations if auto migrate is enabled
 	 * Create a new Server mux
 	 * Create a default server
 	 * Init the routes
 	 * Now listen and serve
+	 * Start the trash purge check
 	 * Listen to the os signals for exit
 	 * Graceful exit when command comes
 	 */
+	//running the migrate subcommand
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		migrate(os.Args[2:])
+		return
+	}
+
+	//applying the pending migrations
+	if config.AutoMigrate {
+		err := db.Migrate(config.NewAppContext(log.NewLogger(0)))
+		if err != nil {
+			log.Fatal("error while applying the migrations", err)
+		}
+	}
+
 	//creating a new server mux
 	m := http.NewServeMux()
 
-	//created the default server
+	//created the default server. Routes set the write deadline of their response through the connection in the request
+	//context instead of the server write timeout, so that the streamed responses aren't cut off
 	s := &http.Server{
 		Addr:           ":" + config.Port,
 		Handler:        m,
 		ReadTimeout:    config.RequestRTimeout,
-		WriteTimeout:   config.ResponseWTimeout,
 		MaxHeaderBytes: 1 << 20,
+		ConnContext:    routes.ConnContext,
 	}
 
 	//inited the routes
@@ -56,6 +117,9 @@ func main() {
 		config.StartRPC()
 	}()
 
+	//starting the trash purge check
+	go db.PurgeTrashCheck(config.NewAppContext(log.NewLogger(0)))
+
 	//listening for syscalls
 	var gracefulStop = make(chan os.Signal, 1)
 	signal.Notify(gracefulStop, os.Interrupt)
@@ -5,9 +5,608 @@
 //Package dashboard has the implementation of the dashboard api for the server
 package dashboard
 
-import "github.com/cuttle-ai/octopus-service/db"
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/cuttle-ai/brain/visualization"
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus-service/db"
+	"github.com/cuttle-ai/octopus-service/routes"
+	"github.com/cuttle-ai/octopus-service/routes/interpreter"
+	"github.com/cuttle-ai/octopus-service/routes/response"
+	"github.com/jinzhu/gorm"
+)
 
 //Dashboard data transilation object
 type Dashboard struct {
 	db.Dashboard
 }
+
+//CreateDashboard will create a dashboard for the logged in user
+func CreateDashboard(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload
+	 * Then we will create the dashboard
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to create a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the request payload
+	d := &Dashboard{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(d)
+	if err != nil {
+		//error while decoding the request param
+		appCtx.Log.Error("error while parsing the request body", err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	if len(d.Name) == 0 {
+		//name of the dashboard is missing
+		appCtx.Log.Error("name of the dashboard is missing")
+		response.WriteError(w, response.Error{Err: "Name of the dashboard is required"}, http.StatusBadRequest)
+		return
+	}
+
+	//creating the dashboard
+	d.UserID = appCtx.Session.User.ID
+	err = d.Create(appCtx)
+	if err != nil {
+		//error while creating the dashboard
+		appCtx.Log.Error("error while creating the dashboard", err)
+		response.WriteError(w, response.Error{Err: "Couldn't create the dashboard"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully created the dashboard", Data: d})
+}
+
+//ListDashboards will list the dashboards created by or shared with the logged in user
+func ListDashboards(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will get the dashboards
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to list the dashboards by", appCtx.Session.User.ID)
+
+	//getting the dashboards
+	ds, err := db.GetDashboards(appCtx, appCtx.Session.User.ID)
+	if err != nil {
+		//error while getting the dashboards
+		appCtx.Log.Error("error while getting the list of dashboards", err)
+		response.WriteError(w, response.Error{Err: "Couldn't fetch the dashboards"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully fetched the dashboards", Data: ds})
+}
+
+//GetDashboard will return the dashboard with the id given in the request along with its pages
+func GetDashboard(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the dashboard id
+	 * Then we will get the dashboard
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to get a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the dashboard id
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		//invalid dashboard id
+		appCtx.Log.Error("invalid dashboard id", r.FormValue("id"))
+		response.WriteError(w, response.Error{Err: "Invalid dashboard id " + r.FormValue("id")}, http.StatusBadRequest)
+		return
+	}
+
+	//getting the dashboard
+	d := &Dashboard{}
+	d.ID = uint(id)
+	err = d.Get(appCtx, appCtx.Session.User.ID)
+	if gorm.IsRecordNotFoundError(err) {
+		//couldn't find the dashboard
+		appCtx.Log.Error("couldn't find the dashboard", id)
+		response.WriteError(w, response.Error{Err: "Couldn't find the dashboard"}, http.StatusNotFound)
+		return
+	}
+	if err == db.ErrPermissionDenied {
+		//user doesn't have the permission
+		appCtx.Log.Error("user doesn't have the permission for the dashboard", id)
+		response.WriteError(w, response.Error{Err: "You don't have the permission for the dashboard"}, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		//error while getting the dashboard
+		appCtx.Log.Error("error while getting the dashboard", id, err)
+		response.WriteError(w, response.Error{Err: "Couldn't fetch the dashboard"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully fetched the dashboard", Data: d})
+}
+
+//UpdateDashboard will update the dashboard of the logged in user
+func UpdateDashboard(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload
+	 * Then we will update the dashboard
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to update a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the request payload
+	d := &Dashboard{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(d)
+	if err != nil {
+		//error while decoding the request param
+		appCtx.Log.Error("error while parsing the request body", err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	if d.ID == 0 || len(d.Name) == 0 {
+		//id or name of the dashboard is missing
+		appCtx.Log.Error("id or name of the dashboard is missing")
+		response.WriteError(w, response.Error{Err: "ID and Name of the dashboard are required"}, http.StatusBadRequest)
+		return
+	}
+
+	//updating the dashboard
+	err = d.Update(appCtx, appCtx.Session.User.ID)
+	if gorm.IsRecordNotFoundError(err) {
+		//couldn't find the dashboard
+		appCtx.Log.Error("couldn't find the dashboard", d.ID)
+		response.WriteError(w, response.Error{Err: "Couldn't find the dashboard"}, http.StatusNotFound)
+		return
+	}
+	if err == db.ErrPermissionDenied {
+		//user doesn't have the permission
+		appCtx.Log.Error("user doesn't have the permission for the dashboard", d.ID)
+		response.WriteError(w, response.Error{Err: "You don't have the permission for the dashboard"}, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		//error while updating the dashboard
+		appCtx.Log.Error("error while updating the dashboard", d.ID, err)
+		response.WriteError(w, response.Error{Err: "Couldn't update the dashboard"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully updated the dashboard", Data: d})
+}
+
+//DeleteDashboard will delete the dashboard with the id given in the request
+func DeleteDashboard(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the dashboard id
+	 * Then we will delete the dashboard
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to delete a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the dashboard id
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		//invalid dashboard id
+		appCtx.Log.Error("invalid dashboard id", r.FormValue("id"))
+		response.WriteError(w, response.Error{Err: "Invalid dashboard id " + r.FormValue("id")}, http.StatusBadRequest)
+		return
+	}
+
+	//deleting the dashboard
+	d := &Dashboard{}
+	d.ID = uint(id)
+	err = d.Delete(appCtx, appCtx.Session.User.ID)
+	if gorm.IsRecordNotFoundError(err) {
+		//couldn't find the dashboard
+		appCtx.Log.Error("couldn't find the dashboard", id)
+		response.WriteError(w, response.Error{Err: "Couldn't find the dashboard"}, http.StatusNotFound)
+		return
+	}
+	if err == db.ErrPermissionDenied {
+		//user doesn't have the permission
+		appCtx.Log.Error("user doesn't have the permission for the dashboard", id)
+		response.WriteError(w, response.Error{Err: "You don't have the permission for the dashboard"}, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		//error while deleting the dashboard
+		appCtx.Log.Error("error while deleting the dashboard", id, err)
+		response.WriteError(w, response.Error{Err: "Couldn't delete the dashboard"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully deleted the dashboard"})
+}
+
+//DashboardResult has the dashboard along with the results of its widgets
+type DashboardResult struct {
+	db.Dashboard
+	//Widgets has the widgets in the dashboard along with their results
+	Widgets []db.WidgetResult
+}
+
+//RefreshDashboard will execute all the widgets of the dashboard with the id given in the request and return their results.
+//Failure of a widget is reported in its result without failing the whole dashboard
+func RefreshDashboard(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the dashboard id
+	 * Then we will refresh the dashboard
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to refresh a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the dashboard id
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		//invalid dashboard id
+		appCtx.Log.Error("invalid dashboard id", r.FormValue("id"))
+		response.WriteError(w, response.Error{Err: "Invalid dashboard id " + r.FormValue("id")}, http.StatusBadRequest)
+		return
+	}
+
+	//refreshing the dashboard
+	d := &db.Dashboard{}
+	d.ID = uint(id)
+	res, err := d.Refresh(appCtx, appCtx.Session.User.ID, routes.NoCache(r))
+	if gorm.IsRecordNotFoundError(err) {
+		//couldn't find the dashboard
+		appCtx.Log.Error("couldn't find the dashboard", id)
+		response.WriteError(w, response.Error{Err: "Couldn't find the dashboard"}, http.StatusNotFound)
+		return
+	}
+	if err == db.ErrPermissionDenied {
+		//user doesn't have the permission
+		appCtx.Log.Error("user doesn't have the permission for the dashboard", id)
+		response.WriteError(w, response.Error{Err: "You don't have the permission for the dashboard"}, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		//error while refreshing the dashboard
+		appCtx.Log.Error("error while refreshing the dashboard", id, err)
+		response.WriteError(w, response.Error{Err: "Couldn't refresh the dashboard"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully refreshed the dashboard", Data: DashboardResult{Dashboard: *d, Widgets: res}})
+}
+
+//Duplicate is the request payload for duplicating a dashboard
+type Duplicate struct {
+	db.DuplicateOptions
+	//ID of the dashboard to be duplicated
+	ID uint
+}
+
+//DuplicateDashboard will duplicate the dashboard in the request payload for the logged in user.
+//Dashboard can be saved as a template or a template can be instantiated with the bindings for its table parameters
+func DuplicateDashboard(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload
+	 * Then we will duplicate the dashboard
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to duplicate a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the request payload
+	dup := &Duplicate{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(dup)
+	if err != nil {
+		//error while decoding the request param
+		appCtx.Log.Error("error while parsing the request body", err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	//duplicating the dashboard
+	d := &db.Dashboard{}
+	d.ID = dup.ID
+	nd, err := d.Duplicate(appCtx, appCtx.Session.User.ID, dup.DuplicateOptions)
+	if gorm.IsRecordNotFoundError(err) {
+		//couldn't find the dashboard
+		appCtx.Log.Error("couldn't find the dashboard", dup.ID)
+		response.WriteError(w, response.Error{Err: "Couldn't find the dashboard"}, http.StatusNotFound)
+		return
+	}
+	if err == db.ErrPermissionDenied {
+		//user doesn't have the permission
+		appCtx.Log.Error("user doesn't have the permission for the dashboard", dup.ID)
+		response.WriteError(w, response.Error{Err: "You don't have the permission for the dashboard"}, http.StatusForbidden)
+		return
+	}
+	if err == db.ErrMissingBinding {
+		//bindings for the template are missing
+		appCtx.Log.Error("bindings for the template are missing", dup.ID)
+		response.WriteError(w, response.Error{Err: "Bindings for all the table parameters of the template are required"}, http.StatusBadRequest)
+		return
+	}
+	if bErr, ok := err.(db.InvalidBindingError); ok {
+		//bound tables can't be used by the user
+		appCtx.Log.Error("invalid bindings for the template", dup.ID, err)
+		response.WriteError(w, response.Error{Err: bErr.Error()}, http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		//error while duplicating the dashboard
+		appCtx.Log.Error("error while duplicating the dashboard", dup.ID, err)
+		response.WriteError(w, response.Error{Err: "Couldn't duplicate the dashboard"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully duplicated the dashboard", Data: nd})
+}
+
+//GetTemplateParameters will return the table parameters of the template dashboard with the id given in the request
+func GetTemplateParameters(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the dashboard id
+	 * Then we will get the dashboard
+	 * Then we will get the template parameters
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to get the template parameters of a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the dashboard id
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		//invalid dashboard id
+		appCtx.Log.Error("invalid dashboard id", r.FormValue("id"))
+		response.WriteError(w, response.Error{Err: "Invalid dashboard id " + r.FormValue("id")}, http.StatusBadRequest)
+		return
+	}
+
+	//getting the dashboard
+	d := &Dashboard{}
+	d.ID = uint(id)
+	err = d.Get(appCtx, appCtx.Session.User.ID)
+	if gorm.IsRecordNotFoundError(err) {
+		//couldn't find the dashboard
+		appCtx.Log.Error("couldn't find the dashboard", id)
+		response.WriteError(w, response.Error{Err: "Couldn't find the dashboard"}, http.StatusNotFound)
+		return
+	}
+	if err == db.ErrPermissionDenied {
+		//user doesn't have the permission
+		appCtx.Log.Error("user doesn't have the permission for the dashboard", id)
+		response.WriteError(w, response.Error{Err: "You don't have the permission for the dashboard"}, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		//error while getting the dashboard
+		appCtx.Log.Error("error while getting the dashboard", id, err)
+		response.WriteError(w, response.Error{Err: "Couldn't fetch the dashboard"}, http.StatusInternalServerError)
+		return
+	}
+
+	//getting the template parameters
+	params, err := d.TemplateParameters(appCtx)
+	if err != nil {
+		//error while getting the template parameters
+		appCtx.Log.Error("error while getting the template parameters of the dashboard", id, err)
+		response.WriteError(w, response.Error{Err: "Couldn't fetch the template parameters of the dashboard"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully fetched the template parameters of the dashboard", Data: params})
+}
+
+//Pin is the request payload for pinning a query to a dashboard
+type Pin struct {
+	//DashboardID is the id of the dashboard to which the query has to be pinned
+	DashboardID uint
+	//NL is the natural language query to be pinned
+	NL string
+	//QueryID is the id of the query returned by the search api. If given NL is ignored
+	QueryID string
+	//Title is the title of the widget to be created. Defaults to the natural language query
+	Title string
+}
+
+//PinResult is the result of pinning a query to the dashboard
+type PinResult struct {
+	//Widget is the widget created for the query
+	Widget db.Widget
+	//PageGridItem is the placement of the widget in the dashboard
+	PageGridItem db.PageGridItem
+}
+
+//PinToDashboard will create a widget from a query and add it to the dashboard
+func PinToDashboard(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload
+	 * Then we will get the dashboard and check whether the user can edit it
+	 * Then we will resolve the query either from the recent queries or by interpreting it
+	 * Then we will create the widget
+	 * Then we will add the widget to the dashboard with the size derived from the visualization
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to pin a query to a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the request payload
+	p := &Pin{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(p)
+	if err != nil {
+		//error while decoding the request param
+		appCtx.Log.Error("error while parsing the request body", err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	if p.DashboardID == 0 || (len(p.NL) == 0 && len(p.QueryID) == 0) {
+		//dashboard id or query is missing
+		appCtx.Log.Error("dashboard id or query is missing")
+		response.WriteError(w, response.Error{Err: "DashboardID and either NL or QueryID are required"}, http.StatusBadRequest)
+		return
+	}
+
+	//getting the dashboard
+	d, err := db.CheckDashboardPermission(appCtx, p.DashboardID, appCtx.Session.User.ID, db.PermissionEdit)
+	if gorm.IsRecordNotFoundError(err) {
+		//couldn't find the dashboard
+		appCtx.Log.Error("couldn't find the dashboard", p.DashboardID)
+		response.WriteError(w, response.Error{Err: "Couldn't find the dashboard"}, http.StatusNotFound)
+		return
+	}
+	if err == db.ErrPermissionDenied {
+		//user doesn't have the permission
+		appCtx.Log.Error("user doesn't have the permission for the dashboard", p.DashboardID)
+		response.WriteError(w, response.Error{Err: "You don't have the permission for the dashboard"}, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		//error while getting the dashboard
+		appCtx.Log.Error("error while getting the dashboard", p.DashboardID, err)
+		response.WriteError(w, response.Error{Err: "Couldn't fetch the dashboard"}, http.StatusInternalServerError)
+		return
+	}
+
+	//resolving the query
+	wi := db.Widget{UserID: appCtx.Session.User.ID, Title: p.Title}
+	if len(p.QueryID) != 0 {
+		rq, ok := interpreter.GetRecentQuery(appCtx.Session.User.ID, p.QueryID)
+		if !ok {
+			//couldn't find the query
+			appCtx.Log.Error("couldn't find the recent query", p.QueryID)
+			response.WriteError(w, response.Error{Err: "Couldn't find the query " + p.QueryID + ". Please search again"}, http.StatusNotFound)
+			return
+		}
+		wi.NL = rq.NL
+		wi.Query = rq.Query
+		wi.Visualization = rq.Visualization
+	} else {
+		ins, err := interpreter.InterpretNL(appCtx, p.NL)
+		if err != nil {
+			//error while interpreting the user query
+			response.WriteError(w, response.Error{Err: "Unable to interpret your query"}, http.StatusInternalServerError)
+			return
+		}
+		wi.NL = p.NL
+		wi.Query = *ins
+		wi.Visualization = visualization.SuggestVisualization(ins)
+	}
+	if len(wi.Title) == 0 {
+		wi.Title = wi.NL
+	}
+
+	//creating the widget
+	err = wi.Create(appCtx)
+	if err != nil {
+		//error while creating the widget
+		appCtx.Log.Error("error while creating the widget", err)
+		response.WriteError(w, response.Error{Err: "Couldn't create the widget"}, http.StatusInternalServerError)
+		return
+	}
+
+	//adding the widget to the dashboard
+	width, height := db.WidgetSize(wi.Visualization)
+	item, err := d.AddWidget(appCtx, appCtx.Session.User.ID, wi, width, height)
+	if err != nil {
+		//error while adding the widget to the dashboard
+		appCtx.Log.Error("error while adding the widget to the dashboard", d.ID, err)
+		if dErr := wi.Delete(appCtx); dErr != nil {
+			appCtx.Log.Error("error while deleting the widget which couldn't be added to the dashboard", wi.ID, dErr)
+		}
+		response.WriteError(w, response.Error{Err: "Couldn't add the widget to the dashboard"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully pinned the query to the dashboard", Data: PinResult{Widget: wi, PageGridItem: *item}})
+}
+
+func init() {
+	routes.AddRoutes(
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/create",
+			HandlerFunc: CreateDashboard,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/list",
+			HandlerFunc: ListDashboards,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/get",
+			HandlerFunc: GetDashboard,
+			ParseForm:   true,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/update",
+			HandlerFunc: UpdateDashboard,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/delete",
+			HandlerFunc: DeleteDashboard,
+			ParseForm:   true,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/refresh",
+			HandlerFunc: RefreshDashboard,
+			ParseForm:   true,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/duplicate",
+			HandlerFunc: DuplicateDashboard,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/template/params",
+			HandlerFunc: GetTemplateParameters,
+			ParseForm:   true,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/pin",
+			HandlerFunc: PinToDashboard,
+		},
+	)
+}
@@ -0,0 +1,148 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus-service/db"
+	"github.com/cuttle-ai/octopus-service/log"
+	"github.com/cuttle-ai/octopus-service/routes"
+	"github.com/cuttle-ai/octopus-service/routes/interpreter"
+	"github.com/cuttle-ai/octopus-service/routes/response"
+	oInterpreter "github.com/cuttle-ai/octopus/interpreter"
+	"github.com/jinzhu/gorm"
+)
+
+/*
+ * This file contains the apis for exporting and importing the dashboards as portable json documents
+ */
+
+//Import is the request payload for importing a dashboard
+type Import struct {
+	//Document is the dashboard export document to be imported
+	Document db.DashboardExport
+}
+
+//ExportDashboard will write the portable json document of the dashboard with the id given in the request as a downloadable file
+func ExportDashboard(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the dashboard id
+	 * Then we will export the dashboard
+	 * Then we will write the document
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to export a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the dashboard id
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		//invalid dashboard id
+		appCtx.Log.Error("invalid dashboard id", r.FormValue("id"))
+		response.WriteError(w, response.Error{Err: "Invalid dashboard id " + r.FormValue("id")}, http.StatusBadRequest)
+		return
+	}
+
+	//exporting the dashboard
+	d := &db.Dashboard{}
+	d.ID = uint(id)
+	doc, err := d.Export(appCtx, appCtx.Session.User.ID)
+	if gorm.IsRecordNotFoundError(err) {
+		//couldn't find the dashboard
+		appCtx.Log.Error("couldn't find the dashboard", id)
+		response.WriteError(w, response.Error{Err: "Couldn't find the dashboard"}, http.StatusNotFound)
+		return
+	}
+	if err == db.ErrPermissionDenied {
+		//user doesn't have the permission
+		appCtx.Log.Error("user doesn't have the permission for the dashboard", id)
+		response.WriteError(w, response.Error{Err: "You don't have the permission for the dashboard"}, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		//error while exporting the dashboard
+		appCtx.Log.Error("error while exporting the dashboard", id, err)
+		response.WriteError(w, response.Error{Err: "Couldn't export the dashboard"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the document
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"dashboard-%d.json\"", id))
+	en := json.NewEncoder(w)
+	en.SetIndent("", "  ")
+	err = en.Encode(doc)
+	if err != nil {
+		//Error while writing the response
+		log.Error("Error while writing the dashboard export document")
+	}
+}
+
+//ImportDashboard will import the dashboard export document in the request payload for the logged in user
+func ImportDashboard(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload
+	 * Then we will import the dashboard
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to import a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the request payload
+	im := &Import{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(im)
+	if err != nil {
+		//error while decoding the request param
+		appCtx.Log.Error("error while parsing the request body", err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	//importing the dashboard
+	d, err := db.Import(appCtx, appCtx.Session.User.ID, im.Document, func(nl string) (*oInterpreter.Query, error) {
+		return interpreter.InterpretNL(appCtx, nl)
+	})
+	if iErr, ok := err.(db.InvalidExportError); ok {
+		//invalid document
+		appCtx.Log.Error("invalid dashboard export document", iErr)
+		response.WriteError(w, response.Error{Err: iErr.Error()}, http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		//error while importing the dashboard
+		appCtx.Log.Error("error while importing the dashboard", err)
+		response.WriteError(w, response.Error{Err: "Couldn't import the dashboard"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully imported the dashboard", Data: d})
+}
+
+func init() {
+	routes.AddRoutes(
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/export",
+			HandlerFunc: ExportDashboard,
+			ParseForm:   true,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/import",
+			HandlerFunc: ImportDashboard,
+		},
+	)
+}
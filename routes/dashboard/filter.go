@@ -0,0 +1,96 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus-service/db"
+	"github.com/cuttle-ai/octopus-service/routes"
+	"github.com/cuttle-ai/octopus-service/routes/response"
+	"github.com/jinzhu/gorm"
+)
+
+/*
+ * This file contains the apis for managing the dashboard level filters
+ */
+
+//Filters is the request payload for setting the filters of a dashboard
+type Filters struct {
+	//DashboardID is the id of the dashboard whose filters are set
+	DashboardID uint
+	//Filters has the new filters of the dashboard. Existing filters will be replaced by them
+	Filters []db.DashboardFilter
+}
+
+//SetDashboardFilters will replace the filters of the dashboard in the request payload
+func SetDashboardFilters(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload
+	 * Then we will set the filters of the dashboard
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to set the filters of a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the request payload
+	f := &Filters{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(f)
+	if err != nil {
+		//error while decoding the request param
+		appCtx.Log.Error("error while parsing the request body", err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	//setting the filters
+	d := &db.Dashboard{}
+	d.ID = f.DashboardID
+	fs, err := d.SetFilters(appCtx, appCtx.Session.User.ID, f.Filters)
+	if gorm.IsRecordNotFoundError(err) {
+		//couldn't find the dashboard
+		appCtx.Log.Error("couldn't find the dashboard", f.DashboardID)
+		response.WriteError(w, response.Error{Err: "Couldn't find the dashboard"}, http.StatusNotFound)
+		return
+	}
+	if err == db.ErrPermissionDenied {
+		//user doesn't have the permission
+		appCtx.Log.Error("user doesn't have the permission for the dashboard", f.DashboardID)
+		response.WriteError(w, response.Error{Err: "You don't have the permission for the dashboard"}, http.StatusForbidden)
+		return
+	}
+	if err == db.ErrInvalidFilter {
+		//invalid filters
+		appCtx.Log.Error("invalid filters for the dashboard", f.DashboardID)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		//error while setting the filters
+		appCtx.Log.Error("error while setting the filters of the dashboard", f.DashboardID, err)
+		response.WriteError(w, response.Error{Err: "Couldn't set the filters of the dashboard"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully set the filters of the dashboard", Data: fs})
+}
+
+func init() {
+	routes.AddRoutes(
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/filters",
+			HandlerFunc: SetDashboardFilters,
+		},
+	)
+}
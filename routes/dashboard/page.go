@@ -0,0 +1,339 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus-service/db"
+	"github.com/cuttle-ai/octopus-service/routes"
+	"github.com/cuttle-ai/octopus-service/routes/response"
+	"github.com/jinzhu/gorm"
+)
+
+/*
+ * This file contains the apis for managing the dashboard pages and their grid items
+ */
+
+//Page data transilation object
+type Page struct {
+	db.DashboardPage
+}
+
+//PageOrder is the request payload for reordering the pages of a dashboard
+type PageOrder struct {
+	//DashboardID is the id of the dashboard whose pages are reordered
+	DashboardID uint
+	//PageIDs has the ids of all the pages in the dashboard in the new order
+	PageIDs []uint
+}
+
+//RenamePage will rename the page in the request payload
+func RenamePage(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload
+	 * Then we will rename the page
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to rename a page by", appCtx.Session.User.ID)
+
+	//parsing the request payload
+	p, ok := parsePage(appCtx, w, r)
+	if !ok {
+		return
+	}
+	if len(p.Name) == 0 {
+		//name of the page is missing
+		appCtx.Log.Error("name of the page is missing")
+		response.WriteError(w, response.Error{Err: "Name of the page is required"}, http.StatusBadRequest)
+		return
+	}
+
+	//renaming the page
+	dp, err := db.RenamePage(appCtx, appCtx.Session.User.ID, p.ID, p.Name)
+	if err != nil {
+		writePageError(appCtx, w, err, p.ID)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully renamed the page", Data: dp})
+}
+
+//ResizePage will change the grid size, width and height of the page in the request payload
+func ResizePage(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload
+	 * Then we will resize the page
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to resize a page by", appCtx.Session.User.ID)
+
+	//parsing the request payload
+	p, ok := parsePage(appCtx, w, r)
+	if !ok {
+		return
+	}
+
+	//resizing the page
+	dp, err := db.ResizePage(appCtx, appCtx.Session.User.ID, p.ID, p.GridSize, p.Width, p.Height)
+	if err != nil {
+		writePageError(appCtx, w, err, p.ID)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully resized the page", Data: dp})
+}
+
+//ReorderPages will reorder the pages of the dashboard as per the request payload
+func ReorderPages(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload
+	 * Then we will reorder the pages
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to reorder the pages of a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the request payload
+	o := &PageOrder{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(o)
+	if err != nil {
+		//error while decoding the request param
+		appCtx.Log.Error("error while parsing the request body", err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	//reordering the pages
+	d := &db.Dashboard{}
+	d.ID = o.DashboardID
+	pages, err := d.ReorderPages(appCtx, appCtx.Session.User.ID, o.PageIDs)
+	if gorm.IsRecordNotFoundError(err) {
+		//couldn't find the dashboard
+		appCtx.Log.Error("couldn't find the dashboard", o.DashboardID)
+		response.WriteError(w, response.Error{Err: "Couldn't find the dashboard"}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writePageError(appCtx, w, err, 0)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully reordered the pages", Data: pages})
+}
+
+//DeletePage will delete the page with the id given in the request
+func DeletePage(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the page id
+	 * Then we will delete the page
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to delete a page by", appCtx.Session.User.ID)
+
+	//parsing the page id
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		//invalid page id
+		appCtx.Log.Error("invalid page id", r.FormValue("id"))
+		response.WriteError(w, response.Error{Err: "Invalid page id " + r.FormValue("id")}, http.StatusBadRequest)
+		return
+	}
+
+	//deleting the page
+	err = db.DeletePage(appCtx, appCtx.Session.User.ID, uint(id))
+	if err != nil {
+		writePageError(appCtx, w, err, uint(id))
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully deleted the page"})
+}
+
+//parsePage will parse the page from the request payload. If it fails, the error response is written and false is returned
+func parsePage(appCtx *config.AppContext, w http.ResponseWriter, r *http.Request) (*Page, bool) {
+	p := &Page{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(p)
+	if err != nil {
+		//error while decoding the request param
+		appCtx.Log.Error("error while parsing the request body", err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return nil, false
+	}
+	defer r.Body.Close()
+	if p.ID == 0 {
+		//id of the page is missing
+		appCtx.Log.Error("id of the page is missing")
+		response.WriteError(w, response.Error{Err: "ID of the page is required"}, http.StatusBadRequest)
+		return nil, false
+	}
+	return p, true
+}
+
+//GridItemMove is the request payload for moving and resizing a page grid item
+type GridItemMove struct {
+	db.GridItemPosition
+	//PageID is the id of the page in which the grid item is present
+	PageID uint
+}
+
+//GridItemsMove is the request payload for moving and resizing the page grid items in a batch
+type GridItemsMove struct {
+	//PageID is the id of the page in which the grid items are present
+	PageID uint
+	//Items has the new positions of the grid items
+	Items []db.GridItemPosition
+}
+
+//MoveGridItem will move and resize a page grid item
+func MoveGridItem(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload
+	 * Then we will move the grid item
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to move a page grid item by", appCtx.Session.User.ID)
+
+	//parsing the request payload
+	m := &GridItemMove{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(m)
+	if err != nil {
+		//error while decoding the request param
+		appCtx.Log.Error("error while parsing the request body", err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	//moving the grid item
+	items, err := db.MovePageGridItems(appCtx, appCtx.Session.User.ID, m.PageID, []db.GridItemPosition{m.GridItemPosition})
+	if err != nil {
+		writePageError(appCtx, w, err, m.PageID)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully moved the page grid item", Data: items[0]})
+}
+
+//MoveGridItems will move and resize the page grid items in a batch. Either all the items are moved or none
+func MoveGridItems(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload
+	 * Then we will move the grid items
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to move the page grid items by", appCtx.Session.User.ID)
+
+	//parsing the request payload
+	m := &GridItemsMove{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(m)
+	if err != nil {
+		//error while decoding the request param
+		appCtx.Log.Error("error while parsing the request body", err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	//moving the grid items
+	items, err := db.MovePageGridItems(appCtx, appCtx.Session.User.ID, m.PageID, m.Items)
+	if err != nil {
+		writePageError(appCtx, w, err, m.PageID)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully moved the page grid items", Data: items})
+}
+
+//writePageError will write the error response for the errors while managing the dashboard pages
+func writePageError(appCtx *config.AppContext, w http.ResponseWriter, err error, pageID uint) {
+	switch {
+	case gorm.IsRecordNotFoundError(err):
+		//couldn't find the page
+		appCtx.Log.Error("couldn't find the page", pageID)
+		response.WriteError(w, response.Error{Err: "Couldn't find the page"}, http.StatusNotFound)
+	case err == db.ErrPermissionDenied:
+		//user doesn't have the permission
+		appCtx.Log.Error("user doesn't have the permission for the page", pageID)
+		response.WriteError(w, response.Error{Err: "You don't have the permission for the page"}, http.StatusForbidden)
+	case err == db.ErrInvalidGridItem, err == db.ErrOutOfBounds, err == db.ErrOverlap,
+		err == db.ErrInvalidPageOrder, err == db.ErrInvalidPageSize:
+		//invalid layout for the page
+		appCtx.Log.Error("invalid layout for the page", pageID, err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusUnprocessableEntity)
+	default:
+		//error while managing the page
+		appCtx.Log.Error("error while managing the page", pageID, err)
+		response.WriteError(w, response.Error{Err: "Couldn't update the page"}, http.StatusInternalServerError)
+	}
+}
+
+func init() {
+	routes.AddRoutes(
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/page/rename",
+			HandlerFunc: RenamePage,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/page/resize",
+			HandlerFunc: ResizePage,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/page/delete",
+			HandlerFunc: DeletePage,
+			ParseForm:   true,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/pages/reorder",
+			HandlerFunc: ReorderPages,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/page/item/move",
+			HandlerFunc: MoveGridItem,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/page/items/move",
+			HandlerFunc: MoveGridItems,
+		},
+	)
+}
@@ -0,0 +1,227 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus-service/db"
+	"github.com/cuttle-ai/octopus-service/routes"
+	"github.com/cuttle-ai/octopus-service/routes/response"
+	"github.com/jinzhu/gorm"
+)
+
+/*
+ * This file contains the apis for sharing the dashboard and managing its collaborators
+ */
+
+//Collaborator data transilation object. It has the rights of a user over the dashboard
+type Collaborator struct {
+	db.DashboardUserMappings
+}
+
+//ListCollaborators will list the collaborators of the dashboard with the id given in the request
+func ListCollaborators(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the dashboard id
+	 * Then we will get the collaborators
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to list the collaborators of a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the dashboard id
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		//invalid dashboard id
+		appCtx.Log.Error("invalid dashboard id", r.FormValue("id"))
+		response.WriteError(w, response.Error{Err: "Invalid dashboard id " + r.FormValue("id")}, http.StatusBadRequest)
+		return
+	}
+
+	//getting the collaborators
+	d := &db.Dashboard{}
+	d.ID = uint(id)
+	ms, err := d.GetCollaborators(appCtx, appCtx.Session.User.ID)
+	if err != nil {
+		writeSharingError(appCtx, w, err, d.ID)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully fetched the collaborators of the dashboard", Data: ms})
+}
+
+//ShareDashboard will share the dashboard with the user in the request payload
+func ShareDashboard(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload
+	 * Then we will share the dashboard
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to share a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the request payload
+	c, ok := parseCollaborator(appCtx, w, r)
+	if !ok {
+		return
+	}
+
+	//sharing the dashboard
+	d := &db.Dashboard{}
+	d.ID = c.DashboardID
+	err := d.Share(appCtx, appCtx.Session.User.ID, &c.DashboardUserMappings)
+	if err != nil {
+		writeSharingError(appCtx, w, err, d.ID)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully shared the dashboard", Data: c})
+}
+
+//UpdateCollaborator will update the rights of the collaborator in the request payload
+func UpdateCollaborator(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload
+	 * Then we will update the collaborator
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to update a collaborator of a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the request payload
+	c, ok := parseCollaborator(appCtx, w, r)
+	if !ok {
+		return
+	}
+
+	//updating the collaborator
+	d := &db.Dashboard{}
+	d.ID = c.DashboardID
+	err := d.UpdateCollaborator(appCtx, appCtx.Session.User.ID, &c.DashboardUserMappings)
+	if err != nil {
+		writeSharingError(appCtx, w, err, d.ID)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully updated the collaborator", Data: c})
+}
+
+//RevokeCollaborator will revoke the access of the collaborator in the request payload
+func RevokeCollaborator(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload
+	 * Then we will revoke the access of the collaborator
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to revoke a collaborator of a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the request payload
+	c, ok := parseCollaborator(appCtx, w, r)
+	if !ok {
+		return
+	}
+
+	//revoking the access
+	d := &db.Dashboard{}
+	d.ID = c.DashboardID
+	err := d.RevokeCollaborator(appCtx, appCtx.Session.User.ID, c.UserID)
+	if err != nil {
+		writeSharingError(appCtx, w, err, d.ID)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully revoked the access of the collaborator"})
+}
+
+//parseCollaborator will parse the collaborator from the request payload. If it fails, the error response is written and false is returned
+func parseCollaborator(appCtx *config.AppContext, w http.ResponseWriter, r *http.Request) (*Collaborator, bool) {
+	c := &Collaborator{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(c)
+	if err != nil {
+		//error while decoding the request param
+		appCtx.Log.Error("error while parsing the request body", err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return nil, false
+	}
+	defer r.Body.Close()
+	if c.DashboardID == 0 || c.UserID == 0 {
+		//dashboard id or user id is missing
+		appCtx.Log.Error("dashboard id or user id of the collaborator is missing")
+		response.WriteError(w, response.Error{Err: "DashboardID and UserID are required"}, http.StatusBadRequest)
+		return nil, false
+	}
+	return c, true
+}
+
+//writeSharingError will write the error response for the errors while sharing the dashboard
+func writeSharingError(appCtx *config.AppContext, w http.ResponseWriter, err error, dashboardID uint) {
+	switch {
+	case gorm.IsRecordNotFoundError(err):
+		//couldn't find the dashboard or the collaborator
+		appCtx.Log.Error("couldn't find the dashboard or the collaborator", dashboardID)
+		response.WriteError(w, response.Error{Err: "Couldn't find the dashboard or the collaborator"}, http.StatusNotFound)
+	case err == db.ErrPermissionDenied:
+		//user doesn't have the permission
+		appCtx.Log.Error("user doesn't have the permission for the dashboard", dashboardID)
+		response.WriteError(w, response.Error{Err: "You don't have the permission for the dashboard"}, http.StatusForbidden)
+	case err == db.ErrAlreadyShared:
+		//dashboard is already shared with the user
+		appCtx.Log.Error("dashboard is already shared with the user", dashboardID)
+		response.WriteError(w, response.Error{Err: "Dashboard is already shared with the user"}, http.StatusConflict)
+	case err == db.ErrInvalidCollaborator:
+		//invalid collaborator
+		appCtx.Log.Error("invalid collaborator for the dashboard", dashboardID)
+		response.WriteError(w, response.Error{Err: "Dashboard can't be shared with the user"}, http.StatusBadRequest)
+	default:
+		//error while sharing the dashboard
+		appCtx.Log.Error("error while managing the collaborators of the dashboard", dashboardID, err)
+		response.WriteError(w, response.Error{Err: "Couldn't manage the collaborators of the dashboard"}, http.StatusInternalServerError)
+	}
+}
+
+func init() {
+	routes.AddRoutes(
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/collaborators",
+			HandlerFunc: ListCollaborators,
+			ParseForm:   true,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/share",
+			HandlerFunc: ShareDashboard,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/collaborators/update",
+			HandlerFunc: UpdateCollaborator,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/collaborators/revoke",
+			HandlerFunc: RevokeCollaborator,
+		},
+	)
+}
@@ -0,0 +1,109 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package dashboard
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus-service/db"
+	"github.com/cuttle-ai/octopus-service/routes"
+	"github.com/cuttle-ai/octopus-service/routes/response"
+	"github.com/jinzhu/gorm"
+)
+
+/*
+ * This file contains the apis for the trash bin of the deleted dashboards
+ */
+
+//ListTrash will list the deleted dashboards of the logged in user which are yet to be purged
+func ListTrash(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will get the dashboards in the trash
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to list the trash by", appCtx.Session.User.ID)
+
+	//getting the dashboards in the trash
+	ds, err := db.GetTrash(appCtx, appCtx.Session.User.ID)
+	if err != nil {
+		//error while getting the dashboards in the trash
+		appCtx.Log.Error("error while getting the list of dashboards in the trash", err)
+		response.WriteError(w, response.Error{Err: "Couldn't fetch the trash"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully fetched the trash", Data: ds})
+}
+
+//RestoreFromTrash will restore the deleted dashboard with the id given in the request along with its pages
+func RestoreFromTrash(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the dashboard id
+	 * Then we will restore the dashboard
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to restore a dashboard from the trash by", appCtx.Session.User.ID)
+
+	//parsing the dashboard id
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		//invalid dashboard id
+		appCtx.Log.Error("invalid dashboard id", r.FormValue("id"))
+		response.WriteError(w, response.Error{Err: "Invalid dashboard id " + r.FormValue("id")}, http.StatusBadRequest)
+		return
+	}
+
+	//restoring the dashboard
+	d := &db.Dashboard{}
+	d.ID = uint(id)
+	err = d.RestoreFromTrash(appCtx, appCtx.Session.User.ID)
+	if gorm.IsRecordNotFoundError(err) {
+		//couldn't find the dashboard in the trash
+		appCtx.Log.Error("couldn't find the dashboard in the trash", id)
+		response.WriteError(w, response.Error{Err: "Couldn't find the dashboard in the trash"}, http.StatusNotFound)
+		return
+	}
+	if err == db.ErrPermissionDenied {
+		//user doesn't have the permission
+		appCtx.Log.Error("user doesn't have the permission for the dashboard", id)
+		response.WriteError(w, response.Error{Err: "You don't have the permission for the dashboard"}, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		//error while restoring the dashboard
+		appCtx.Log.Error("error while restoring the dashboard from the trash", id, err)
+		response.WriteError(w, response.Error{Err: "Couldn't restore the dashboard"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully restored the dashboard", Data: d})
+}
+
+func init() {
+	routes.AddRoutes(
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/trash",
+			HandlerFunc: ListTrash,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/trash/restore",
+			HandlerFunc: RestoreFromTrash,
+			ParseForm:   true,
+		},
+	)
+}
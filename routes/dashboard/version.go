@@ -0,0 +1,182 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package dashboard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus-service/db"
+	"github.com/cuttle-ai/octopus-service/routes"
+	"github.com/cuttle-ai/octopus-service/routes/response"
+	"github.com/jinzhu/gorm"
+)
+
+/*
+ * This file contains the apis for the version history of the dashboards
+ */
+
+//Version is the request payload for restoring a version of a dashboard
+type Version struct {
+	//DashboardID is the id of the dashboard
+	DashboardID uint
+	//Revision is the revision of the dashboard to be restored
+	Revision uint
+}
+
+//writeVersionError writes the error response for the errors returned by the version history operations of the dashboard
+func writeVersionError(appCtx *config.AppContext, w http.ResponseWriter, err error, dashboardID uint) {
+	switch {
+	case gorm.IsRecordNotFoundError(err):
+		//couldn't find the dashboard or the revision
+		appCtx.Log.Error("couldn't find the dashboard or the revision", dashboardID)
+		response.WriteError(w, response.Error{Err: "Couldn't find the dashboard or the revision"}, http.StatusNotFound)
+	case err == db.ErrPermissionDenied:
+		//user doesn't have the permission
+		appCtx.Log.Error("user doesn't have the permission for the dashboard", dashboardID)
+		response.WriteError(w, response.Error{Err: "You don't have the permission for the dashboard"}, http.StatusForbidden)
+	default:
+		//error while accessing the version history
+		appCtx.Log.Error("error while accessing the version history of the dashboard", dashboardID, err)
+		response.WriteError(w, response.Error{Err: "Couldn't access the version history of the dashboard"}, http.StatusInternalServerError)
+	}
+}
+
+//ListVersions will return the version history of the dashboard with the id given in the request
+func ListVersions(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the dashboard id
+	 * Then we will get the versions
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to list the versions of a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the dashboard id
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		//invalid dashboard id
+		appCtx.Log.Error("invalid dashboard id", r.FormValue("id"))
+		response.WriteError(w, response.Error{Err: "Invalid dashboard id " + r.FormValue("id")}, http.StatusBadRequest)
+		return
+	}
+
+	//getting the versions
+	d := &db.Dashboard{}
+	d.ID = uint(id)
+	vs, err := d.GetVersions(appCtx, appCtx.Session.User.ID)
+	if err != nil {
+		writeVersionError(appCtx, w, err, d.ID)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully fetched the versions of the dashboard", Data: vs})
+}
+
+//GetVersion will return the revision of the dashboard along with its snapshot with the id and revision given in the request
+func GetVersion(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the dashboard id and the revision
+	 * Then we will get the version
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to get a version of a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the dashboard id and the revision
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		//invalid dashboard id
+		appCtx.Log.Error("invalid dashboard id", r.FormValue("id"))
+		response.WriteError(w, response.Error{Err: "Invalid dashboard id " + r.FormValue("id")}, http.StatusBadRequest)
+		return
+	}
+	rev, err := strconv.Atoi(r.FormValue("revision"))
+	if err != nil || rev <= 0 {
+		//invalid revision
+		appCtx.Log.Error("invalid revision", r.FormValue("revision"))
+		response.WriteError(w, response.Error{Err: "Invalid revision " + r.FormValue("revision")}, http.StatusBadRequest)
+		return
+	}
+
+	//getting the version
+	d := &db.Dashboard{}
+	d.ID = uint(id)
+	v, err := d.GetVersion(appCtx, appCtx.Session.User.ID, uint(rev))
+	if err != nil {
+		writeVersionError(appCtx, w, err, d.ID)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully fetched the version of the dashboard", Data: v})
+}
+
+//RestoreVersion will restore the revision of the dashboard in the request payload as a new revision
+func RestoreVersion(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload
+	 * Then we will restore the version
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to restore a version of a dashboard by", appCtx.Session.User.ID)
+
+	//parsing the request payload
+	ver := &Version{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(ver)
+	if err != nil {
+		//error while decoding the request param
+		appCtx.Log.Error("error while parsing the request body", err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	//restoring the version
+	d := &db.Dashboard{}
+	d.ID = ver.DashboardID
+	v, err := d.Restore(appCtx, appCtx.Session.User.ID, ver.Revision)
+	if err != nil {
+		writeVersionError(appCtx, w, err, d.ID)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully restored the version of the dashboard", Data: v})
+}
+
+func init() {
+	routes.AddRoutes(
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/versions",
+			HandlerFunc: ListVersions,
+			ParseForm:   true,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/version",
+			HandlerFunc: GetVersion,
+			ParseForm:   true,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/dashboard/version/restore",
+			HandlerFunc: RestoreVersion,
+		},
+	)
+}
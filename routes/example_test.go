@@ -31,8 +31,8 @@ func ExampleInitRoutes() {
 		Addr:           ":" + config.Port,
 		Handler:        m,
 		ReadTimeout:    config.RequestRTimeout,
-		WriteTimeout:   config.ResponseWTimeout,
 		MaxHeaderBytes: 1 << 20,
+		ConnContext:    routes.ConnContext,
 	}
 
 	//inited the routes
@@ -0,0 +1,301 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/apache/arrow/go/arrow/memory"
+	"github.com/cuttle-ai/octopus-service/db"
+	"github.com/xitongsys/parquet-go/source"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+/*
+ * This file contains the writers of the search results in the columnar formats, arrow and parquet.
+ * Values are converted to the types of the columns in the result schema. Values which can't be converted are written as nulls
+ */
+
+//arrowBatchRows is the maximum no. of rows in a record batch of the arrow stream
+const arrowBatchRows = 10000
+
+//arrowTypes are the arrow data types of the column types
+var arrowTypes = map[db.ColumnType]arrow.DataType{
+	db.ColumnString: arrow.BinaryTypes.String,
+	db.ColumnInt:    arrow.PrimitiveTypes.Int64,
+	db.ColumnFloat:  arrow.PrimitiveTypes.Float64,
+	db.ColumnBool:   arrow.FixedWidthTypes.Boolean,
+	db.ColumnTime:   arrow.FixedWidthTypes.Timestamp_ms,
+}
+
+//parquetTypes are the parquet types of the column types
+var parquetTypes = map[db.ColumnType]string{
+	db.ColumnString: "UTF8",
+	db.ColumnInt:    "INT64",
+	db.ColumnFloat:  "DOUBLE",
+	db.ColumnBool:   "BOOLEAN",
+	db.ColumnTime:   "TIMESTAMP_MILLIS",
+}
+
+//arrowWriter writes the rows as an arrow ipc stream of record batches
+type arrowWriter struct {
+	w    io.Writer
+	mem  memory.Allocator
+	b    *array.RecordBuilder
+	ipc  *ipc.Writer
+	cols []db.ResultColumn
+	rows int
+}
+
+//newArrowWriter returns the row writer writing an arrow ipc stream
+func newArrowWriter(w io.Writer) rowWriter {
+	return &arrowWriter{w: w, mem: memory.NewGoAllocator()}
+}
+
+func (a *arrowWriter) header(cols []db.ResultColumn) error {
+	fields := []arrow.Field{}
+	for _, c := range cols {
+		fields = append(fields, arrow.Field{Name: c.Name, Type: arrowTypes[c.Type], Nullable: true})
+	}
+	schema := arrow.NewSchema(fields, nil)
+	a.cols = cols
+	a.b = array.NewRecordBuilder(a.mem, schema)
+	a.ipc = ipc.NewWriter(a.w, ipc.WithSchema(schema), ipc.WithAllocator(a.mem))
+	return nil
+}
+
+func (a *arrowWriter) row(vals []interface{}) error {
+	for i, v := range vals {
+		switch b := a.b.Field(i).(type) {
+		case *array.Int64Builder:
+			if n, ok := toInt64(v); ok {
+				b.Append(n)
+			} else {
+				b.AppendNull()
+			}
+		case *array.Float64Builder:
+			if f, ok := toFloat64(v); ok {
+				b.Append(f)
+			} else {
+				b.AppendNull()
+			}
+		case *array.BooleanBuilder:
+			if t, ok := toBool(v); ok {
+				b.Append(t)
+			} else {
+				b.AppendNull()
+			}
+		case *array.TimestampBuilder:
+			if t, ok := toTime(v); ok {
+				b.Append(arrow.Timestamp(t.UnixNano() / int64(time.Millisecond)))
+			} else {
+				b.AppendNull()
+			}
+		case *array.StringBuilder:
+			if v != nil {
+				b.Append(cellString(v))
+			} else {
+				b.AppendNull()
+			}
+		}
+	}
+	a.rows++
+	if a.rows == arrowBatchRows {
+		return a.flush()
+	}
+	return nil
+}
+
+//flush writes the rows built so far as a record batch
+func (a *arrowWriter) flush() error {
+	rec := a.b.NewRecord()
+	defer rec.Release()
+	a.rows = 0
+	return a.ipc.Write(rec)
+}
+
+func (a *arrowWriter) close() error {
+	if a.rows != 0 {
+		err := a.flush()
+		if err != nil {
+			return err
+		}
+	}
+	a.b.Release()
+	return a.ipc.Close()
+}
+
+//parquetSink is the parquet file writing to a stream. The parquet writer only appends to the file, so the rest is not supported
+type parquetSink struct {
+	io.Writer
+}
+
+//errParquetSink is returned for the unsupported operations of the parquet sink
+var errParquetSink = errors.New("parquet sink can only be written to")
+
+func (parquetSink) Seek(offset int64, whence int) (int64, error)   { return 0, errParquetSink }
+func (parquetSink) Read(p []byte) (int, error)                     { return 0, errParquetSink }
+func (parquetSink) Close() error                                   { return nil }
+func (parquetSink) Open(name string) (source.ParquetFile, error)   { return nil, errParquetSink }
+func (parquetSink) Create(name string) (source.ParquetFile, error) { return nil, errParquetSink }
+
+//parquetWriter writes the rows as a parquet file. Rows are buffered till a row group is complete
+type parquetWriter struct {
+	w    io.Writer
+	pw   *writer.CSVWriter
+	cols []db.ResultColumn
+}
+
+//newParquetWriter returns the row writer writing a parquet file
+func newParquetWriter(w io.Writer) rowWriter {
+	return &parquetWriter{w: w}
+}
+
+//parquetName returns the name of the column usable in the parquet schema. Characters other than letters,
+//digits and underscores are replaced with underscores and the duplicates are suffixed with their position
+func parquetName(name string, i int, taken map[string]bool) string {
+	n := strings.Map(func(r rune) rune {
+		if r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+	if len(n) == 0 || taken[strings.ToLower(n)] {
+		n += "_" + strconv.Itoa(i)
+	}
+	taken[strings.ToLower(n)] = true
+	return n
+}
+
+func (p *parquetWriter) header(cols []db.ResultColumn) error {
+	md := []string{}
+	taken := map[string]bool{}
+	for i, c := range cols {
+		md = append(md, fmt.Sprintf("name=%s, type=%s", parquetName(c.Name, i, taken), parquetTypes[c.Type]))
+	}
+	pw, err := writer.NewCSVWriter(md, parquetSink{p.w}, 4)
+	if err != nil {
+		return err
+	}
+	p.pw = pw
+	p.cols = cols
+	return nil
+}
+
+func (p *parquetWriter) row(vals []interface{}) error {
+	rec := make([]interface{}, len(vals))
+	for i, v := range vals {
+		var ok bool
+		switch p.cols[i].Type {
+		case db.ColumnInt:
+			rec[i], ok = toInt64(v)
+		case db.ColumnFloat:
+			rec[i], ok = toFloat64(v)
+		case db.ColumnBool:
+			rec[i], ok = toBool(v)
+		case db.ColumnTime:
+			var t time.Time
+			t, ok = toTime(v)
+			rec[i] = t.UnixNano() / int64(time.Millisecond)
+		default:
+			rec[i], ok = cellString(v), v != nil
+		}
+		if !ok {
+			rec[i] = nil
+		}
+	}
+	return p.pw.Write(rec)
+}
+
+func (p *parquetWriter) close() error {
+	return p.pw.WriteStop()
+}
+
+//toInt64 converts the value to an integer. ok will be false if the value is not an integer
+func toInt64(v interface{}) (int64, bool) {
+	switch t := v.(type) {
+	case string:
+		n, err := strconv.ParseInt(strings.TrimSpace(t), 10, 64)
+		return n, err == nil
+	case []byte:
+		return toInt64(string(t))
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		return int64(f), f == float64(int64(f))
+	}
+	return 0, false
+}
+
+//toFloat64 converts the value to a decimal. ok will be false if the value is not a number
+func toFloat64(v interface{}) (float64, bool) {
+	switch t := v.(type) {
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(t), 64)
+		return f, err == nil
+	case []byte:
+		return toFloat64(string(t))
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	}
+	return 0, false
+}
+
+//toBool converts the value to a boolean. ok will be false if the value is not a boolean
+func toBool(v interface{}) (bool, bool) {
+	switch t := v.(type) {
+	case bool:
+		return t, true
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(t))
+		return b, err == nil
+	case []byte:
+		return toBool(string(t))
+	}
+	return false, false
+}
+
+//timeLayouts are the layouts in which the dates and times are parsed from the text values
+var timeLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05.999999999Z07:00", "2006-01-02 15:04:05.999999999", "2006-01-02"}
+
+//toTime converts the value to a time. ok will be false if the value is not a time
+func toTime(v interface{}) (time.Time, bool) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, true
+	case string:
+		for _, l := range timeLayouts {
+			tm, err := time.Parse(l, strings.TrimSpace(t))
+			if err == nil {
+				return tm, true
+			}
+		}
+	case []byte:
+		return toTime(string(t))
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,321 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package interpreter
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus-service/db"
+	"github.com/cuttle-ai/octopus-service/routes"
+	"github.com/cuttle-ai/octopus-service/routes/response"
+)
+
+/*
+ * This file contains the export of the search results as files
+ */
+
+//ExportQuery is the input for exporting the result of a natural language query
+type ExportQuery struct {
+	Query
+	//Format is the file format of the export. It can be csv, tsv, xlsx, arrow or parquet. If empty,
+	//the format is negotiated with the Accept header of the request falling back to csv
+	Format string `json:"format,omitempty"`
+}
+
+//rowWriter writes the rows of the result in a file format
+type rowWriter interface {
+	//header writes the columns of the result. It is written once before the rows
+	header(cols []db.ResultColumn) error
+	//row writes the values of a row in the order of the columns
+	row(vals []interface{}) error
+	//close completes the file
+	close() error
+}
+
+//exportFormat is a file format in which the search results can be exported
+type exportFormat struct {
+	//contentType is the mime type of the format
+	contentType string
+	//newWriter returns the row writer writing the format to the given writer
+	newWriter func(w io.Writer) rowWriter
+}
+
+//exportFormats are the supported export formats with their file extension as the key
+var exportFormats = map[string]exportFormat{
+	"arrow":   {contentType: "application/vnd.apache.arrow.stream", newWriter: newArrowWriter},
+	"parquet": {contentType: "application/vnd.apache.parquet", newWriter: newParquetWriter},
+	"csv":     {contentType: "text/csv", newWriter: func(w io.Writer) rowWriter { return newCSVWriter(w, ',') }},
+	"tsv":     {contentType: "text/tab-separated-values", newWriter: func(w io.Writer) rowWriter { return newCSVWriter(w, '\t') }},
+	"xlsx":    {contentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", newWriter: newXLSXWriter},
+}
+
+//findExportFormat returns the extension of the export format with the given name. If the name is empty, the first
+//format accepted by the accept header is returned falling back to csv. ok will be false for an unsupported format
+func findExportFormat(name, accept string) (ext string, ok bool) {
+	if len(name) != 0 {
+		ext = strings.ToLower(name)
+		_, ok = exportFormats[ext]
+		return ext, ok
+	}
+	exts := []string{}
+	for e := range exportFormats {
+		exts = append(exts, e)
+	}
+	sort.Strings(exts)
+	for _, e := range exts {
+		if strings.Contains(accept, exportFormats[e].contentType) {
+			return e, true
+		}
+	}
+	return "csv", true
+}
+
+//csvWriter writes the rows as delimiter separated values
+type csvWriter struct {
+	w *csv.Writer
+}
+
+//newCSVWriter returns the row writer writing the values separated by the given delimiter
+func newCSVWriter(w io.Writer, comma rune) rowWriter {
+	c := csv.NewWriter(w)
+	c.Comma = comma
+	return csvWriter{w: c}
+}
+
+func (c csvWriter) header(cols []db.ResultColumn) error {
+	names := make([]string, len(cols))
+	for i, col := range cols {
+		names[i] = escapeFormula(col.Name)
+	}
+	return c.w.Write(names)
+}
+
+func (c csvWriter) row(vals []interface{}) error {
+	rec := make([]string, len(vals))
+	for i, v := range vals {
+		rec[i] = escapeFormula(cellString(v))
+	}
+	return c.w.Write(rec)
+}
+
+func (c csvWriter) close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+//formulaPrefixes are the characters with which the spreadsheet applications start a formula in a cell
+const formulaPrefixes = "=+-@\t\r"
+
+//escapeFormula prefixes the text starting like a formula with ' so that the spreadsheet applications opening
+//the delimiter separated values don't evaluate it. Numbers like -1 are not escaped
+func escapeFormula(s string) string {
+	if len(s) == 0 || !strings.ContainsRune(formulaPrefixes, rune(s[0])) {
+		return s
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return s
+	}
+	return "'" + s
+}
+
+//cellString returns the string representation of the value of a cell
+func cellString(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case []byte:
+		return string(t)
+	case time.Time:
+		return t.Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(t), 'f', -1, 32)
+	}
+	return fmt.Sprint(v)
+}
+
+//countWriter counts the bytes written to the writer
+type countWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += n
+	return n, err
+}
+
+//Export will interpret the given natural language query and write its whole result as a downloadable file.
+//Columns are in the order of the select list of the interpreted query. If the export fails or times out after
+//a part of the file is written, the response is aborted so that the client doesn't get an incomplete file as a complete one
+func Export(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload query
+	 * Then we will find the export format
+	 * Then we will interpret the query
+	 * Then we will resolve the table if the query is on a single table
+	 * Then we will check whether the result fits in a sheet for the excel export
+	 * Then we will write the headers of the file download
+	 * Then we will write the rows of the result chunk by chunk
+	 * Then we will complete the file
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to export the result of a query by", appCtx.Session.User.ID)
+
+	//parsing the query
+	rq := &ExportQuery{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(rq)
+	if err != nil {
+		//error while decoding the request param
+		appCtx.Log.Error("error while parsing the request body", err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	//finding the export format
+	ext, ok := findExportFormat(rq.Format, r.Header.Get("Accept"))
+	if !ok {
+		//unsupported format
+		appCtx.Log.Error("unsupported export format", rq.Format)
+		response.WriteError(w, response.Error{Err: "Unsupported export format " + rq.Format}, http.StatusBadRequest)
+		return
+	}
+	format := exportFormats[ext]
+
+	//interpreting the query
+	ins, err := InterpretNL(appCtx, rq.NL)
+	if err != nil {
+		//error while interpreting the user query
+		response.WriteError(w, response.Error{Err: "Unable to interpret your query"}, http.StatusInternalServerError)
+		return
+	}
+
+	//resolving the table
+	if len(ins.Tables) <= 1 {
+		_, err = db.ResolveTable(*ins)
+		if err != nil {
+			//couldn't find the table for the query
+			appCtx.Log.Error("error while resolving the table of the query", err)
+			response.WriteError(w, response.Error{Err: "Couldn't find the table to be queried for your query"}, http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	//checking whether the result fits in a sheet
+	if ext == "xlsx" {
+		total, err := db.CountRows(ctx, *appCtx, *ins)
+		if err != nil {
+			//error while counting the rows
+			appCtx.Log.Error("error while counting the rows of the query for the export", err)
+			response.WriteError(w, response.Error{Err: "Unable to fetch the result of your query"}, http.StatusInternalServerError)
+			return
+		}
+		if total >= xlsxMaxRows {
+			//result doesn't fit in a sheet
+			appCtx.Log.Error("result of the query has too many rows for an excel export", total)
+			response.WriteError(w, response.Error{Err: fmt.Sprintf("Result has %d rows. An excel export can have at most %d rows", total, xlsxMaxRows-1)}, http.StatusRequestEntityTooLarge)
+			return
+		}
+	}
+
+	//writing the headers of the file download
+	w.Header().Set("Content-Type", format.contentType)
+	w.Header().Set("Content-Disposition", `attachment; filename="search-results.`+ext+`"`)
+	cw := &countWriter{w: w}
+	rw := format.newWriter(cw)
+
+	//writing the rows
+	cols := db.ResultSchema(*ins)
+	n := 0
+	err = db.ExecChunks(ctx, *appCtx, *ins, config.MaxSearchRows, func(rows []map[string]interface{}) error {
+		if n == 0 {
+			cols = db.ReconcileColumns(cols, rows[0])
+			err := rw.header(cols)
+			if err != nil {
+				return err
+			}
+		}
+		for _, row := range rows {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			vals := make([]interface{}, len(cols))
+			for i, c := range cols {
+				vals[i] = row[c.Name]
+			}
+			err := rw.row(vals)
+			if err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	if ctx.Err() == context.Canceled {
+		//client has disconnected
+		appCtx.Log.Info("stopped exporting the query as the client has disconnected after", n, "rows")
+		return
+	}
+	if err != nil && cw.n == 0 {
+		//error before writing the file
+		appCtx.Log.Error("error while executing the query for the export", err)
+		status := http.StatusInternalServerError
+		if err == context.DeadlineExceeded {
+			status = http.StatusGatewayTimeout
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Del("Content-Disposition")
+		response.WriteError(w, response.Error{Err: "Unable to fetch the result of your query"}, status)
+		return
+	}
+	if err != nil {
+		//error after writing a part of the file. The response is aborted without completing it
+		appCtx.Log.Error("error while exporting the result of the query after", n, "rows", err)
+		panic(http.ErrAbortHandler)
+	}
+
+	//completing the file
+	if n == 0 {
+		err = rw.header(cols)
+		if err != nil {
+			appCtx.Log.Error("error while writing the header of the export", err)
+			return
+		}
+	}
+	err = rw.close()
+	if err != nil {
+		appCtx.Log.Error("error while completing the export", err)
+		panic(http.ErrAbortHandler)
+	}
+}
+
+func init() {
+	routes.AddRoutes(
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/search/export",
+			HandlerFunc: Export,
+			Stream:      true,
+		},
+	)
+}
@@ -0,0 +1,86 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package interpreter
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/cuttle-ai/octopus-service/db"
+)
+
+/*
+ * This file contains the tests of the export of the search results as delimiter separated values
+ */
+
+func TestEscapeFormula(t *testing.T) {
+	cases := []struct {
+		s   string
+		res string
+	}{
+		{"", ""},
+		{"sales", "sales"},
+		{"=SUM(A1:A2)", "'=SUM(A1:A2)"},
+		{"+1+2", "'+1+2"},
+		{"-2+3", "'-2+3"},
+		{"@cmd", "'@cmd"},
+		{"\tx", "'\tx"},
+		{"\rx", "'\rx"},
+		{"-1", "-1"},
+		{"+1.5", "+1.5"},
+		{"-1e3", "-1e3"},
+		{"a=b", "a=b"},
+	}
+	for _, c := range cases {
+		if res := escapeFormula(c.s); res != c.res {
+			t.Errorf("expected %q to be escaped as %q, got %q", c.s, c.res, res)
+		}
+	}
+}
+
+func TestCellString(t *testing.T) {
+	cases := []struct {
+		v   interface{}
+		res string
+	}{
+		{nil, ""},
+		{"a", "a"},
+		{[]byte("b"), "b"},
+		{time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC), "2019-01-02T03:04:05Z"},
+		{1.5, "1.5"},
+		{float64(1e21), "1000000000000000000000"},
+		{float32(0.1), "0.1"},
+		{int64(-3), "-3"},
+		{true, "true"},
+	}
+	for _, c := range cases {
+		if res := cellString(c.v); res != c.res {
+			t.Errorf("expected the cell string of %#v to be %q, got %q", c.v, c.res, res)
+		}
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	b := &bytes.Buffer{}
+	w := newCSVWriter(b, ';')
+	err := w.header([]db.ResultColumn{{Name: "city"}, {Name: "=total"}})
+	if err == nil {
+		err = w.row([]interface{}{"a;b", 1.5})
+	}
+	if err == nil {
+		err = w.row([]interface{}{"=HYPERLINK(\"x\")", nil})
+	}
+	if err == nil {
+		err = w.close()
+	}
+	if err != nil {
+		t.Fatalf("expected no error while writing, got %v", err)
+	}
+	exp := "city;'=total\n\"a;b\";1.5\n\"'=HYPERLINK(\"\"x\"\")\";\n"
+	if b.String() != exp {
+		t.Errorf("expected the values %q, got %q", exp, b.String())
+	}
+}
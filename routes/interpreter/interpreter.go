@@ -23,12 +23,54 @@ import (
 type Query struct {
 	//NL is the natural language query
 	NL string `json:"nl,omitempty"`
+	//Limit is the maximum no. of result rows to be returned. It is capped by the server
+	Limit int `json:"limit,omitempty"`
+	//Offset is the no. of result rows to be skipped
+	Offset int `json:"offset,omitempty"`
+	//Cursor is the opaque cursor returned with the previous page for fetching the next page. It takes precedence over limit and offset
+	Cursor string `json:"cursor,omitempty"`
+	//NoCache will execute the query in the datastores without looking up the result cache
+	NoCache bool `json:"noCache,omitempty"`
 }
 
 //QueryResult has the interpreter query and recommended visualization
 type QueryResult struct {
 	interpreter.Query
 	visualization.Visualization
+	//QueryID is the id with which the query can be referred later. Eg:- while pinning it to a dashboard
+	QueryID string
+	//Table is the table and the datastore chosen for executing the query when it is on a single table
+	Table *db.ResolvedTable `json:",omitempty"`
+	//Columns are the columns of the result rows in the order of the select list of the query
+	Columns []db.ResultColumn `json:",omitempty"`
+	//Pagination has the details of the page of the result returned by the search
+	Pagination *Pagination `json:",omitempty"`
+	//Cache has the details of the result cache usage while executing the query
+	Cache *db.CacheStatus `json:",omitempty"`
+}
+
+//InterpretNL will tokenize and interpret the given natural language query for the user in the app context
+func InterpretNL(appCtx *config.AppContext, nl string) (*interpreter.Query, error) {
+	/*
+	 * We will tokenize the query
+	 * Then we will interpret the query
+	 */
+	//tokenizing the query
+	toks, err := interpreter.Tokenize(strconv.Itoa(int(appCtx.Session.User.ID)), []rune(nl))
+	if err != nil {
+		//error while tokenizing the user query
+		appCtx.Log.Error("error while tokenizing the query", err)
+		return nil, err
+	}
+
+	//interpreting the query
+	ins, err := interpreter.Interpret(toks)
+	if err != nil {
+		//error while interpreting the user query
+		appCtx.Log.Error("error while interpreting the query", err)
+		return nil, err
+	}
+	return ins, nil
 }
 
 //Interpret will interpret a given natural language query
@@ -36,7 +78,6 @@ func Interpret(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	/*
 	 * First we will get the app context
 	 * Then we will parse the request payload query
-	 * Then we will tokenize the query
 	 * Then we will interpret the query
 	 * Then We will get the suggested visualization
 	 * Then we will write the response
@@ -57,20 +98,10 @@ func Interpret(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	//tokenizing the query
-	toks, err := interpreter.Tokenize(strconv.Itoa(int(appCtx.Session.User.ID)), []rune(rq.NL))
-	if err != nil {
-		//error while tokenizing the user query
-		appCtx.Log.Error("error while tokenizing the query", err)
-		response.WriteError(w, response.Error{Err: "Unable to interpret your query"}, http.StatusInternalServerError)
-		return
-	}
-
 	//interpreting the query
-	ins, err := interpreter.Interpret(toks)
+	ins, err := InterpretNL(appCtx, rq.NL)
 	if err != nil {
 		//error while interpreting the user query
-		appCtx.Log.Error("error while interpreting the query", err)
 		response.WriteError(w, response.Error{Err: "Unable to interpret your query"}, http.StatusInternalServerError)
 		return
 	}
@@ -87,10 +118,13 @@ func Search(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	/*
 	 * First we will get the app context
 	 * Then we will parse the request payload query
-	 * Then we will tokenize the query
+	 * Then we will find the page of the result requested
 	 * Then we will interpret the query
-	 * Then we will execute the query
+	 * Then we will resolve the table if the query is on a single table
+	 * Then we will execute the query for the page
+	 * Then we will reconcile the result columns with the rows
 	 * Then We will get the suggested visualization
+	 * Then we will save the query in the recent queries
 	 * Then we will write the response
 	 */
 	//getting the app context
@@ -109,26 +143,40 @@ func Search(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
-	//tokenizing the query
-	toks, err := interpreter.Tokenize(strconv.Itoa(int(appCtx.Session.User.ID)), []rune(rq.NL))
+	//finding the page
+	page, err := rq.page()
 	if err != nil {
-		//error while tokenizing the user query
-		appCtx.Log.Error("error while tokenizing the query", err)
-		response.WriteError(w, response.Error{Err: "Unable to interpret your query"}, http.StatusInternalServerError)
+		//invalid page
+		appCtx.Log.Error("invalid page requested for the query", err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
 		return
 	}
+	page = page.Normalize()
 
 	//interpreting the query
-	ins, err := interpreter.Interpret(toks)
+	ins, err := InterpretNL(appCtx, rq.NL)
 	if err != nil {
 		//error while interpreting the user query
-		appCtx.Log.Error("error while interpreting the query", err)
 		response.WriteError(w, response.Error{Err: "Unable to interpret your query"}, http.StatusInternalServerError)
 		return
 	}
 
-	//executing the query
-	ins.Result, err = db.Exec(*appCtx, *ins)
+	//resolving the table
+	var table *db.ResolvedTable
+	if len(ins.Tables) <= 1 {
+		table, err = db.ResolveTable(*ins)
+		if err != nil {
+			//couldn't find the table for the query
+			appCtx.Log.Error("error while resolving the table of the query", err)
+			response.WriteError(w, response.Error{Err: "Couldn't find the table to be queried for your query"}, http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	//executing the query for the page
+	var total int
+	ec := &db.ExecCache{NoCache: rq.NoCache || routes.NoCache(r)}
+	ins.Result, total, err = db.ExecPage(*appCtx, *ins, page, ec)
 	if err != nil {
 		//error while interpreting the user query
 		appCtx.Log.Error("error while executing the query", err)
@@ -136,11 +184,28 @@ func Search(ctx context.Context, w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	//reconciling the result columns with the rows
+	cols := db.ResultSchema(*ins)
+	if len(ins.Result) != 0 {
+		cols = db.ReconcileColumns(cols, ins.Result[0])
+	}
+
 	//getting the suggested visualization
 	vis := visualization.SuggestVisualization(ins)
 
+	//saving the query so that it can be referred later
+	id := SaveRecentQuery(RecentQuery{UserID: appCtx.Session.User.ID, NL: rq.NL, Query: *ins, Visualization: vis})
+
 	//writing the response
-	response.Write(w, response.Message{Message: "successfully search the query", Data: QueryResult{Query: *ins, Visualization: vis}})
+	response.Write(w, response.Message{Message: "successfully search the query", Data: QueryResult{
+		Query:         *ins,
+		Visualization: vis,
+		QueryID:       id,
+		Table:         table,
+		Columns:       cols,
+		Pagination:    newPagination(rq.NL, page, len(ins.Result), total),
+		Cache:         &ec.Status,
+	}})
 }
 
 func init() {
@@ -0,0 +1,85 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package interpreter
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/cuttle-ai/octopus-service/db"
+)
+
+/*
+ * This file contains the pagination of the search results
+ */
+
+//ErrInvalidCursor is returned when the cursor of the search request is malformed or was issued for another query
+var ErrInvalidCursor = errors.New("invalid cursor for the query")
+
+//Pagination has the details of the page of the search result returned. Rows of the result are ordered by the order of
+//the query followed by the selected columns, so the pages of a result don't overlap as long as the data in the datastore doesn't change
+type Pagination struct {
+	//Limit is the maximum no. of rows in the page
+	Limit int
+	//Offset is the no. of rows skipped before the page
+	Offset int
+	//Total is the total no. of rows in the result
+	Total int
+	//NextCursor is the opaque cursor for fetching the next page. It is empty for the last page
+	NextCursor string `json:",omitempty"`
+}
+
+//fingerprint returns the fingerprint of the natural language query to which the cursors are bound
+func fingerprint(nl string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(nl))
+	return h.Sum32()
+}
+
+//encodeCursor returns the opaque cursor pointing to the page of the natural language query
+func encodeCursor(nl string, p db.ResultPage) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d:%d", fingerprint(nl), p.Offset, p.Limit)))
+}
+
+//decodeCursor returns the page pointed by the cursor. If the cursor is malformed or
+//was issued for another natural language query ErrInvalidCursor is returned
+func decodeCursor(nl, cursor string) (db.ResultPage, error) {
+	p := db.ResultPage{}
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return p, ErrInvalidCursor
+	}
+	var f uint32
+	var rest string
+	n, _ := fmt.Sscanf(string(b), "%d:%d:%d%s", &f, &p.Offset, &p.Limit, &rest)
+	if n != 3 || f != fingerprint(nl) || p.Offset < 0 || p.Limit <= 0 {
+		return db.ResultPage{}, ErrInvalidCursor
+	}
+	return p, nil
+}
+
+//page returns the page of the result requested in the query. Cursor takes precedence over the limit and offset.
+//If the cursor is invalid ErrInvalidCursor is returned
+func (q Query) page() (db.ResultPage, error) {
+	if len(q.Cursor) != 0 {
+		return decodeCursor(q.NL, q.Cursor)
+	}
+	if q.Limit < 0 || q.Offset < 0 {
+		return db.ResultPage{}, errors.New("limit and offset can't be negative")
+	}
+	return db.ResultPage{Limit: q.Limit, Offset: q.Offset}, nil
+}
+
+//newPagination returns the pagination details of the page of the natural language query having the given no. of rows
+//with the total no. of rows in the result
+func newPagination(nl string, p db.ResultPage, rows, total int) *Pagination {
+	pg := &Pagination{Limit: p.Limit, Offset: p.Offset, Total: total}
+	if rows > 0 && p.Offset+rows < total {
+		pg.NextCursor = encodeCursor(nl, db.ResultPage{Limit: p.Limit, Offset: p.Offset + rows})
+	}
+	return pg
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package interpreter
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/cuttle-ai/octopus-service/db"
+)
+
+/*
+ * This file contains the tests of the pagination of the search results
+ */
+
+func TestPage(t *testing.T) {
+	nl := "sales by city"
+	next := newPagination(nl, db.ResultPage{Limit: 10, Offset: 20}, 10, 45).NextCursor
+	cases := []struct {
+		name string
+		q    Query
+		page db.ResultPage
+		err  bool
+	}{
+		{"limit and offset", Query{NL: nl, Limit: 10, Offset: 5}, db.ResultPage{Limit: 10, Offset: 5}, false},
+		{"negative offset", Query{NL: nl, Offset: -1}, db.ResultPage{}, true},
+		{"cursor of the next page", Query{NL: nl, Limit: 50, Offset: 0, Cursor: next}, db.ResultPage{Limit: 10, Offset: 30}, false},
+		{"cursor of another query", Query{NL: "sales by month", Cursor: next}, db.ResultPage{}, true},
+		{"malformed cursor", Query{NL: nl, Cursor: "not a cursor"}, db.ResultPage{}, true},
+		{"cursor with a trailing garbage", Query{NL: nl, Cursor: base64.RawURLEncoding.EncodeToString([]byte(encodeCursorText(nl, "30:10x")))}, db.ResultPage{}, true},
+		{"cursor with a negative offset", Query{NL: nl, Cursor: base64.RawURLEncoding.EncodeToString([]byte(encodeCursorText(nl, "-1:10")))}, db.ResultPage{}, true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			page, err := c.q.page()
+			if (err != nil) != c.err {
+				t.Fatalf("expected the error %v, got %v", c.err, err)
+			}
+			if err != nil && len(c.q.Cursor) != 0 && err != ErrInvalidCursor {
+				t.Errorf("expected the invalid cursor error, got %v", err)
+			}
+			if page != c.page {
+				t.Errorf("expected the page %v, got %v", c.page, page)
+			}
+		})
+	}
+}
+
+func TestNewPagination(t *testing.T) {
+	nl := "sales by city"
+	cases := []struct {
+		name  string
+		page  db.ResultPage
+		rows  int
+		total int
+		next  bool
+	}{
+		{"first page", db.ResultPage{Limit: 10}, 10, 25, true},
+		{"last page", db.ResultPage{Limit: 10, Offset: 20}, 5, 25, false},
+		{"page ending at the last row", db.ResultPage{Limit: 10, Offset: 15}, 10, 25, false},
+		{"empty page", db.ResultPage{Limit: 10, Offset: 30}, 0, 25, false},
+	}
+	for _, c := range cases {
+		pg := newPagination(nl, c.page, c.rows, c.total)
+		if pg.Limit != c.page.Limit || pg.Offset != c.page.Offset || pg.Total != c.total {
+			t.Errorf("%s: expected the page %v with the total %d, got %v", c.name, c.page, c.total, pg)
+		}
+		if (len(pg.NextCursor) != 0) != c.next {
+			t.Errorf("%s: expected the next cursor %v, got %q", c.name, c.next, pg.NextCursor)
+		}
+	}
+}
+
+//encodeCursorText returns the text of a cursor of the natural language query with the given page text
+func encodeCursorText(nl, page string) string {
+	b, _ := base64.RawURLEncoding.DecodeString(encodeCursor(nl, db.ResultPage{}))
+	s := string(b)
+	return s[:len(s)-len("0:0")] + page
+}
@@ -0,0 +1,81 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package interpreter
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+
+	"github.com/cuttle-ai/brain/visualization"
+	"github.com/cuttle-ai/octopus/interpreter"
+)
+
+/*
+ * This file contains the store for the recently searched queries so that they can be referred later with their id
+ */
+
+//MaxRecentQueries is the maximum no. of recent queries kept in the store
+var MaxRecentQueries = 1000
+
+//RecentQuery is a query recently searched by a user
+type RecentQuery struct {
+	//UserID is the id of the user who searched the query
+	UserID uint
+	//NL is the natural language query
+	NL string
+	//Query is the interpreted query without the result
+	Query interpreter.Query
+	//Visualization is the suggested visualization for the query
+	Visualization visualization.Visualization
+}
+
+type recentQueries struct {
+	q     map[string]RecentQuery
+	order []string
+	m     sync.Mutex
+}
+
+var recent = recentQueries{q: map[string]RecentQuery{}}
+
+//SaveRecentQuery will save the query in the recent queries store and return the id of the query
+func SaveRecentQuery(rq RecentQuery) string {
+	/*
+	 * We will generate the id for the query
+	 * We will add the lock
+	 * Then we will evict the oldest queries if the store is full
+	 * Then we will add the query to the store
+	 */
+	//generating the id
+	b := make([]byte, 16)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+	rq.Query.Result = nil
+
+	recent.m.Lock()
+	defer recent.m.Unlock()
+
+	//evicting the oldest queries
+	for len(recent.order) >= MaxRecentQueries && len(recent.order) > 0 {
+		delete(recent.q, recent.order[0])
+		recent.order = recent.order[1:]
+	}
+
+	//adding the query to the store
+	recent.q[id] = rq
+	recent.order = append(recent.order, id)
+	return id
+}
+
+//GetRecentQuery returns the recent query with the given id searched by the given user
+func GetRecentQuery(userID uint, id string) (RecentQuery, bool) {
+	recent.m.Lock()
+	defer recent.m.Unlock()
+	rq, ok := recent.q[id]
+	if !ok || rq.UserID != userID {
+		return RecentQuery{}, false
+	}
+	return rq, true
+}
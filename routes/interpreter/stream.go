@@ -0,0 +1,236 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package interpreter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/cuttle-ai/brain/visualization"
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus-service/db"
+	"github.com/cuttle-ai/octopus-service/routes"
+	"github.com/cuttle-ai/octopus-service/routes/response"
+)
+
+/*
+ * This file contains the streaming of the search results
+ */
+
+const (
+	//EventQuery is the first event of the stream having the interpreted query, the suggested visualization and the result columns.
+	//It is written before the query is executed
+	EventQuery = "query"
+	//EventColumns is the event having the result columns reconciled with the first row. It is written before the first row
+	//only if the columns differ from the ones in the query event
+	EventColumns = "columns"
+	//EventRow is the event having a row of the result
+	EventRow = "row"
+	//EventEnd is the last event of a successful stream having the no. of rows streamed
+	EventEnd = "end"
+	//EventError is the last event of a failed stream
+	EventError = "error"
+)
+
+//StreamEvent is an event of the search result stream written as a line in the ndjson streams
+type StreamEvent struct {
+	//Event is the name of the event
+	Event string
+	//Data is the payload of the event
+	Data interface{}
+}
+
+//StreamEnd is the payload of the end event of the stream
+type StreamEnd struct {
+	//Rows is the no. of rows streamed
+	Rows int
+}
+
+//streamWriter writes the events of the stream as server sent events or as newline delimited json
+type streamWriter struct {
+	w   http.ResponseWriter
+	f   http.Flusher
+	sse bool
+}
+
+//newStreamWriter returns the stream writer for the response. Server sent events are written if the client accepts
+//text/event-stream, else newline delimited json is written. If the response can't be flushed, false is returned
+func newStreamWriter(w http.ResponseWriter, r *http.Request) (*streamWriter, bool) {
+	f, ok := w.(http.Flusher)
+	if !ok {
+		return nil, false
+	}
+	return &streamWriter{w: w, f: f, sse: strings.Contains(r.Header.Get("Accept"), "text/event-stream")}, true
+}
+
+//writeHeader writes the content type and the status of the response
+func (s *streamWriter) writeHeader() {
+	if s.sse {
+		s.w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		s.w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	s.w.Header().Set("Cache-Control", "no-cache")
+	s.w.WriteHeader(http.StatusOK)
+}
+
+//event writes the event with the given payload. It is not flushed
+func (s *streamWriter) event(name string, data interface{}) error {
+	if !s.sse {
+		return json.NewEncoder(s.w).Encode(StreamEvent{Event: name, Data: data})
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = s.w.Write([]byte("event: " + name + "\ndata: " + string(b) + "\n\n"))
+	return err
+}
+
+//flush flushes the events written so far to the client
+func (s *streamWriter) flush() {
+	s.f.Flush()
+}
+
+//SearchStream will interpret the given natural language query and stream its result. The interpreted query
+//and the suggested visualization are written first before executing the query, followed by the rows of the whole result
+//flushed chunk by chunk. If the query fails after the stream has started, the stream ends with an error event.
+//The stream stops when the client disconnects. If the stream times out, it ends with an error event
+func SearchStream(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will get the stream writer
+	 * Then we will parse the request payload query
+	 * Then we will interpret the query
+	 * Then we will resolve the table if the query is on a single table
+	 * Then We will get the suggested visualization
+	 * Then we will save the query in the recent queries
+	 * Then we will write the query event
+	 * Then we will stream the rows of the result
+	 * Then we will write the end event
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to stream the search of a query by", appCtx.Session.User.ID)
+
+	//getting the stream writer
+	sw, ok := newStreamWriter(w, r)
+	if !ok {
+		//response can't be flushed
+		appCtx.Log.Error("response writer doesn't support flushing")
+		response.WriteError(w, response.Error{Err: "Streaming is not supported"}, http.StatusInternalServerError)
+		return
+	}
+
+	//parsing the query
+	rq := &Query{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(rq)
+	if err != nil {
+		//error while decoding the request param
+		appCtx.Log.Error("error while parsing the request body", err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	//interpreting the query
+	ins, err := InterpretNL(appCtx, rq.NL)
+	if err != nil {
+		//error while interpreting the user query
+		response.WriteError(w, response.Error{Err: "Unable to interpret your query"}, http.StatusInternalServerError)
+		return
+	}
+
+	//resolving the table
+	var table *db.ResolvedTable
+	if len(ins.Tables) <= 1 {
+		table, err = db.ResolveTable(*ins)
+		if err != nil {
+			//couldn't find the table for the query
+			appCtx.Log.Error("error while resolving the table of the query", err)
+			response.WriteError(w, response.Error{Err: "Couldn't find the table to be queried for your query"}, http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	//getting the suggested visualization
+	vis := visualization.SuggestVisualization(ins)
+
+	//saving the query so that it can be referred later
+	id := SaveRecentQuery(RecentQuery{UserID: appCtx.Session.User.ID, NL: rq.NL, Query: *ins, Visualization: vis})
+
+	//writing the query event
+	cols := db.ResultSchema(*ins)
+	sw.writeHeader()
+	err = sw.event(EventQuery, QueryResult{Query: *ins, Visualization: vis, QueryID: id, Table: table, Columns: cols})
+	if err != nil {
+		appCtx.Log.Error("error while writing the query event of the stream", err)
+		return
+	}
+	sw.flush()
+
+	//streaming the rows. Columns are reconciled with the first row
+	n := 0
+	err = db.ExecChunks(ctx, *appCtx, *ins, config.MaxSearchRows, func(rows []map[string]interface{}) error {
+		if n == 0 {
+			if rc := db.ReconcileColumns(cols, rows[0]); !reflect.DeepEqual(rc, cols) {
+				err := sw.event(EventColumns, rc)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		for _, row := range rows {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			err := sw.event(EventRow, row)
+			if err != nil {
+				return err
+			}
+			n++
+		}
+		sw.flush()
+		return nil
+	})
+	if ctx.Err() == context.Canceled {
+		//client has disconnected
+		appCtx.Log.Info("stopped streaming the query as the client has disconnected after", n, "rows")
+		return
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		//stream has timed out
+		appCtx.Log.Error("stopped streaming the query as it timed out after", n, "rows")
+		sw.event(EventError, response.Error{Err: "Streaming the result of your query timed out"})
+		sw.flush()
+		return
+	}
+	if err != nil {
+		//error while streaming the rows
+		appCtx.Log.Error("error while streaming the result of the query", err)
+		sw.event(EventError, response.Error{Err: "Unable to fetch the result of your query"})
+		sw.flush()
+		return
+	}
+
+	//writing the end event
+	sw.event(EventEnd, StreamEnd{Rows: n})
+	sw.flush()
+}
+
+func init() {
+	routes.AddRoutes(
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/search/stream",
+			HandlerFunc: SearchStream,
+			Stream:      true,
+		},
+	)
+}
@@ -0,0 +1,144 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package interpreter
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/cuttle-ai/octopus-service/db"
+)
+
+/*
+ * This file contains the writer of the search results as an excel workbook
+ */
+
+//xlsxMaxRows is the maximum no. of rows in an excel sheet including the header
+const xlsxMaxRows = 1048576
+
+//ErrTooManyRows is returned when the result doesn't fit in an excel sheet. Results are counted before the export,
+//so it is returned only if the result grows while it is being exported
+var ErrTooManyRows = errors.New("result has more rows than an excel sheet can have")
+
+//xlsxParts are the parts of the workbook other than the sheet with their path in the package
+var xlsxParts = []struct {
+	path    string
+	content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="Results" sheetId="1" r:id="rId1"/></sheets></workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`},
+}
+
+//xlsxWriter writes the rows as a single sheet excel workbook. The sheet is written as the rows come,
+//so the workbook is never held in memory
+type xlsxWriter struct {
+	z     *zip.Writer
+	sheet *bufio.Writer
+	rows  int
+}
+
+//newXLSXWriter returns the row writer writing an excel workbook
+func newXLSXWriter(w io.Writer) rowWriter {
+	return &xlsxWriter{z: zip.NewWriter(w)}
+}
+
+func (x *xlsxWriter) header(cols []db.ResultColumn) error {
+	/*
+	 * We will write the parts of the workbook other than the sheet
+	 * Then we will start the sheet and write the header row
+	 */
+	//writing the parts of the workbook
+	for _, p := range xlsxParts {
+		f, err := x.z.Create(p.path)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(f, p.content)
+		if err != nil {
+			return err
+		}
+	}
+
+	//starting the sheet
+	f, err := x.z.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	x.sheet = bufio.NewWriter(f)
+	x.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	vals := make([]interface{}, len(cols))
+	for i, c := range cols {
+		vals[i] = c.Name
+	}
+	return x.row(vals)
+}
+
+func (x *xlsxWriter) row(vals []interface{}) error {
+	if x.rows == xlsxMaxRows {
+		return ErrTooManyRows
+	}
+	x.rows++
+	x.sheet.WriteString("<row>")
+	for _, v := range vals {
+		writeXLSXCell(x.sheet, v)
+	}
+	_, err := x.sheet.WriteString("</row>")
+	return err
+}
+
+func (x *xlsxWriter) close() error {
+	x.sheet.WriteString("</sheetData></worksheet>")
+	err := x.sheet.Flush()
+	if err != nil {
+		return err
+	}
+	return x.z.Close()
+}
+
+//writeXLSXCell writes the value as a cell of the sheet. Numbers and booleans are written as typed cells
+//and the rest as inline strings
+func writeXLSXCell(w *bufio.Writer, v interface{}) {
+	switch t := v.(type) {
+	case nil:
+		w.WriteString("<c/>")
+		return
+	case bool:
+		if t {
+			w.WriteString(`<c t="b"><v>1</v></c>`)
+		} else {
+			w.WriteString(`<c t="b"><v>0</v></c>`)
+		}
+		return
+	case float64:
+		if math.IsNaN(t) || math.IsInf(t, 0) {
+			break
+		}
+		w.WriteString(`<c t="n"><v>` + cellString(t) + "</v></c>")
+		return
+	case float32:
+		if math.IsNaN(float64(t)) || math.IsInf(float64(t), 0) {
+			break
+		}
+		w.WriteString(`<c t="n"><v>` + cellString(t) + "</v></c>")
+		return
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		w.WriteString(`<c t="n"><v>` + cellString(t) + "</v></c>")
+		return
+	}
+	w.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+	xml.EscapeText(w, []byte(cellString(v)))
+	w.WriteString("</t></is></c>")
+}
@@ -0,0 +1,96 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+package interpreter
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"math"
+	"testing"
+
+	"github.com/cuttle-ai/octopus-service/db"
+)
+
+/*
+ * This file contains the tests of the writer of the search results as an excel workbook
+ */
+
+//readXLSX returns the parts of the workbook with their path as the key
+func readXLSX(t *testing.T, b []byte) map[string]string {
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatalf("expected a zip package, got %v", err)
+	}
+	parts := map[string]string{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("couldn't open the part %s: %v", f.Name, err)
+		}
+		c, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("couldn't read the part %s: %v", f.Name, err)
+		}
+		parts[f.Name] = string(c)
+	}
+	return parts
+}
+
+func TestXLSXWriter(t *testing.T) {
+	b := &bytes.Buffer{}
+	w := newXLSXWriter(b)
+	err := w.header([]db.ResultColumn{{Name: "city"}, {Name: "total"}, {Name: "active"}})
+	if err == nil {
+		err = w.row([]interface{}{"a < b & c", int64(3), true})
+	}
+	if err == nil {
+		err = w.row([]interface{}{nil, math.NaN(), false})
+	}
+	if err == nil {
+		err = w.row([]interface{}{"=1+1", 1.5, []byte("x")})
+	}
+	if err == nil {
+		err = w.close()
+	}
+	if err != nil {
+		t.Fatalf("expected no error while writing, got %v", err)
+	}
+	parts := readXLSX(t, b.Bytes())
+	for _, p := range xlsxParts {
+		if parts[p.path] != p.content {
+			t.Errorf("expected the part %s to be written as such, got %q", p.path, parts[p.path])
+		}
+	}
+	str := func(s string) string {
+		return `<c t="inlineStr"><is><t xml:space="preserve">` + s + "</t></is></c>"
+	}
+	exp := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+		"<row>" + str("city") + str("total") + str("active") + "</row>" +
+		"<row>" + str("a &lt; b &amp; c") + `<c t="n"><v>3</v></c><c t="b"><v>1</v></c></row>` +
+		"<row><c/>" + str("NaN") + `<c t="b"><v>0</v></c></row>` +
+		"<row>" + str("=1+1") + `<c t="n"><v>1.5</v></c>` + str("x") + "</row>" +
+		"</sheetData></worksheet>"
+	if sheet := parts["xl/worksheets/sheet1.xml"]; sheet != exp {
+		t.Errorf("expected the sheet %q, got %q", exp, sheet)
+	}
+}
+
+func TestXLSXWriterMaxRows(t *testing.T) {
+	w := newXLSXWriter(&bytes.Buffer{}).(*xlsxWriter)
+	err := w.header([]db.ResultColumn{{Name: "city"}})
+	if err != nil {
+		t.Fatalf("expected no error while writing the header, got %v", err)
+	}
+	w.rows = xlsxMaxRows - 1
+	if err = w.row([]interface{}{"a"}); err != nil {
+		t.Fatalf("expected the last row of the sheet to be written, got %v", err)
+	}
+	if err = w.row([]interface{}{"b"}); err != ErrTooManyRows {
+		t.Errorf("expected the error %v, got %v", ErrTooManyRows, err)
+	}
+}
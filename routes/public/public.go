@@ -0,0 +1,160 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//Package public has the implementation of the read only apis for the public dashboards and widgets.
+//These apis can be accessed without logging in
+package public
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus-service/db"
+	"github.com/cuttle-ai/octopus-service/routes"
+	"github.com/cuttle-ai/octopus-service/routes/response"
+	"github.com/jinzhu/gorm"
+)
+
+//Dashboard is the public view of the dashboard along with the results of its widgets
+type Dashboard struct {
+	db.Dashboard
+	//Widgets has the widgets in the dashboard along with their results
+	Widgets []db.WidgetResult
+}
+
+//GetDashboard will return the public dashboard with the id given in the request along with the results of its widgets
+func GetDashboard(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the dashboard id
+	 * Then we will get the public dashboard
+	 * Then we will get the widgets of the dashboard
+	 * Then we will execute the widgets with the dashboard filters and the access of the dashboard owner
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to get a public dashboard by", appCtx.Session.User.ID)
+
+	//parsing the dashboard id
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		//invalid dashboard id
+		appCtx.Log.Error("invalid dashboard id", r.FormValue("id"))
+		response.WriteError(w, response.Error{Err: "Invalid dashboard id " + r.FormValue("id")}, http.StatusBadRequest)
+		return
+	}
+
+	//getting the public dashboard
+	d, err := db.GetPublicDashboard(appCtx, uint(id))
+	if gorm.IsRecordNotFoundError(err) {
+		//couldn't find the dashboard
+		appCtx.Log.Error("couldn't find the public dashboard", id)
+		response.WriteError(w, response.Error{Err: "Couldn't find the dashboard"}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		//error while getting the dashboard
+		appCtx.Log.Error("error while getting the public dashboard", id, err)
+		response.WriteError(w, response.Error{Err: "Couldn't fetch the dashboard"}, http.StatusInternalServerError)
+		return
+	}
+
+	//getting the widgets of the dashboard
+	ws, err := d.GetWidgets(appCtx)
+	if err != nil {
+		//error while getting the widgets of the dashboard
+		appCtx.Log.Error("error while getting the widgets of the public dashboard", id, err)
+		response.WriteError(w, response.Error{Err: "Couldn't fetch the dashboard"}, http.StatusInternalServerError)
+		return
+	}
+
+	//executing the widgets with the owner's access
+	pd := Dashboard{Dashboard: *d, Widgets: db.ExecuteWidgets(appCtx.AsUser(d.UserID), d.ApplyFilters(ws))}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully fetched the dashboard", Data: pd})
+}
+
+//GetWidget will return the public widget with the id given in the request along with its result
+func GetWidget(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the widget id
+	 * Then we will get the public widget
+	 * Then we will apply the filters of the dashboard having the widget
+	 * Then we will execute the widget with the access of the widget owner
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to get a public widget by", appCtx.Session.User.ID)
+
+	//parsing the widget id
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		//invalid widget id
+		appCtx.Log.Error("invalid widget id", r.FormValue("id"))
+		response.WriteError(w, response.Error{Err: "Invalid widget id " + r.FormValue("id")}, http.StatusBadRequest)
+		return
+	}
+
+	//getting the public widget
+	wi, err := db.GetPublicWidget(appCtx, uint(id))
+	if gorm.IsRecordNotFoundError(err) {
+		//couldn't find the widget
+		appCtx.Log.Error("couldn't find the public widget", id)
+		response.WriteError(w, response.Error{Err: "Couldn't find the widget"}, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		//error while getting the widget
+		appCtx.Log.Error("error while getting the public widget", id, err)
+		response.WriteError(w, response.Error{Err: "Couldn't fetch the widget"}, http.StatusInternalServerError)
+		return
+	}
+
+	//applying the filters of the dashboard
+	err = wi.ApplyDashboardFilters(appCtx)
+	if err != nil {
+		//error while applying the filters of the dashboard
+		appCtx.Log.Error("error while applying the dashboard filters to the public widget", id, err)
+		response.WriteError(w, response.Error{Err: "Couldn't fetch the data for the widget"}, http.StatusInternalServerError)
+		return
+	}
+
+	//executing the widget with the owner's access
+	ec := &db.ExecCache{}
+	res, err := wi.Execute(appCtx.AsUser(wi.UserID), ec)
+	if err != nil {
+		//error while executing the widget
+		appCtx.Log.Error("error while executing the public widget", id, err)
+		response.WriteError(w, response.Error{Err: "Couldn't fetch the data for the widget"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully fetched the widget", Data: db.WidgetResult{Widget: *wi, Result: res, Cache: &ec.Status}})
+}
+
+func init() {
+	routes.AddRoutes(
+		routes.Route{
+			Version:        "v1",
+			Pattern:        "/public/dashboard",
+			HandlerFunc:    GetDashboard,
+			ParseForm:      true,
+			AllowAnonymous: true,
+		},
+		routes.Route{
+			Version:        "v1",
+			Pattern:        "/public/widget",
+			HandlerFunc:    GetWidget,
+			ParseForm:      true,
+			AllowAnonymous: true,
+		},
+	)
+}
@@ -0,0 +1,177 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//Package relationship has the implementation of the api for the relationships between the tables of the datastores.
+//Relationships are used for joining the tables in the queries spanning multiple tables
+package relationship
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus-service/db"
+	"github.com/cuttle-ai/octopus-service/routes"
+	"github.com/cuttle-ai/octopus-service/routes/response"
+	"github.com/jinzhu/gorm"
+)
+
+//Relationship data transilation object
+type Relationship struct {
+	db.TableRelationship
+}
+
+//CreateRelationship will create the relationship between the tables in the request payload
+func CreateRelationship(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload
+	 * Then we will create the relationship
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to create a table relationship by", appCtx.Session.User.ID)
+
+	//parsing the request payload
+	rel := &Relationship{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(rel)
+	if err != nil {
+		//error while decoding the request param
+		appCtx.Log.Error("error while parsing the request body", err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	//creating the relationship
+	err = rel.Create(appCtx, appCtx.Session.User.ID)
+	if err == db.ErrInvalidRelationship {
+		//invalid relationship
+		appCtx.Log.Error("invalid table relationship", rel.FromTable, rel.ToTable)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	if err == db.ErrPermissionDenied {
+		//user doesn't have the permission
+		appCtx.Log.Error("user doesn't have the permission to create the relationship in the datastore", rel.DatastoreID)
+		response.WriteError(w, response.Error{Err: "You don't have the permission to create relationships in the datastore"}, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		//error while creating the relationship
+		appCtx.Log.Error("error while creating the table relationship", err)
+		response.WriteError(w, response.Error{Err: "Couldn't create the relationship"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully created the relationship", Data: rel})
+}
+
+//ListRelationships will list the relationships between the tables of the datastore with the id given in the request.
+//Only the relationships created by the user or by the admins are listed
+func ListRelationships(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the datastore id
+	 * Then we will get the relationships
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to list the table relationships by", appCtx.Session.User.ID)
+
+	//parsing the datastore id
+	id, err := strconv.Atoi(r.FormValue("datastoreId"))
+	if err != nil || id <= 0 {
+		//invalid datastore id
+		appCtx.Log.Error("invalid datastore id", r.FormValue("datastoreId"))
+		response.WriteError(w, response.Error{Err: "Invalid datastore id " + r.FormValue("datastoreId")}, http.StatusBadRequest)
+		return
+	}
+
+	//getting the relationships
+	rs, err := db.GetRelationships(appCtx, appCtx.Session.User.ID, uint(id))
+	if err != nil {
+		//error while getting the relationships
+		appCtx.Log.Error("error while getting the table relationships of the datastore", id, err)
+		response.WriteError(w, response.Error{Err: "Couldn't fetch the relationships"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully fetched the relationships", Data: rs})
+}
+
+//DeleteRelationship will delete the relationship with the id given in the request
+func DeleteRelationship(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the relationship id
+	 * Then we will delete the relationship
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to delete a table relationship by", appCtx.Session.User.ID)
+
+	//parsing the relationship id
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		//invalid relationship id
+		appCtx.Log.Error("invalid relationship id", r.FormValue("id"))
+		response.WriteError(w, response.Error{Err: "Invalid relationship id " + r.FormValue("id")}, http.StatusBadRequest)
+		return
+	}
+
+	//deleting the relationship
+	err = db.DeleteRelationship(appCtx, appCtx.Session.User.ID, uint(id))
+	if gorm.IsRecordNotFoundError(err) {
+		//couldn't find the relationship
+		appCtx.Log.Error("couldn't find the relationship", id)
+		response.WriteError(w, response.Error{Err: "Couldn't find the relationship"}, http.StatusNotFound)
+		return
+	}
+	if err == db.ErrPermissionDenied {
+		//user doesn't have the permission
+		appCtx.Log.Error("user doesn't have the permission to delete the relationship", id)
+		response.WriteError(w, response.Error{Err: "You don't have the permission to delete the relationship"}, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		//error while deleting the relationship
+		appCtx.Log.Error("error while deleting the table relationship", id, err)
+		response.WriteError(w, response.Error{Err: "Couldn't delete the relationship"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully deleted the relationship"})
+}
+
+func init() {
+	routes.AddRoutes(
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/relationship/create",
+			HandlerFunc: CreateRelationship,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/relationship/list",
+			HandlerFunc: ListRelationships,
+			ParseForm:   true,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/relationship/delete",
+			HandlerFunc: DeleteRelationship,
+			ParseForm:   true,
+		},
+	)
+}
@@ -6,7 +6,9 @@ package routes
 
 import (
 	"context"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/cuttle-ai/octopus-service/log"
 	"github.com/cuttle-ai/octopus-service/routes/response"
@@ -35,21 +37,57 @@ type Route struct {
 	HandlerFunc HandlerFunc
 	//ParseForm will do a form parse before invoking the handler
 	ParseForm bool
+	//AllowAnonymous will let the requests without a valid auth cookie to be served with an anonymous session.
+	//Anonymous session has an unauthenticated user with id 0
+	AllowAnonymous bool
+	//Stream will serve the route without the response timeout handler. The timeout handler buffers the whole response,
+	//so routes flushing their response incrementally should set it and honour the request context themselves.
+	//Stream routes can write their response till config.StreamTimeout after which their request context is cancelled
+	Stream bool
 }
 
 //AppContextKey is the key with which the application is saved in the request context
 const AppContextKey = "app-context"
 
+//connContextKey is the key with which the connection of the request is saved in the request context
+type connContextKey struct{}
+
+//ConnContext saves the connection in the context of its requests. It has to be set as the ConnContext of the server
+//so that the routes can set the write deadline of their response. The server shouldn't have a write timeout
+//as it would cut off the streamed responses
+func ConnContext(ctx context.Context, c net.Conn) context.Context {
+	return context.WithValue(ctx, connContextKey{}, c)
+}
+
+//writeDeadline sets the write deadline of the connection of the request to the given time from now before serving it
+func writeDeadline(h http.Handler, timeout time.Duration) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if c, ok := req.Context().Value(connContextKey{}).(net.Conn); ok {
+			c.SetWriteDeadline(time.Now().Add(timeout))
+		}
+		h.ServeHTTP(res, req)
+	})
+}
+
 //Register registers the route with the default http handler func
 func (r Route) Register(s *http.ServeMux) {
 	/*
+	 * Will wrap the route with the timeout handler unless it is a stream
+	 * Will set the write deadline of the response. Streams get the stream timeout with time to write their error event
 	 * If the route version is default version then will register it without version string to http handler
 	 * Will register the router with the http handler
 	 */
+	var h http.Handler = r
+	timeout := config.StreamTimeout + config.ResponseWTimeout
+	if !r.Stream {
+		h = http.TimeoutHandler(r, config.ResponseTimeout, "timeout")
+		timeout = config.ResponseWTimeout
+	}
+	h = writeDeadline(h, timeout)
 	if r.Version == version.Default.API {
-		s.Handle(r.Pattern, http.TimeoutHandler(r, config.ResponseTimeout, "timeout"))
+		s.Handle(r.Pattern, h)
 	}
-	s.Handle("/"+r.Version+r.Pattern, http.TimeoutHandler(r, config.ResponseTimeout, "timeout"))
+	s.Handle("/"+r.Version+r.Pattern, h)
 }
 
 //ServeHTTP implements HandlerFunc of http package. It makes use of the context of request
@@ -59,11 +97,12 @@ func (r Route) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	 * Will parse the form if enabled
 	 * We will get the auth-access token from the header
 	 * Will get session information about the logged in user
+	 * If the route allows anonymous access, requests without a valid session will get an anonymous session
 	 * We will fetch the app context for the request
 	 * If app contexts have exhausted, we will reject the request
 	 * Then we will set the app context in request
 	 * Execute request handler func
-	 * After execution return the app context
+	 * After execution return the app context. It is returned even if the handler aborts the response
 	 */
 	//getting the context
 	ctx := req.Context()
@@ -82,24 +121,29 @@ func (r Route) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	}
 
 	//getting the auth token from the header
+	sess := authConfig.Session{User: &authConfig.User{}}
 	cookie, cErr := req.Cookie(authConfig.AuthHeaderKey)
-	if cErr != nil {
+	if cErr != nil && !r.AllowAnonymous {
 		log.Warn("Auth cookie not found")
 		response.WriteError(res, response.Error{Err: "Couldn't find the auth header " + authConfig.AuthHeaderKey}, http.StatusForbidden)
 		_, cancel := context.WithCancel(ctx)
 		cancel()
 		return
 	}
-	//we will try get the session information about the user
-	u, ok := authConfig.GetAutenticatedUser(cookie.Value)
-	if !ok {
-		log.Warn("User information not found the given auth header")
-		response.WriteError(res, response.Error{Err: "Couldn't find the user session " + cookie.Value}, http.StatusForbidden)
-		_, cancel := context.WithCancel(ctx)
-		cancel()
-		return
+	if cErr == nil {
+		//we will try get the session information about the user
+		u, ok := authConfig.GetAutenticatedUser(cookie.Value)
+		if !ok && !r.AllowAnonymous {
+			log.Warn("User information not found the given auth header")
+			response.WriteError(res, response.Error{Err: "Couldn't find the user session " + cookie.Value}, http.StatusForbidden)
+			_, cancel := context.WithCancel(ctx)
+			cancel()
+			return
+		}
+		if ok {
+			sess = authConfig.Session{ID: cookie.Value, Authenticated: true, User: &u}
+		}
 	}
-	sess := authConfig.Session{ID: cookie.Value, Authenticated: true, User: &u}
 
 	//fetching the app context
 	appCtxReq := AppContextRequest{
@@ -123,19 +167,21 @@ func (r Route) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	//setting the app context
 	newCtx := context.WithValue(ctx, AppContextKey, resCtx.AppContext)
 
+	//returning the app context after the execution
+	defer func() {
+		go SendRequest(AppContextRequestChan, AppContextRequest{
+			Type:       Finished,
+			AppContext: resCtx.AppContext,
+		})
+	}()
+
 	//executing the request
 	r.Exec(newCtx, res, req)
-
-	//returning the app context
-	appCtxReq = AppContextRequest{
-		Type:       Finished,
-		AppContext: resCtx.AppContext,
-	}
-	go SendRequest(AppContextRequestChan, appCtxReq)
 }
 
 //Exec will execute the handler func. By default it will set response content type as as json.
-//It will also cancel the context at the end. So no need of explicitly invoking the same in the handler funcs
+//It will also cancel the context at the end. So no need of explicitly invoking the same in the handler funcs.
+//Contexts of the stream routes time out after config.StreamTimeout
 func (r Route) Exec(ctx context.Context, res http.ResponseWriter, req *http.Request) {
 	/*
 	 * Will get the cancel for the context
@@ -144,14 +190,18 @@ func (r Route) Exec(ctx context.Context, res http.ResponseWriter, req *http.Requ
 	 * Cancelling the context at the end
 	 */
 	//getting the context cancel
-	c, cancel := context.WithCancel(ctx)
+	var c context.Context
+	var cancel context.CancelFunc
+	if r.Stream {
+		c, cancel = context.WithTimeout(ctx, config.StreamTimeout)
+	} else {
+		c, cancel = context.WithCancel(ctx)
+	}
+	defer cancel()
 
 	//setting the content type as json
 	res.Header().Set("Content-Type", "application/json")
 
 	//executing the handler
 	r.HandlerFunc(c, res, req)
-
-	//cancelling the context
-	cancel()
 }
@@ -8,7 +8,10 @@
 //with a server invoke the InitRoutes function.
 package routes
 
-import "net/http"
+import (
+	"net/http"
+	"strings"
+)
 
 //routes has the list of routes in the application
 var routes = []Route{}
@@ -18,6 +21,12 @@ func AddRoutes(r ...Route) {
 	routes = append(routes, r...)
 }
 
+//NoCache checks whether the request asks for fresh results without using the result cache.
+//It can be asked with the form value noCache=true or with the header Cache-Control: no-cache
+func NoCache(r *http.Request) bool {
+	return r.FormValue("noCache") == "true" || strings.Contains(strings.ToLower(r.Header.Get("Cache-Control")), "no-cache")
+}
+
 //InitRoutes initializes the routes in the application
 func InitRoutes(s *http.ServeMux) {
 	/*
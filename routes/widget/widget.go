@@ -0,0 +1,276 @@
+// Copyright 2019 Cuttle.ai. All rights reserved.
+// Use of this source code is governed by a MIT-style
+// license that can be found in the LICENSE file.
+
+//Package widget has the implementation of the widget api for the server
+package widget
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/cuttle-ai/brain/visualization"
+	"github.com/cuttle-ai/octopus-service/config"
+	"github.com/cuttle-ai/octopus-service/db"
+	"github.com/cuttle-ai/octopus-service/routes"
+	"github.com/cuttle-ai/octopus-service/routes/interpreter"
+	"github.com/cuttle-ai/octopus-service/routes/response"
+	"github.com/jinzhu/gorm"
+)
+
+//Widget data transilation object
+type Widget struct {
+	db.Widget
+}
+
+//CreateWidget will interpret the natural language query of the widget and create it for the logged in user
+func CreateWidget(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload
+	 * Then we will interpret the query
+	 * Then We will get the suggested visualization
+	 * Then we will create the widget
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to create a widget by", appCtx.Session.User.ID)
+
+	//parsing the request payload
+	wi := &Widget{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(wi)
+	if err != nil {
+		//error while decoding the request param
+		appCtx.Log.Error("error while parsing the request body", err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	//interpreting the query
+	ins, err := interpreter.InterpretNL(appCtx, wi.NL)
+	if err != nil {
+		//error while interpreting the user query
+		response.WriteError(w, response.Error{Err: "Unable to interpret your query"}, http.StatusInternalServerError)
+		return
+	}
+
+	//getting the suggested visualization
+	wi.Query = *ins
+	wi.Visualization = visualization.SuggestVisualization(ins)
+
+	//creating the widget
+	wi.UserID = appCtx.Session.User.ID
+	err = wi.Create(appCtx)
+	if err != nil {
+		//error while creating the widget
+		appCtx.Log.Error("error while creating the widget", err)
+		response.WriteError(w, response.Error{Err: "Couldn't create the widget"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully created the widget", Data: wi})
+}
+
+//GetWidget will return the widget with the id given in the request
+func GetWidget(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will get the widget
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to get a widget by", appCtx.Session.User.ID)
+
+	//getting the widget
+	wi, ok := getWidget(appCtx, w, r)
+	if !ok {
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully fetched the widget", Data: wi})
+}
+
+//RefreshWidget will re-run the query of the widget with the id given in the request and return the data.
+//Filters of the dashboard having the widget are applied to the query.
+//The query is executed in the datastores without looking up the result cache. The fresh result is still cached
+func RefreshWidget(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will get the widget
+	 * Then we will apply the filters of the dashboard having the widget
+	 * Then we will refresh the widget
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to refresh a widget by", appCtx.Session.User.ID)
+
+	//getting the widget
+	wi, ok := getWidget(appCtx, w, r)
+	if !ok {
+		return
+	}
+
+	//applying the filters of the dashboard
+	err := wi.ApplyDashboardFilters(appCtx)
+	if err != nil {
+		//error while applying the filters of the dashboard
+		appCtx.Log.Error("error while applying the dashboard filters to the widget", wi.ID, err)
+		response.WriteError(w, response.Error{Err: "Couldn't refresh the widget"}, http.StatusInternalServerError)
+		return
+	}
+
+	//refreshing the widget. An explicit refresh doesn't look up the result cache
+	ec := &db.ExecCache{NoCache: true}
+	res, err := wi.Refresh(appCtx, ec)
+	if err != nil {
+		//error while refreshing the widget
+		appCtx.Log.Error("error while refreshing the widget", wi.ID, err)
+		response.WriteError(w, response.Error{Err: "Couldn't refresh the widget"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully refreshed the widget", Data: db.WidgetResult{Widget: wi.Widget, Result: res, Cache: &ec.Status}})
+}
+
+//PublicAccess is the request payload for making a widget public or private
+type PublicAccess struct {
+	//ID of the widget
+	ID uint
+	//IsPublic indicates whether the widget has to be made public
+	IsPublic bool
+}
+
+//SetWidgetPublic will make the widget given in the request payload public or private as per its IsPublic.
+//The user should have the manage permission over the widget
+func SetWidgetPublic(ctx context.Context, w http.ResponseWriter, r *http.Request) {
+	/*
+	 * First we will get the app context
+	 * Then we will parse the request payload
+	 * Then we will update the public access of the widget
+	 * Then we will write the response
+	 */
+	//getting the app context
+	appCtx := ctx.Value(routes.AppContextKey).(*config.AppContext)
+	appCtx.Log.Info("Got a request to update the public access of a widget by", appCtx.Session.User.ID)
+
+	//parsing the request payload
+	p := &PublicAccess{}
+	dec := json.NewDecoder(r.Body)
+	err := dec.Decode(p)
+	if err != nil {
+		//error while decoding the request param
+		appCtx.Log.Error("error while parsing the request body", err)
+		response.WriteError(w, response.Error{Err: err.Error()}, http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	if p.ID == 0 {
+		//invalid widget id
+		appCtx.Log.Error("invalid widget id", p.ID)
+		response.WriteError(w, response.Error{Err: "Invalid widget id"}, http.StatusBadRequest)
+		return
+	}
+
+	//updating the public access of the widget
+	wi := &Widget{}
+	wi.ID = p.ID
+	err = wi.SetPublic(appCtx, appCtx.Session.User.ID, p.IsPublic)
+	if gorm.IsRecordNotFoundError(err) {
+		//couldn't find the widget
+		appCtx.Log.Error("couldn't find the widget", wi.ID)
+		response.WriteError(w, response.Error{Err: "Couldn't find the widget"}, http.StatusNotFound)
+		return
+	}
+	if err == db.ErrPermissionDenied {
+		//user doesn't have the permission
+		appCtx.Log.Error("user doesn't have the permission to update the public access of the widget", wi.ID)
+		response.WriteError(w, response.Error{Err: "You don't have the permission to update the public access of the widget"}, http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		//error while updating the widget
+		appCtx.Log.Error("error while updating the public access of the widget", wi.ID, err)
+		response.WriteError(w, response.Error{Err: "Couldn't update the public access of the widget"}, http.StatusInternalServerError)
+		return
+	}
+
+	//writing the response
+	response.Write(w, response.Message{Message: "successfully updated the public access of the widget", Data: wi})
+}
+
+//getWidget will get the widget with the id in the request form. If it fails, the error response is written and false is returned
+func getWidget(appCtx *config.AppContext, w http.ResponseWriter, r *http.Request) (*Widget, bool) {
+	/*
+	 * We will parse the widget id
+	 * Then we will get the widget
+	 */
+	//parsing the widget id
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id <= 0 {
+		//invalid widget id
+		appCtx.Log.Error("invalid widget id", r.FormValue("id"))
+		response.WriteError(w, response.Error{Err: "Invalid widget id " + r.FormValue("id")}, http.StatusBadRequest)
+		return nil, false
+	}
+
+	//getting the widget
+	wi := &Widget{}
+	wi.ID = uint(id)
+	err = wi.Get(appCtx, appCtx.Session.User.ID)
+	if gorm.IsRecordNotFoundError(err) {
+		//couldn't find the widget
+		appCtx.Log.Error("couldn't find the widget", id)
+		response.WriteError(w, response.Error{Err: "Couldn't find the widget"}, http.StatusNotFound)
+		return nil, false
+	}
+	if err == db.ErrPermissionDenied {
+		//user doesn't have the permission
+		appCtx.Log.Error("user doesn't have the permission for the widget", id)
+		response.WriteError(w, response.Error{Err: "You don't have the permission for the widget"}, http.StatusForbidden)
+		return nil, false
+	}
+	if err != nil {
+		//error while getting the widget
+		appCtx.Log.Error("error while getting the widget", id, err)
+		response.WriteError(w, response.Error{Err: "Couldn't fetch the widget"}, http.StatusInternalServerError)
+		return nil, false
+	}
+	return wi, true
+}
+
+func init() {
+	routes.AddRoutes(
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/widget/create",
+			HandlerFunc: CreateWidget,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/widget/get",
+			HandlerFunc: GetWidget,
+			ParseForm:   true,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/widget/refresh",
+			HandlerFunc: RefreshWidget,
+			ParseForm:   true,
+		},
+		routes.Route{
+			Version:     "v1",
+			Pattern:     "/widget/public",
+			HandlerFunc: SetWidgetPublic,
+		},
+	)
+}